@@ -0,0 +1,1119 @@
+package networkcontrol
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/FactomProject/factom"
+	"github.com/WhoSoup/factom-networkcontrol/audit"
+	"github.com/WhoSoup/factom-networkcontrol/authset"
+	"github.com/WhoSoup/factom-networkcontrol/identity"
+	"github.com/WhoSoup/factom-networkcontrol/proposal"
+	"github.com/labstack/echo/v4"
+)
+
+// apiError is the body of every failed API request
+type apiError struct {
+	Error string `json:"error"`
+}
+
+type apiSignature struct {
+	PubKey    string `json:"pubkey"`
+	Signature string `json:"signature"`
+	Valid     bool   `json:"valid"`
+	// Authority is the identity chain id of the signer, empty if the key
+	// does not belong to a current authority
+	Authority string `json:"authority,omitempty"`
+	// Role is the status of the signer, "federated" or "audit"
+	Role string `json:"role,omitempty"`
+	// Counts is true if the signature counts towards the quorum
+	Counts bool `json:"counts"`
+}
+
+type apiMessage struct {
+	Message     string         `json:"message"`
+	Type        string         `json:"type"`
+	ChainID     string         `json:"chainid"`
+	ServerType  string         `json:"servertype,omitempty"`
+	KeyChange   *apiKeyChange  `json:"keychange,omitempty"`
+	Timestamp   int64          `json:"timestamp"`
+	Time        time.Time      `json:"time"`
+	Payload     string         `json:"payload"`
+	SigningHash string         `json:"signinghash"`
+	Signatures  []apiSignature `json:"signatures"`
+	// Signers is the number of signatures counting towards the quorum
+	Signers  int    `json:"signers"`
+	Required int    `json:"required"`
+	Quorum   string `json:"quorum"`
+}
+
+type apiReport struct {
+	Info     []string    `json:"info"`
+	Errors   []string    `json:"errors"`
+	Signers  int         `json:"signers"`
+	Required int         `json:"required"`
+	OK       bool        `json:"ok"`
+	Message  *apiMessage `json:"message"`
+
+	Simulation *apiSimulation `json:"simulation"`
+}
+
+type apiSimulation struct {
+	FedBefore      int                 `json:"fedbefore"`
+	FedAfter       int                 `json:"fedafter"`
+	AuditBefore    int                 `json:"auditbefore"`
+	AuditAfter     int                 `json:"auditafter"`
+	RequiredBefore int                 `json:"requiredbefore"`
+	RequiredAfter  int                 `json:"requiredafter"`
+	FaultsBefore   int                 `json:"faultsbefore"`
+	FaultsAfter    int                 `json:"faultsafter"`
+	Warnings       []string            `json:"warnings"`
+	Authorities    []*factom.Authority `json:"authorities"`
+}
+
+type apiKeyChange struct {
+	// Kind is "signing", "anchor" or "matryoshka"
+	Kind string `json:"kind"`
+	Key  string `json:"key"`
+	// Priority and KeyType ("p2pkh" or "p2sh") are only used for anchor keys
+	Priority int    `json:"priority"`
+	KeyType  string `json:"keytype,omitempty"`
+}
+
+type apiCreateRequest struct {
+	// Type is "add", "remove" or "key"
+	Type       string `json:"type"`
+	ChainID    string `json:"chainid"`
+	ServerType string `json:"servertype"`
+	// KeyChange is required for "key" messages
+	KeyChange *apiKeyChange `json:"keychange"`
+	// Timestamp in milliseconds, defaults to the current time
+	Timestamp int64 `json:"timestamp"`
+}
+
+type apiMessageRequest struct {
+	Message string `json:"message"`
+	// Bundle can be given instead of Message
+	Bundle json.RawMessage `json:"bundle,omitempty"`
+}
+
+type apiSignRequest struct {
+	apiMessageRequest
+	PubKey    string `json:"pubkey"`
+	Signature string `json:"signature"`
+}
+
+type apiMergeRequest struct {
+	apiMessageRequest
+	Other string `json:"other"`
+	// OtherBundle can be given instead of Other
+	OtherBundle json.RawMessage `json:"otherbundle,omitempty"`
+}
+
+type apiProposal struct {
+	ID      string    `json:"id"`
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+	// Status is one of "draft", "scheduled", "pending", "applied" or "expired"
+	Status        string       `json:"status"`
+	AppliedHeight int64        `json:"appliedheight,omitempty"`
+	Schedule      *apiSchedule `json:"schedule,omitempty"`
+	Message       *apiMessage  `json:"message"`
+}
+
+type apiSchedule struct {
+	// At is the earliest time to send the message in milliseconds, zero if
+	// the message is only scheduled for a height
+	At     int64 `json:"at,omitempty"`
+	Height int64 `json:"height,omitempty"`
+	// Cancelled is the reason the server cancelled the schedule
+	Cancelled string `json:"cancelled,omitempty"`
+}
+
+type apiBatchRequest struct {
+	Messages []string `json:"messages"`
+}
+
+type apiBatch struct {
+	ID      string    `json:"id"`
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+	// Status is one of "draft", "sending", "done" or "failed"
+	Status string `json:"status"`
+	Next   int    `json:"next"`
+	Error  string `json:"error,omitempty"`
+	// Proposals are the member proposals in send order
+	Proposals []*apiProposal `json:"proposals"`
+	// Steps are the checks of the messages that are not applied yet, in
+	// send order. Each message is checked against the authority set that
+	// the messages before it produce.
+	Steps      []*apiReport   `json:"steps"`
+	Errors     []string       `json:"errors"`
+	OK         bool           `json:"ok"`
+	Simulation *apiSimulation `json:"simulation"`
+}
+
+type apiNetwork struct {
+	// Profile is the name of the network profile
+	Profile string `json:"profile"`
+	// Network is "main", "test", "local" or the hex id of a custom network
+	Network string `json:"network"`
+	Factomd string `json:"factomd"`
+	Quorum  string `json:"quorum"`
+	// Window is the timestamp window in seconds
+	Window int64 `json:"window"`
+}
+
+type apiKeyEntry struct {
+	Key    string    `json:"key"`
+	Height uint32    `json:"height"`
+	Time   time.Time `json:"time"`
+	// Priority and Type are only set for anchor keys
+	Priority *byte  `json:"priority,omitempty"`
+	Type     string `json:"type,omitempty"`
+}
+
+type apiIdentity struct {
+	ChainID string `json:"chainid"`
+	// Operator and Link are the name and website from the config file
+	Operator        string        `json:"operator,omitempty"`
+	Link            string        `json:"link,omitempty"`
+	Created         uint32        `json:"created"`
+	Keys            []string      `json:"keys"`
+	ManagementChain string        `json:"managementchain,omitempty"`
+	Registered      uint32        `json:"registered"`
+	SigningKeys     []apiKeyEntry `json:"signingkeys"`
+	AnchorKeys      []apiKeyEntry `json:"anchorkeys"`
+	MatryoshkaHash  *apiKeyEntry  `json:"matryoshkahash,omitempty"`
+	// Efficiency is in hundredths of a percent
+	Efficiency *uint16 `json:"efficiency,omitempty"`
+	Coinbase   string  `json:"coinbase,omitempty"`
+	Complete   bool    `json:"complete"`
+	// Warnings are the missing parts and differences to the authority set,
+	// Problems are the entries that were ignored
+	Warnings []string `json:"warnings"`
+	Problems []string `json:"problems"`
+}
+
+type apiCoverageRow struct {
+	// Authority is the identity chain id, empty for keys outside the
+	// authority set
+	Authority string `json:"authority,omitempty"`
+	Operator  string `json:"operator,omitempty"`
+	Role      string `json:"role,omitempty"`
+	PubKey    string `json:"pubkey"`
+	// State is "signed", "unsigned", "invalid" or "not an authority"
+	State  string `json:"state"`
+	Counts bool   `json:"counts"`
+}
+
+type apiCoverage struct {
+	ID       string `json:"id"`
+	Quorum   string `json:"quorum"`
+	Signers  int    `json:"signers"`
+	Required int    `json:"required"`
+	// Needed is the number of signatures still missing for the quorum
+	Needed int `json:"needed"`
+	// Closes is the end of the timestamp window, Left the seconds until then,
+	// negative if the window is closed
+	Closes time.Time        `json:"closes"`
+	Left   int64            `json:"left"`
+	Rows   []apiCoverageRow `json:"authorities"`
+}
+
+type apiLoginRequest struct {
+	User     string `json:"user"`
+	Password string `json:"password,omitempty"`
+	// Nonce and Signature answer a login challenge instead of a password
+	Nonce     string `json:"nonce,omitempty"`
+	Signature string `json:"signature,omitempty"`
+}
+
+type apiLogin struct {
+	// Token is passed as "Authorization: Bearer <token>"
+	Token   string    `json:"token"`
+	User    string    `json:"user"`
+	Role    string    `json:"role"`
+	Chain   string    `json:"chain,omitempty"`
+	Expires time.Time `json:"expires"`
+}
+
+type apiChallenge struct {
+	Nonce string `json:"nonce"`
+	// Data is what has to be signed, as hex
+	Data    string    `json:"data"`
+	Expires time.Time `json:"expires"`
+}
+
+type apiSendResponse struct {
+	Message  string `json:"message"`
+	Response string `json:"response"`
+	// Proposal is the id of the proposal that tracks the message
+	Proposal string `json:"proposal,omitempty"`
+}
+
+func (nc *NetworkControl) registerAPI(g *echo.Group) {
+	viewer := nc.require(RoleViewer)
+	proposer := nc.require(RoleProposer)
+	signer := nc.require(RoleSigner)
+	sender := nc.require(RoleSender)
+
+	g.Use(requireJSON)
+	g.GET("/login", nc.apiChallenge)
+	g.POST("/login", nc.apiLogin)
+	g.POST("/logout", nc.apiLogout)
+	g.GET("/network", nc.apiNetwork, viewer)
+	g.GET("/authorities", nc.apiAuthorities, viewer)
+	g.GET("/identities/:chainid", nc.apiIdentity, viewer)
+	g.GET("/audit", nc.auditExport, viewer)
+	g.POST("/create", nc.apiCreate, proposer)
+	g.POST("/decode", nc.apiDecode, viewer)
+	g.POST("/sign", nc.apiSign, signer)
+	g.POST("/signkey", nc.apiSignKey, signer)
+	g.POST("/merge", nc.apiMerge, proposer)
+	g.POST("/check", nc.apiCheck, viewer)
+	g.POST("/send", nc.apiSend, sender)
+	g.POST("/bundle", nc.apiBundle, viewer)
+	g.GET("/proposals", nc.apiProposals, viewer)
+	g.POST("/proposals", nc.apiSaveProposal, proposer)
+	g.GET("/proposals/:id", nc.apiProposal, viewer)
+	g.GET("/proposals/:id/coverage", nc.apiCoverage, viewer)
+	g.DELETE("/proposals/:id", nc.apiDeleteProposal, proposer)
+	g.POST("/proposals/:id/schedule", nc.apiScheduleProposal, sender)
+	g.DELETE("/proposals/:id/schedule", nc.apiUnscheduleProposal, sender)
+	g.GET("/batches", nc.apiBatches, viewer)
+	g.POST("/batches", nc.apiCreateBatch, proposer)
+	g.GET("/batches/:id", nc.apiBatch, viewer)
+	g.POST("/batches/:id/send", nc.apiSendBatch, sender)
+	g.DELETE("/batches/:id", nc.apiDeleteBatch, proposer)
+}
+
+// apiInput decodes the bundle of the request, or the hex message if there is
+// no bundle
+func (nc *NetworkControl) apiInput(req *apiMessageRequest) (*authset.Message, error) {
+	if len(req.Bundle) > 0 {
+		return nc.decodeInput(req.Bundle)
+	}
+	return authset.DecodeHex(req.Message)
+}
+
+// apiBundle returns the message as a bundle
+func (nc *NetworkControl) apiBundle(c echo.Context) error {
+	req := new(apiMessageRequest)
+	if err := c.Bind(req); err != nil {
+		return apiFail(c, http.StatusBadRequest, err)
+	}
+
+	m, err := nc.apiInput(req)
+	if err != nil {
+		return apiFail(c, http.StatusBadRequest, err)
+	}
+
+	return c.JSON(http.StatusOK, authset.NewBundle(m, nc.profile.Network.String()))
+}
+
+func apiFail(c echo.Context, code int, err error) error {
+	return c.JSON(code, apiError{Error: err.Error()})
+}
+
+func toAPIMessage(m *authset.Message, auth []*factom.Authority, rule authset.QuorumRule) *apiMessage {
+	am := &apiMessage{
+		Message:     m.Hex(),
+		Type:        m.TypeName(),
+		ChainID:     m.ChainID,
+		Timestamp:   m.Timestamp.UnixNano() / int64(time.Millisecond),
+		Time:        m.Timestamp,
+		Payload:     hex.EncodeToString(m.Payload),
+		SigningHash: hex.EncodeToString(m.SigningHash),
+		Signatures:  make([]apiSignature, 0, len(m.Signatures)),
+	}
+
+	if kc := m.KeyChange; kc != nil {
+		am.KeyChange = &apiKeyChange{
+			Kind:     keyKindName(kc.Kind),
+			Key:      hex.EncodeToString(kc.Key),
+			Priority: int(kc.Priority),
+		}
+		if kc.Kind == authset.AnchorKey {
+			am.KeyChange.KeyType = strings.ToLower(kc.KeyTypeName())
+		}
+	} else {
+		am.ServerType = m.ServerType.String()
+	}
+
+	for _, s := range m.Signatures {
+		as := apiSignature{
+			PubKey:    hex.EncodeToString(s.PubKey),
+			Signature: hex.EncodeToString(s.Signature),
+			Valid:     s.Valid,
+		}
+		if a := authset.FindSigner(auth, s.PubKey); a != nil {
+			as.Authority = a.AuthorityChainID
+			as.Role = a.Status
+			as.Counts = s.Valid && rule.Counts(a)
+		}
+		am.Signatures = append(am.Signatures, as)
+	}
+	am.Signers, am.Required = rule.Tally(m, auth)
+	am.Quorum = rule.String()
+
+	return am
+}
+
+// replyMessage sends the decoded message with signers resolved against the
+// current authority set
+// apiSave stores the message as a proposal like the web interface does,
+// records the action and replies with the message
+func (nc *NetworkControl) apiSave(c echo.Context, m *authset.Message, r audit.Record) error {
+	r.Message = m.Hash()
+	if nc.store != nil {
+		if _, err := nc.store.Save(m); err != nil {
+			nc.record(c, r, err)
+			return apiFail(c, http.StatusInternalServerError, err)
+		}
+	}
+	nc.record(c, r, nil)
+	return nc.replyMessage(c, m)
+}
+
+func (nc *NetworkControl) replyMessage(c echo.Context, m *authset.Message) error {
+	auth, err := nc.ac.Get()
+	if err != nil {
+		return apiFail(c, http.StatusBadGateway, err)
+	}
+	return c.JSON(http.StatusOK, toAPIMessage(m, auth, nc.profile.Quorum))
+}
+
+func (nc *NetworkControl) apiNetwork(c echo.Context) error {
+	return c.JSON(http.StatusOK, apiNetwork{
+		Profile: nc.profile.Name,
+		Network: nc.profile.Network.String(),
+		Factomd: nc.profile.Factomd,
+		Quorum:  nc.profile.Quorum.String(),
+		Window:  int64(nc.profile.Window / time.Second),
+	})
+}
+
+// apiChallenge hands out a nonce for a login with a signing key
+func (nc *NetworkControl) apiChallenge(c echo.Context) error {
+	nonce := nc.sessions.challenge()
+	return c.JSON(http.StatusOK, apiChallenge{
+		Nonce:   nonce,
+		Data:    hex.EncodeToString(authset.LoginData(nonce)),
+		Expires: time.Now().Add(challengeTTL),
+	})
+}
+
+func (nc *NetworkControl) apiLogin(c echo.Context) error {
+	req := new(apiLoginRequest)
+	if err := c.Bind(req); err != nil {
+		return apiFail(c, http.StatusBadRequest, err)
+	}
+
+	u, err := nc.authenticate(req.User, req.Password, req.Nonce, req.Signature)
+	nc.record(c, audit.Record{Action: audit.Login, Actor: req.User}, err)
+	if err != nil {
+		return apiFail(c, http.StatusUnauthorized, err)
+	}
+
+	token, expires := nc.sessions.create(u)
+	return c.JSON(http.StatusOK, apiLogin{Token: token, User: u.Name, Role: u.Role.String(), Chain: u.Chain, Expires: expires})
+}
+
+func (nc *NetworkControl) apiLogout(c echo.Context) error {
+	nc.recordLogout(c)
+	nc.sessions.remove(sessionToken(c))
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (nc *NetworkControl) apiAuthorities(c echo.Context) error {
+	auth, err := nc.ac.Get()
+	if err != nil {
+		return apiFail(c, http.StatusBadGateway, err)
+	}
+	return c.JSON(http.StatusOK, auth)
+}
+
+func (nc *NetworkControl) apiIdentity(c echo.Context) error {
+	chain := strings.ToLower(c.Param("chainid"))
+	if b, err := hex.DecodeString(chain); err != nil || len(b) != 32 {
+		return apiFail(c, http.StatusBadRequest, fmt.Errorf("invalid chain id %q", c.Param("chainid")))
+	}
+
+	id, err := nc.identities.Resolve(chain)
+	if err != nil {
+		return apiFail(c, http.StatusBadGateway, err)
+	}
+	a, err := nc.ac.GetSpecific(chain)
+	if err != nil {
+		return apiFail(c, http.StatusBadGateway, err)
+	}
+	return c.JSON(http.StatusOK, toAPIIdentity(id, nc.operators[chain], a))
+}
+
+func toAPIIdentity(id *identity.Identity, op *Operator, a *factom.Authority) *apiIdentity {
+	res := &apiIdentity{
+		ChainID:         id.ChainID,
+		Created:         id.Created,
+		Keys:            id.Keys,
+		ManagementChain: id.ManagementChain,
+		Registered:      id.Registered,
+		SigningKeys:     []apiKeyEntry{},
+		AnchorKeys:      []apiKeyEntry{},
+		Efficiency:      id.Efficiency,
+		Coinbase:        id.Coinbase,
+		Complete:        id.Complete(),
+		Warnings:        identityWarnings(id, a),
+		Problems:        id.Problems,
+	}
+	if op != nil {
+		res.Operator = op.Name
+		res.Link = op.Link
+	}
+	for _, k := range id.SigningKeys {
+		res.SigningKeys = append(res.SigningKeys, apiKeyEntry{Key: k.Key, Height: k.Height, Time: k.Time})
+	}
+	for _, k := range id.AnchorKeys {
+		priority := k.Priority
+		res.AnchorKeys = append(res.AnchorKeys, apiKeyEntry{Key: k.Key, Height: k.Height, Time: k.Time, Priority: &priority, Type: k.Type})
+	}
+	if k := id.MatryoshkaHash; k != nil {
+		res.MatryoshkaHash = &apiKeyEntry{Key: k.Key, Height: k.Height, Time: k.Time}
+	}
+	return res
+}
+
+func (nc *NetworkControl) apiCreate(c echo.Context) error {
+	req := new(apiCreateRequest)
+	if err := c.Bind(req); err != nil {
+		return apiFail(c, http.StatusBadRequest, err)
+	}
+
+	ts := time.Now()
+	if req.Timestamp != 0 {
+		ts = time.Unix(0, req.Timestamp*int64(time.Millisecond))
+	}
+
+	var m *authset.Message
+	switch req.Type {
+	case "add", "remove":
+		st, err := authset.ParseServerType(req.ServerType)
+		if err != nil {
+			return apiFail(c, http.StatusBadRequest, err)
+		}
+		if req.Type == "add" {
+			m, err = authset.BuildAddServer(req.ChainID, st, ts)
+		} else {
+			m, err = authset.BuildRemoveServer(req.ChainID, st, ts)
+		}
+		if err != nil {
+			return apiFail(c, http.StatusBadRequest, err)
+		}
+	case "key":
+		if req.KeyChange == nil {
+			return apiFail(c, http.StatusBadRequest, errors.New("keychange is required"))
+		}
+		kc, err := authset.ParseKeyChange(req.KeyChange.Kind, req.KeyChange.Key, req.KeyChange.Priority, req.KeyChange.KeyType)
+		if err != nil {
+			return apiFail(c, http.StatusBadRequest, err)
+		}
+		m, err = authset.BuildChangeKey(req.ChainID, kc, ts)
+		if err != nil {
+			return apiFail(c, http.StatusBadRequest, err)
+		}
+	default:
+		return apiFail(c, http.StatusBadRequest, fmt.Errorf("invalid message type: %s", req.Type))
+	}
+
+	nc.record(c, audit.Record{Action: audit.Create, Message: m.Hash()}, nil)
+	return nc.replyMessage(c, m)
+}
+
+func (nc *NetworkControl) apiDecode(c echo.Context) error {
+	req := new(apiMessageRequest)
+	if err := c.Bind(req); err != nil {
+		return apiFail(c, http.StatusBadRequest, err)
+	}
+
+	m, err := nc.apiInput(req)
+	if err != nil {
+		return apiFail(c, http.StatusBadRequest, err)
+	}
+
+	return nc.replyMessage(c, m)
+}
+
+func (nc *NetworkControl) apiSign(c echo.Context) error {
+	req := new(apiSignRequest)
+	if err := c.Bind(req); err != nil {
+		return apiFail(c, http.StatusBadRequest, err)
+	}
+
+	m, err := nc.apiInput(&req.apiMessageRequest)
+	if err != nil {
+		return apiFail(c, http.StatusBadRequest, err)
+	}
+
+	pubkey, err := hex.DecodeString(req.PubKey)
+	if err != nil {
+		return apiFail(c, http.StatusBadRequest, err)
+	}
+
+	sig, err := hex.DecodeString(req.Signature)
+	if err != nil {
+		return apiFail(c, http.StatusBadRequest, err)
+	}
+
+	r := audit.Record{Action: audit.Sign, Message: m.Hash(), Signer: hex.EncodeToString(pubkey)}
+	if err := nc.checkSigner(c, pubkey); err != nil {
+		nc.record(c, r, err)
+		return apiFail(c, http.StatusForbidden, err)
+	}
+
+	signed, err := authset.AddSignature(m, pubkey, sig)
+	if err != nil {
+		nc.record(c, r, err)
+		return apiFail(c, http.StatusBadRequest, err)
+	}
+
+	return nc.apiSave(c, signed, r)
+}
+
+func (nc *NetworkControl) apiSignKey(c echo.Context) error {
+	if nc.key == nil {
+		return apiFail(c, http.StatusBadRequest, errors.New("no signing key loaded"))
+	}
+
+	req := new(apiMessageRequest)
+	if err := c.Bind(req); err != nil {
+		return apiFail(c, http.StatusBadRequest, err)
+	}
+
+	m, err := nc.apiInput(req)
+	if err != nil {
+		return apiFail(c, http.StatusBadRequest, err)
+	}
+
+	r := audit.Record{Action: audit.Sign, Message: m.Hash(), Signer: nc.key.Pub.String()}
+	if err := nc.checkSigner(c, nc.key.Pub[:]); err != nil {
+		nc.record(c, r, err)
+		return apiFail(c, http.StatusForbidden, err)
+	}
+
+	auth, err := nc.ac.Get()
+	if err != nil {
+		return apiFail(c, http.StatusBadGateway, err)
+	}
+
+	signed, _, err := authset.SignAsAuthority(m, nc.key, auth)
+	if err != nil {
+		nc.record(c, r, err)
+		return apiFail(c, http.StatusBadRequest, err)
+	}
+
+	return nc.apiSave(c, signed, r)
+}
+
+func (nc *NetworkControl) apiMerge(c echo.Context) error {
+	req := new(apiMergeRequest)
+	if err := c.Bind(req); err != nil {
+		return apiFail(c, http.StatusBadRequest, err)
+	}
+
+	a, err := nc.apiInput(&req.apiMessageRequest)
+	if err != nil {
+		return apiFail(c, http.StatusBadRequest, err)
+	}
+
+	b, err := nc.apiInput(&apiMessageRequest{Message: req.Other, Bundle: req.OtherBundle})
+	if err != nil {
+		return apiFail(c, http.StatusBadRequest, err)
+	}
+
+	r := audit.Record{Action: audit.Merge, Message: a.Hash()}
+	merged, err := authset.MergeSignatures(a, b)
+	if err != nil {
+		nc.record(c, r, err)
+		return apiFail(c, http.StatusBadRequest, err)
+	}
+	if err := nc.checkMerge(c, a, merged); err != nil {
+		nc.record(c, r, err)
+		return apiFail(c, http.StatusForbidden, err)
+	}
+
+	return nc.apiSave(c, merged, r)
+}
+
+func (nc *NetworkControl) apiCheck(c echo.Context) error {
+	req := new(apiMessageRequest)
+	if err := c.Bind(req); err != nil {
+		return apiFail(c, http.StatusBadRequest, err)
+	}
+
+	m, err := nc.apiInput(req)
+	if err != nil {
+		return apiFail(c, http.StatusBadRequest, err)
+	}
+
+	auth, err := nc.ac.Get()
+	if err != nil {
+		return apiFail(c, http.StatusBadGateway, err)
+	}
+
+	report := nc.validate(m, auth, time.Now())
+	return c.JSON(http.StatusOK, toAPIReport(m, report, nc.profile.Quorum))
+}
+
+// toAPIReport converts the report, resolving signers against the authority
+// set the message was checked against
+func toAPIReport(m *authset.Message, report *authset.Report, rule authset.QuorumRule) *apiReport {
+	return &apiReport{
+		Info:     append([]string{}, report.Info...),
+		Errors:   append([]string{}, report.Errors...),
+		Signers:  report.Signers,
+		Required: report.Required,
+		OK:       report.OK(),
+		Message:  toAPIMessage(m, report.Simulation.Before, rule),
+
+		Simulation: toAPISimulation(report.Simulation),
+	}
+}
+
+func toAPISimulation(sim *authset.Simulation) *apiSimulation {
+	faultsBefore, faultsAfter := sim.Faults()
+	return &apiSimulation{
+		FedBefore:      sim.FedBefore,
+		FedAfter:       sim.FedAfter,
+		AuditBefore:    sim.AuditBefore,
+		AuditAfter:     sim.AuditAfter,
+		RequiredBefore: sim.RequiredBefore,
+		RequiredAfter:  sim.RequiredAfter,
+		FaultsBefore:   faultsBefore,
+		FaultsAfter:    faultsAfter,
+		Warnings:       append([]string{}, sim.Warnings...),
+		Authorities:    append([]*factom.Authority{}, sim.After...),
+	}
+}
+
+func (nc *NetworkControl) apiSend(c echo.Context) error {
+	req := new(apiMessageRequest)
+	if err := c.Bind(req); err != nil {
+		return apiFail(c, http.StatusBadRequest, err)
+	}
+
+	m, err := nc.apiInput(req)
+	if err != nil {
+		return apiFail(c, http.StatusBadRequest, err)
+	}
+
+	resp, p, err := nc.sendMessage(m)
+	nc.record(c, audit.Record{Action: audit.Send, Message: m.Hash()}, err)
+	if err != nil {
+		return apiFail(c, http.StatusBadGateway, err)
+	}
+
+	res := apiSendResponse{Message: m.Hex(), Response: resp}
+	if p != nil {
+		res.Proposal = p.ID
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+func toAPIProposal(p *proposal.Proposal, auth []*factom.Authority, rule authset.QuorumRule) (*apiProposal, error) {
+	m, err := p.Decode()
+	if err != nil {
+		return nil, err
+	}
+	status := string(p.Status)
+	if p.Status == proposal.StatusDraft {
+		status = "draft"
+	}
+	ap := &apiProposal{
+		ID:            p.ID,
+		Created:       p.Created,
+		Updated:       p.Updated,
+		Status:        status,
+		AppliedHeight: p.AppliedHeight,
+		Message:       toAPIMessage(m, auth, rule),
+	}
+	if s := p.Schedule; s != nil {
+		ap.Schedule = &apiSchedule{Height: s.Height, Cancelled: s.Cancelled}
+		if !s.At.IsZero() {
+			ap.Schedule.At = s.At.UnixNano() / int64(time.Millisecond)
+		}
+	}
+	return ap, nil
+}
+
+func (nc *NetworkControl) apiProposals(c echo.Context) error {
+	if nc.store == nil {
+		return apiFail(c, http.StatusNotFound, proposal.ErrNotFound)
+	}
+
+	auth, err := nc.ac.Get()
+	if err != nil {
+		return apiFail(c, http.StatusBadGateway, err)
+	}
+
+	list, err := nc.store.List()
+	if err != nil {
+		return apiFail(c, http.StatusInternalServerError, err)
+	}
+
+	res := make([]*apiProposal, 0, len(list))
+	for _, p := range list {
+		ap, err := toAPIProposal(p, auth, nc.profile.Quorum)
+		if err != nil {
+			return apiFail(c, http.StatusInternalServerError, err)
+		}
+		res = append(res, ap)
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+// apiSaveProposal creates a new proposal or adds the message's signatures
+// to the existing proposal for the same message
+func (nc *NetworkControl) apiSaveProposal(c echo.Context) error {
+	if nc.store == nil {
+		return apiFail(c, http.StatusNotFound, proposal.ErrNotFound)
+	}
+
+	req := new(apiMessageRequest)
+	if err := c.Bind(req); err != nil {
+		return apiFail(c, http.StatusBadRequest, err)
+	}
+
+	m, err := nc.apiInput(req)
+	if err != nil {
+		return apiFail(c, http.StatusBadRequest, err)
+	}
+
+	p, err := nc.store.Save(m)
+	nc.record(c, audit.Record{Action: audit.Import, Message: m.Hash()}, err)
+	if err != nil {
+		return apiFail(c, http.StatusInternalServerError, err)
+	}
+
+	return nc.replyProposal(c, p)
+}
+
+func (nc *NetworkControl) apiProposal(c echo.Context) error {
+	if nc.store == nil {
+		return apiFail(c, http.StatusNotFound, proposal.ErrNotFound)
+	}
+
+	p, err := nc.store.Get(c.Param("id"))
+	if err == proposal.ErrNotFound {
+		return apiFail(c, http.StatusNotFound, err)
+	} else if err != nil {
+		return apiFail(c, http.StatusInternalServerError, err)
+	}
+
+	return nc.replyProposal(c, p)
+}
+
+// apiCoverage lists the signature state of every authority for the proposal
+// with the same role filter and sort order as the coverage page
+func (nc *NetworkControl) apiCoverage(c echo.Context) error {
+	p, m, err := nc.loadProposal(c.Param("id"))
+	if err == proposal.ErrNotFound {
+		return apiFail(c, http.StatusNotFound, err)
+	} else if err != nil {
+		return apiFail(c, http.StatusInternalServerError, err)
+	}
+	auth, err := nc.ac.Get()
+	if err != nil {
+		return apiFail(c, http.StatusBadGateway, err)
+	}
+
+	v, err := nc.newCoverageView(p.ID, m, auth, c.QueryParam("role"), c.QueryParam("sort"))
+	if err != nil {
+		return apiFail(c, http.StatusBadRequest, err)
+	}
+
+	ac := &apiCoverage{
+		ID:       v.ID,
+		Quorum:   v.Rule,
+		Signers:  v.Signers,
+		Required: v.Required,
+		Needed:   v.Needed,
+		Closes:   v.Closes,
+		Left:     int64(v.Left / time.Second),
+		Rows:     []apiCoverageRow{},
+	}
+	if v.Closed {
+		ac.Left = -ac.Left
+	}
+	for _, r := range v.Rows {
+		row := apiCoverageRow{Authority: r.Authority, Role: r.Role, PubKey: r.PubKey, State: r.State, Counts: r.Counts}
+		if r.Operator != nil {
+			row.Operator = r.Operator.Name
+		}
+		ac.Rows = append(ac.Rows, row)
+	}
+	return c.JSON(http.StatusOK, ac)
+}
+
+func (nc *NetworkControl) apiDeleteProposal(c echo.Context) error {
+	if nc.store == nil {
+		return apiFail(c, http.StatusNotFound, proposal.ErrNotFound)
+	}
+
+	err := nc.store.Delete(c.Param("id"))
+	nc.record(c, audit.Record{Action: audit.Delete, Message: c.Param("id")}, err)
+	if err == proposal.ErrNotFound {
+		return apiFail(c, http.StatusNotFound, err)
+	} else if err == proposal.ErrInBatch {
+		return apiFail(c, http.StatusConflict, err)
+	} else if err != nil {
+		return apiFail(c, http.StatusInternalServerError, err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// replyProposal writes the proposal with the current authority set
+func (nc *NetworkControl) replyProposal(c echo.Context, p *proposal.Proposal) error {
+	auth, err := nc.ac.Get()
+	if err != nil {
+		return apiFail(c, http.StatusBadGateway, err)
+	}
+
+	ap, err := toAPIProposal(p, auth, nc.profile.Quorum)
+	if err != nil {
+		return apiFail(c, http.StatusInternalServerError, err)
+	}
+	return c.JSON(http.StatusOK, ap)
+}
+
+// apiScheduleProposal sets the proposal to be sent automatically once the
+// time and height of the request are reached
+func (nc *NetworkControl) apiScheduleProposal(c echo.Context) error {
+	if nc.store == nil {
+		return apiFail(c, http.StatusNotFound, proposal.ErrNotFound)
+	}
+
+	req := new(apiSchedule)
+	if err := c.Bind(req); err != nil {
+		return apiFail(c, http.StatusBadRequest, err)
+	}
+
+	var at time.Time
+	if req.At > 0 {
+		at = time.Unix(0, req.At*int64(time.Millisecond))
+	}
+
+	p, err := nc.schedule(c.Param("id"), at, req.Height)
+	nc.record(c, audit.Record{Action: audit.Schedule, Message: c.Param("id")}, err)
+	if err == proposal.ErrNotFound {
+		return apiFail(c, http.StatusNotFound, err)
+	} else if err != nil {
+		return apiFail(c, http.StatusBadRequest, err)
+	}
+
+	return nc.replyProposal(c, p)
+}
+
+func (nc *NetworkControl) apiUnscheduleProposal(c echo.Context) error {
+	if nc.store == nil {
+		return apiFail(c, http.StatusNotFound, proposal.ErrNotFound)
+	}
+
+	p, err := nc.tracker.Unschedule(c.Param("id"))
+	nc.record(c, audit.Record{Action: audit.Unschedule, Message: c.Param("id")}, err)
+	if err == proposal.ErrNotFound {
+		return apiFail(c, http.StatusNotFound, err)
+	} else if err != nil {
+		return apiFail(c, http.StatusInternalServerError, err)
+	}
+
+	return nc.replyProposal(c, p)
+}
+
+// keyKindName is the name of the key kind as accepted by ParseKeyKind
+func keyKindName(k authset.KeyKind) string {
+	switch k {
+	case authset.AnchorKey:
+		return "anchor"
+	case authset.MatryoshkaHash:
+		return "matryoshka"
+	}
+	return "signing"
+}
+
+// toAPIBatch converts the batch and checks the messages that were not
+// applied yet
+func (nc *NetworkControl) toAPIBatch(b *proposal.Batch, auth []*factom.Authority) (*apiBatch, error) {
+	props, msgs, err := nc.store.Members(b)
+	if err != nil {
+		return nil, err
+	}
+
+	status := string(b.Status)
+	if b.Status == proposal.BatchDraft {
+		status = "draft"
+	}
+
+	ab := &apiBatch{
+		ID:        b.ID,
+		Created:   b.Created,
+		Updated:   b.Updated,
+		Status:    status,
+		Next:      b.Next,
+		Error:     b.Error,
+		Proposals: make([]*apiProposal, 0, len(props)),
+		Steps:     make([]*apiReport, 0, len(msgs)),
+	}
+	for _, p := range props {
+		ap, err := toAPIProposal(p, auth, nc.profile.Quorum)
+		if err != nil {
+			return nil, err
+		}
+		ab.Proposals = append(ab.Proposals, ap)
+	}
+
+	first := 0
+	if b.Status == proposal.BatchSending {
+		first = b.Next
+	}
+	report := nc.validateBatch(msgs[first:], auth, time.Now())
+	for i, m := range report.Order {
+		ab.Steps = append(ab.Steps, toAPIReport(m, report.Reports[i], nc.profile.Quorum))
+	}
+	ab.Errors = append([]string{}, report.Errors...)
+	ab.OK = report.OK()
+	ab.Simulation = toAPISimulation(report.Simulation)
+	return ab, nil
+}
+
+// replyBatch sends the batch with its checks against the current authority set
+func (nc *NetworkControl) replyBatch(c echo.Context, b *proposal.Batch) error {
+	auth, err := nc.ac.Get()
+	if err != nil {
+		return apiFail(c, http.StatusBadGateway, err)
+	}
+
+	ab, err := nc.toAPIBatch(b, auth)
+	if err != nil {
+		return apiFail(c, http.StatusInternalServerError, err)
+	}
+	return c.JSON(http.StatusOK, ab)
+}
+
+func (nc *NetworkControl) apiBatches(c echo.Context) error {
+	if nc.store == nil {
+		return apiFail(c, http.StatusNotFound, proposal.ErrBatchNotFound)
+	}
+
+	auth, err := nc.ac.Get()
+	if err != nil {
+		return apiFail(c, http.StatusBadGateway, err)
+	}
+
+	list, err := nc.store.Batches()
+	if err != nil {
+		return apiFail(c, http.StatusInternalServerError, err)
+	}
+
+	res := make([]*apiBatch, 0, len(list))
+	for _, b := range list {
+		ab, err := nc.toAPIBatch(b, auth)
+		if err != nil {
+			return apiFail(c, http.StatusInternalServerError, err)
+		}
+		res = append(res, ab)
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+// apiCreateBatch stores the messages as proposals and bundles them into a
+// batch in send order
+func (nc *NetworkControl) apiCreateBatch(c echo.Context) error {
+	if nc.store == nil {
+		return apiFail(c, http.StatusNotFound, proposal.ErrBatchNotFound)
+	}
+
+	req := new(apiBatchRequest)
+	if err := c.Bind(req); err != nil {
+		return apiFail(c, http.StatusBadRequest, err)
+	}
+
+	var msgs []*authset.Message
+	for _, msg := range req.Messages {
+		m, err := authset.DecodeHex(msg)
+		if err != nil {
+			return apiFail(c, http.StatusBadRequest, err)
+		}
+		msgs = append(msgs, m)
+	}
+
+	auth, err := nc.ac.Get()
+	if err != nil {
+		return apiFail(c, http.StatusBadGateway, err)
+	}
+
+	b, err := nc.saveBatch(c, msgs, auth)
+	if err == proposal.ErrEmptyBatch {
+		return apiFail(c, http.StatusBadRequest, err)
+	} else if err != nil {
+		return apiFail(c, http.StatusInternalServerError, err)
+	}
+
+	return nc.replyBatch(c, b)
+}
+
+func (nc *NetworkControl) apiBatch(c echo.Context) error {
+	if nc.store == nil {
+		return apiFail(c, http.StatusNotFound, proposal.ErrBatchNotFound)
+	}
+
+	b, err := nc.store.GetBatch(c.Param("id"))
+	if err == proposal.ErrBatchNotFound {
+		return apiFail(c, http.StatusNotFound, err)
+	} else if err != nil {
+		return apiFail(c, http.StatusInternalServerError, err)
+	}
+
+	return nc.replyBatch(c, b)
+}
+
+// apiSendBatch starts sending the batch. The messages are sent one at a time
+// as the previous one is applied.
+func (nc *NetworkControl) apiSendBatch(c echo.Context) error {
+	if nc.store == nil {
+		return apiFail(c, http.StatusNotFound, proposal.ErrBatchNotFound)
+	}
+
+	b, err := nc.startBatch(c, c.Param("id"))
+	nc.record(c, audit.Record{Action: audit.BatchSend, Batch: c.Param("id")}, err)
+	if err == proposal.ErrBatchNotFound {
+		return apiFail(c, http.StatusNotFound, err)
+	} else if err != nil {
+		return apiFail(c, http.StatusBadRequest, err)
+	}
+
+	return nc.replyBatch(c, b)
+}
+
+func (nc *NetworkControl) apiDeleteBatch(c echo.Context) error {
+	if nc.store == nil {
+		return apiFail(c, http.StatusNotFound, proposal.ErrBatchNotFound)
+	}
+
+	err := nc.store.DeleteBatch(c.Param("id"))
+	nc.record(c, audit.Record{Action: audit.BatchDelete, Batch: c.Param("id")}, err)
+	if err == proposal.ErrBatchNotFound {
+		return apiFail(c, http.StatusNotFound, err)
+	} else if err != nil {
+		return apiFail(c, http.StatusInternalServerError, err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,261 @@
+package networkcontrol
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/FactomProject/factom"
+	"github.com/FactomProject/factomd/common/primitives"
+	"github.com/WhoSoup/factom-networkcontrol/authset"
+	"github.com/WhoSoup/factom-networkcontrol/identity"
+	"github.com/WhoSoup/factom-networkcontrol/proposal"
+	"github.com/labstack/echo/v4"
+)
+
+// testKey returns a deterministic private key
+func testKey(i int) *primitives.PrivateKey {
+	seed := make([]byte, 32)
+	seed[0] = byte(i + 1)
+	return primitives.NewPrivateKeyFromHexBytes(seed)
+}
+
+func testChain(i int) string {
+	return strings.Repeat("0", 62) + hex.EncodeToString([]byte{byte(i)})
+}
+
+// testAuthorities are three federated and two audit servers that sign with
+// testKey(0) to testKey(4)
+func testAuthorities() authset.StaticSource {
+	var auth authset.StaticSource
+	for i := 0; i < 5; i++ {
+		status := "federated"
+		if i >= 3 {
+			status = "audit"
+		}
+		auth = append(auth, &factom.Authority{
+			AuthorityChainID: testChain(i),
+			SigningKey:       testKey(i).Pub.String(),
+			Status:           status,
+		})
+	}
+	return auth
+}
+
+// noIdentities is an identity source without any chains
+type noIdentities struct{}
+
+func (noIdentities) Entries(chainID string) ([]identity.Entry, error) {
+	return nil, nil
+}
+
+func openStore(t *testing.T) *proposal.Store {
+	t.Helper()
+	s, err := proposal.Open(filepath.Join(t.TempDir(), "proposals.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// testServer creates a control panel for the test authorities with the
+// given settings
+func testServer(t *testing.T, cfg Config) *echo.Echo {
+	t.Helper()
+	cfg.Authorities = testAuthorities()
+	cfg.Identities = noIdentities{}
+	cfg.CacheInterval = time.Hour
+	cfg.IdentityInterval = time.Hour
+	return CreateServer(cfg)
+}
+
+func testMessage(t *testing.T) *authset.Message {
+	t.Helper()
+	m, err := authset.BuildAddServer(testChain(9), authset.Federated, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// apiCall sends the request body as JSON and decodes the response into v
+func apiCall(t *testing.T, e *echo.Echo, method, path string, body, v interface{}) int {
+	t.Helper()
+	return apiCallAs(t, e, "", method, path, body, v)
+}
+
+// apiCallAs is apiCall with the token of a session
+func apiCallAs(t *testing.T, e *echo.Echo, token, method, path string, body, v interface{}) int {
+	t.Helper()
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(method, path, bytes.NewReader(data))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	if token != "" {
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if v != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+			t.Fatalf("%s %s: %v: %s", method, path, err, rec.Body)
+		}
+	}
+	return rec.Code
+}
+
+func TestAPISign(t *testing.T) {
+	store := openStore(t)
+	e := testServer(t, Config{Store: store})
+	m := testMessage(t)
+
+	var reply apiMessage
+	code := apiCall(t, e, http.MethodPost, "/api/v1/sign", map[string]string{
+		"message":   m.Hex(),
+		"pubkey":    testKey(0).Pub.String(),
+		"signature": hex.EncodeToString(testKey(0).Sign(m.SigningHash).Bytes()),
+	}, &reply)
+	if code != http.StatusOK {
+		t.Fatalf("status = %d", code)
+	}
+	if len(reply.Signatures) != 1 || !reply.Signatures[0].Valid {
+		t.Fatalf("signatures = %+v", reply.Signatures)
+	}
+
+	p, err := store.Get(m.Hash())
+	if err != nil {
+		t.Fatalf("the signed message was not stored: %v", err)
+	}
+	if stored, err := p.Decode(); err != nil || len(stored.Signatures) != 1 {
+		t.Errorf("stored message = %v, %v, want 1 signature", stored, err)
+	}
+
+	var fail apiError
+	code = apiCall(t, e, http.MethodPost, "/api/v1/sign", map[string]string{
+		"message":   m.Hex(),
+		"pubkey":    testKey(0).Pub.String(),
+		"signature": hex.EncodeToString(testKey(1).Sign(m.SigningHash).Bytes()),
+	}, &fail)
+	if code != http.StatusBadRequest || fail.Error == "" {
+		t.Errorf("wrong signature: status = %d, error = %q", code, fail.Error)
+	}
+}
+
+func TestAPIMerge(t *testing.T) {
+	store := openStore(t)
+	e := testServer(t, Config{Store: store})
+	m := testMessage(t)
+
+	a, err := authset.Sign(m, testKey(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := authset.Sign(m, testKey(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var reply apiMessage
+	code := apiCall(t, e, http.MethodPost, "/api/v1/merge", map[string]interface{}{
+		"message":     a.Hex(),
+		"otherbundle": authset.NewBundle(b, DefaultProfiles()["mainnet"].Network.String()),
+	}, &reply)
+	if code != http.StatusOK {
+		t.Fatalf("status = %d", code)
+	}
+	if reply.Signers != 2 {
+		t.Errorf("signers = %d, want 2", reply.Signers)
+	}
+
+	p, err := store.Get(m.Hash())
+	if err != nil {
+		t.Fatalf("the merged message was not stored: %v", err)
+	}
+	if stored, err := p.Decode(); err != nil || len(stored.Signatures) != 2 {
+		t.Errorf("stored message = %v, %v, want 2 signatures", stored, err)
+	}
+
+	var fail apiError
+	code = apiCall(t, e, http.MethodPost, "/api/v1/merge", map[string]interface{}{
+		"message":     a.Hex(),
+		"otherbundle": authset.NewBundle(b, "test"),
+	}, &fail)
+	if code != http.StatusBadRequest {
+		t.Errorf("bundle of another network: status = %d, error = %q", code, fail.Error)
+	}
+}
+
+func TestRequireJSON(t *testing.T) {
+	e := testServer(t, Config{})
+	m := testMessage(t)
+	body := `{"message": "` + m.Hex() + `"}`
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		contentType string
+		bearer      bool
+		want        int
+	}{
+		{"json", http.MethodPost, "/api/v1/decode", echo.MIMEApplicationJSON, false, http.StatusOK},
+		{"json with charset", http.MethodPost, "/api/v1/decode", echo.MIMEApplicationJSONCharsetUTF8, false, http.StatusOK},
+		{"form", http.MethodPost, "/api/v1/decode", echo.MIMEApplicationForm, false, http.StatusUnsupportedMediaType},
+		{"plain text", http.MethodPost, "/api/v1/decode", echo.MIMETextPlain, false, http.StatusUnsupportedMediaType},
+		{"no body", http.MethodPost, "/api/v1/logout", "", false, http.StatusUnsupportedMediaType},
+		{"no body with json", http.MethodPost, "/api/v1/logout", echo.MIMEApplicationJSON, false, http.StatusNoContent},
+		{"bearer token", http.MethodPost, "/api/v1/logout", "", true, http.StatusNoContent},
+		{"get", http.MethodGet, "/api/v1/network", "", false, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r io.Reader
+			if tt.path == "/api/v1/decode" {
+				r = strings.NewReader(body)
+			}
+			req := httptest.NewRequest(tt.method, tt.path, r)
+			if tt.contentType != "" {
+				req.Header.Set(echo.HeaderContentType, tt.contentType)
+			}
+			if tt.bearer {
+				req.Header.Set(echo.HeaderAuthorization, "Bearer token")
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
+
+func TestAPIDeleteBatchMember(t *testing.T) {
+	store := openStore(t)
+	e := testServer(t, Config{Store: store})
+	msgs := testMessages(t, 2)
+	b, err := store.SaveBatch(msgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fail apiError
+	if code := apiCall(t, e, http.MethodDelete, "/api/v1/proposals/"+b.Proposals[0], nil, &fail); code != http.StatusConflict {
+		t.Errorf("deleting a batch member: status = %d, error = %q", code, fail.Error)
+	}
+	if code := apiCall(t, e, http.MethodDelete, "/api/v1/batches/"+b.ID, nil, nil); code != http.StatusNoContent {
+		t.Fatalf("deleting the batch: status = %d", code)
+	}
+	if code := apiCall(t, e, http.MethodDelete, "/api/v1/proposals/"+b.Proposals[0], nil, nil); code != http.StatusNoContent {
+		t.Errorf("deleting a former batch member: status = %d", code)
+	}
+}
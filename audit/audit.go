@@ -0,0 +1,224 @@
+// Package audit keeps an append-only log of the actions taken in the control
+// panel. Every record carries the hash of the record before it, so removing,
+// reordering or editing a record breaks the chain from that point on.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Actions that are recorded
+const (
+	Login       = "login"
+	Logout      = "logout"
+	Create      = "create"
+	Import      = "import"
+	Sign        = "sign"
+	Merge       = "merge"
+	Send        = "send"
+	Schedule    = "schedule"
+	Unschedule  = "unschedule"
+	Delete      = "delete"
+	BatchCreate = "batch-create"
+	BatchSign   = "batch-sign"
+	BatchSend   = "batch-send"
+	BatchDelete = "batch-delete"
+
+	// changes the server makes on its own
+	Applied        = "applied"
+	Expired        = "expired"
+	ScheduleCancel = "schedule-cancel"
+	BatchFail      = "batch-fail"
+)
+
+// ResultOK is the result of actions that succeeded
+const ResultOK = "ok"
+
+// GenesisHash is the previous hash of the first record
+var GenesisHash = strings.Repeat("0", 64)
+
+// Record is an action in the log
+type Record struct {
+	Seq    uint64    `json:"seq"`
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`
+	// Actor is the account that did it, empty if there are no accounts, or
+	// "server" for messages the server sent on its own
+	Actor string `json:"actor,omitempty"`
+	IP    string `json:"ip,omitempty"`
+	// Message is the hash of the message, which is also the proposal id
+	Message string `json:"message,omitempty"`
+	Batch   string `json:"batch,omitempty"`
+	// Signer is the public key of the signature that was added
+	Signer string `json:"signer,omitempty"`
+	// Height is the block height a message was applied at
+	Height int64 `json:"height,omitempty"`
+	// Result is "ok" or the error of the action. Schedules the server
+	// cancels and batches it stops have the reason instead.
+	Result string `json:"result"`
+	// Prev is the hash of the record before and Hash the hash of this one
+	Prev string `json:"prev"`
+	Hash string `json:"hash"`
+}
+
+// ComputeHash returns the hex SHA-256 of the JSON encoding of the record
+// without its hash
+func (r Record) ComputeHash() string {
+	r.Hash = ""
+	data, err := json.Marshal(r)
+	if err != nil {
+		panic(err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Log is an audit log in a JSON lines file. It is safe for concurrent use.
+type Log struct {
+	mtx  sync.Mutex
+	path string
+	f    *os.File
+	seq  uint64
+	head string
+}
+
+// Open opens or creates the log at the given path. The existing records are
+// verified first, so nothing is appended to a broken chain.
+func Open(path string) (*Log, error) {
+	l := &Log{path: path, head: GenesisHash}
+
+	if f, err := os.Open(path); err == nil {
+		n, head, err := Verify(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("audit log %s: %v", path, err)
+		}
+		l.seq, l.head = uint64(n), head
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	l.f = f
+	return l, nil
+}
+
+// Close closes the file
+func (l *Log) Close() error {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return l.f.Close()
+}
+
+// Append adds the record to the end of the log. The sequence number, time and
+// hashes are set by the log.
+func (l *Log) Append(r Record) (*Record, error) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	r.Seq = l.seq + 1
+	r.Time = time.Now().UTC()
+	r.Prev = l.head
+	r.Hash = r.ComputeHash()
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := l.f.Write(append(data, '\n')); err != nil {
+		return nil, err
+	}
+	if err := l.f.Sync(); err != nil {
+		return nil, err
+	}
+	l.seq, l.head = r.Seq, r.Hash
+	return &r, nil
+}
+
+// Head returns the number of records and the hash of the last one. Keeping
+// the head hash somewhere else makes it possible to tell if records were cut
+// off the end.
+func (l *Log) Head() (uint64, string) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return l.seq, l.head
+}
+
+// Export writes the log as JSON lines
+func (l *Log) Export(w io.Writer) error {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	f, err := os.Open(l.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// Records returns all records of the log, oldest first
+func (l *Log) Records() ([]Record, error) {
+	var buf bytes.Buffer
+	if err := l.Export(&buf); err != nil {
+		return nil, err
+	}
+	return Read(&buf)
+}
+
+// Read decodes JSON lines into records without verifying them
+func Read(r io.Reader) ([]Record, error) {
+	var list []Record
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; s.Scan(); line++ {
+		if len(bytes.TrimSpace(s.Bytes())) == 0 {
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal(s.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		list = append(list, rec)
+	}
+	return list, s.Err()
+}
+
+// Verify checks that every record has the next sequence number, links to the
+// hash of the record before it and that its hash matches its content. It
+// returns the number of records and the hash of the last one, or the first
+// record that is wrong. An empty log is valid.
+func Verify(r io.Reader) (int, string, error) {
+	list, err := Read(r)
+	if err != nil {
+		return 0, "", err
+	}
+
+	head := GenesisHash
+	for i, rec := range list {
+		switch {
+		case rec.Seq != uint64(i+1):
+			return i, head, fmt.Errorf("record %d has sequence number %d", i+1, rec.Seq)
+		case rec.Prev != head:
+			return i, head, fmt.Errorf("record %d does not follow the record before it, previous hash %s, expected %s", rec.Seq, rec.Prev, head)
+		case rec.ComputeHash() != rec.Hash:
+			return i, head, fmt.Errorf("record %d was modified, its hash is %s, the content hashes to %s", rec.Seq, rec.Hash, rec.ComputeHash())
+		}
+		head = rec.Hash
+	}
+	return len(list), head, nil
+}
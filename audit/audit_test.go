@@ -0,0 +1,182 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeLog appends the records to a new log and returns its path
+func writeLog(t *testing.T, recs ...Record) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	l, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range recs {
+		if _, err := l.Append(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func readLines(t *testing.T, path string) []string {
+	t.Helper()
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSpace(string(data)), "\n")
+}
+
+var testRecords = []Record{
+	{Action: Login, Actor: "alice", IP: "127.0.0.1", Result: ResultOK},
+	{Action: Create, Actor: "alice", Message: "ab01", Result: ResultOK},
+	{Action: Sign, Actor: "bob", Message: "ab01", Signer: "cd02", Result: ResultOK},
+	{Action: Send, Actor: "alice", Message: "ab01", Result: "the node is offline"},
+	{Action: Applied, Actor: "server", Message: "ab01", Height: 1000, Result: ResultOK},
+}
+
+func TestAppendVerify(t *testing.T) {
+	path := writeLog(t, testRecords...)
+
+	l, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	recs, err := l.Records()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != len(testRecords) {
+		t.Fatalf("%d records, want %d", len(recs), len(testRecords))
+	}
+	prev := GenesisHash
+	for i, r := range recs {
+		if r.Seq != uint64(i+1) || r.Prev != prev || r.Hash != r.ComputeHash() {
+			t.Errorf("record %d: seq %d, prev %s, hash %s", i+1, r.Seq, r.Prev, r.Hash)
+		}
+		if r.Action != testRecords[i].Action || r.Result != testRecords[i].Result || r.Height != testRecords[i].Height {
+			t.Errorf("record %d is %s at %d with %q, want %s at %d with %q", i+1, r.Action, r.Height, r.Result, testRecords[i].Action, testRecords[i].Height, testRecords[i].Result)
+		}
+		prev = r.Hash
+	}
+
+	// reopening continues the chain
+	n, head := l.Head()
+	if n != uint64(len(recs)) || head != prev {
+		t.Errorf("head is %d %s, want %d %s", n, head, len(recs), prev)
+	}
+	r, err := l.Append(Record{Action: Logout, Actor: "alice", Result: ResultOK})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Seq != n+1 || r.Prev != head {
+		t.Errorf("appended seq %d after %s, want %d after %s", r.Seq, r.Prev, n+1, head)
+	}
+
+	var buf bytes.Buffer
+	if err := l.Export(&buf); err != nil {
+		t.Fatal(err)
+	}
+	count, last, err := Verify(&buf)
+	if err != nil || count != len(testRecords)+1 || last != r.Hash {
+		t.Errorf("verify: %d records, head %s, %v", count, last, err)
+	}
+}
+
+func TestVerifyEmpty(t *testing.T) {
+	n, head, err := Verify(strings.NewReader(""))
+	if err != nil || n != 0 || head != GenesisHash {
+		t.Errorf("empty log: %d, %s, %v", n, head, err)
+	}
+}
+
+func TestVerifyTampered(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(lines []string) []string
+		// valid is the number of records before the broken one
+		valid int
+	}{
+		{"edited", func(lines []string) []string {
+			lines[1] = strings.Replace(lines[1], `"actor":"alice"`, `"actor":"mallory"`, 1)
+			return lines
+		}, 1},
+		{"edited and rehashed", func(lines []string) []string {
+			var r Record
+			if err := json.Unmarshal([]byte(lines[2]), &r); err != nil {
+				panic(err)
+			}
+			r.Signer = "ffff"
+			r.Hash = r.ComputeHash()
+			data, _ := json.Marshal(r)
+			lines[2] = string(data)
+			return lines
+		}, 3},
+		{"deleted", func(lines []string) []string {
+			return append(lines[:1], lines[2:]...)
+		}, 1},
+		{"reordered", func(lines []string) []string {
+			lines[1], lines[2] = lines[2], lines[1]
+			return lines
+		}, 1},
+		{"first removed", func(lines []string) []string {
+			return lines[1:]
+		}, 0},
+	}
+	for _, tt := range tests {
+		path := writeLog(t, testRecords...)
+		lines := tt.modify(readLines(t, path))
+		data := strings.Join(lines, "\n") + "\n"
+
+		n, _, err := Verify(strings.NewReader(data))
+		if err == nil {
+			t.Errorf("%s: the log verifies", tt.name)
+			continue
+		}
+		if n != tt.valid {
+			t.Errorf("%s: %d valid records, want %d: %v", tt.name, n, tt.valid, err)
+		}
+
+		if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if l, err := Open(path); err == nil {
+			l.Close()
+			t.Errorf("%s: a broken log is opened", tt.name)
+		}
+	}
+}
+
+func TestTruncatedHead(t *testing.T) {
+	path := writeLog(t, testRecords...)
+	l, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, head := l.Head()
+	l.Close()
+
+	// cutting records off the end keeps the chain intact, only the head
+	// hash shows it
+	lines := readLines(t, path)
+	data := strings.Join(lines[:len(lines)-1], "\n") + "\n"
+	n, last, err := Verify(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(testRecords)-1 || last == head {
+		t.Errorf("truncated log has %d records with head %s", n, last)
+	}
+}
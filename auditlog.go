@@ -0,0 +1,90 @@
+package networkcontrol
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/WhoSoup/factom-networkcontrol/audit"
+	"github.com/labstack/echo/v4"
+)
+
+var errNoAudit = errors.New("no audit log configured")
+
+// serverActor is the actor of actions the server takes on its own, like
+// sending scheduled proposals and the next message of a batch
+const serverActor = "server"
+
+// record adds the action to the audit log. err is the outcome of the action,
+// nil if it succeeded. The actor and client ip are taken from the request,
+// a nil context is an action of the server itself.
+func (nc *NetworkControl) record(c echo.Context, r audit.Record, err error) {
+	if nc.audit == nil {
+		return
+	}
+
+	r.Result = audit.ResultOK
+	if err != nil {
+		r.Result = err.Error()
+	}
+	if c == nil {
+		r.Actor = serverActor
+	} else {
+		r.IP = c.RealIP()
+		if u := currentUser(c); u != nil && r.Actor == "" {
+			r.Actor = u.Name
+		}
+	}
+
+	if _, err := nc.audit.Append(r); err != nil {
+		log.Printf("audit: unable to record %s of %s: %v", r.Action, r.Message, err)
+	}
+}
+
+// auditView is the data of the audit log page
+type auditView struct {
+	Enabled bool
+	// Message filters the records by message hash
+	Message string
+	Records []audit.Record
+	// Count and Head are the number of records and the hash of the last one
+	Count uint64
+	Head  string
+}
+
+// auditPage lists the records of the audit log, newest first
+func (nc *NetworkControl) auditPage(c echo.Context) error {
+	v := auditView{Enabled: nc.audit != nil, Message: strings.ToLower(strings.TrimSpace(c.QueryParam("message")))}
+	if nc.audit == nil {
+		return nc.render(c, http.StatusOK, "audit", v)
+	}
+
+	list, err := nc.audit.Records()
+	if err != nil {
+		return nc.printError(c, err)
+	}
+	for i := len(list) - 1; i >= 0; i-- {
+		if v.Message == "" || list[i].Message == v.Message {
+			v.Records = append(v.Records, list[i])
+		}
+	}
+	v.Count, v.Head = nc.audit.Head()
+	return nc.render(c, http.StatusOK, "audit", v)
+}
+
+// auditExport writes the whole audit log as JSON lines, the format
+// `authctl audit verify` reads
+func (nc *NetworkControl) auditExport(c echo.Context) error {
+	if nc.audit == nil {
+		if isAPI(c) {
+			return apiFail(c, http.StatusNotFound, errNoAudit)
+		}
+		return nc.printError(c, errNoAudit)
+	}
+
+	c.Response().Header().Set(echo.HeaderContentType, "application/x-ndjson")
+	c.Response().Header().Set(echo.HeaderContentDisposition, `attachment; filename="audit.jsonl"`)
+	c.Response().WriteHeader(http.StatusOK)
+	return nc.audit.Export(c.Response())
+}
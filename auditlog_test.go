@@ -0,0 +1,47 @@
+package networkcontrol
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/WhoSoup/factom-networkcontrol/audit"
+)
+
+func TestBatchSendActor(t *testing.T) {
+	log, err := audit.Open(filepath.Join(t.TempDir(), "audit.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { log.Close() })
+
+	store := openStore(t)
+	e := testServer(t, Config{Users: testUsers(t), Store: store, Audit: log})
+	sender := apiLoginAs(t, e, "sender")
+
+	b, err := store.SaveBatch(testMessages(t, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the messages are unsigned, so the first send fails its checks, which
+	// is recorded all the same
+	if code := apiCallAs(t, e, sender, http.MethodPost, "/api/v1/batches/"+b.ID+"/send", nil, nil); code != http.StatusOK {
+		t.Fatalf("status = %d", code)
+	}
+
+	records, err := log.Records()
+	if err != nil {
+		t.Fatal(err)
+	}
+	actors := make(map[string]string)
+	for _, r := range records {
+		actors[r.Action] = r.Actor
+	}
+	if actors[audit.Send] != "sender" {
+		t.Errorf("the first message was sent by %q, want the account that started the batch", actors[audit.Send])
+	}
+	if actors[audit.BatchSend] != "sender" {
+		t.Errorf("the batch was started by %q", actors[audit.BatchSend])
+	}
+}
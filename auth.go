@@ -0,0 +1,433 @@
+package networkcontrol
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/WhoSoup/factom-networkcontrol/audit"
+	"github.com/WhoSoup/factom-networkcontrol/authset"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Role is what an account may do. Every role includes the ones below it.
+type Role int
+
+const (
+	// RoleViewer can look at the authority set, proposals and batches
+	RoleViewer Role = iota
+	// RoleProposer can craft, import and merge messages and create batches
+	RoleProposer
+	// RoleSigner can add signatures of the authority the account is bound to
+	RoleSigner
+	// RoleSender can send messages to the network and schedule them
+	RoleSender
+)
+
+var roleNames = []string{"viewer", "proposer", "signer", "sender"}
+
+// ParseRole parses "viewer", "proposer", "signer" or "sender"
+func ParseRole(s string) (Role, error) {
+	for i, name := range roleNames {
+		if strings.EqualFold(s, name) {
+			return Role(i), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid role %q, must be one of %s", s, strings.Join(roleNames, ", "))
+}
+
+func (r Role) String() string {
+	if r < 0 || int(r) >= len(roleNames) {
+		return fmt.Sprintf("role(%d)", int(r))
+	}
+	return roleNames[r]
+}
+
+// User is an operator account of the control panel
+type User struct {
+	Name string
+	// PasswordHash is a bcrypt hash of the password. Accounts without one can
+	// only log in by signing a challenge.
+	PasswordHash string
+	Role         Role
+	// Chain is the identity chain id of the authority the account belongs
+	// to. Signers can only add signatures of this authority's signing key and
+	// log in by signing a challenge with it.
+	Chain string
+}
+
+// CheckPassword returns true if the password matches the hash
+func (u *User) CheckPassword(password string) bool {
+	if u.PasswordHash == "" {
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) == nil
+}
+
+// HashPassword returns the bcrypt hash of a password for the config file
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+// userSection is a [user.name] table of the config file
+type userSection struct {
+	// Password is the bcrypt hash of the password
+	Password string
+	Role     string
+	Chain    string
+}
+
+// loadUsers turns the user sections of the config file into accounts
+func loadUsers(sections map[string]*userSection) (map[string]*User, error) {
+	users := make(map[string]*User)
+	for name, sec := range sections {
+		role, err := ParseRole(sec.Role)
+		if err != nil {
+			return nil, fmt.Errorf("user %q: %v", name, err)
+		}
+
+		u := &User{Name: name, PasswordHash: sec.Password, Role: role, Chain: strings.ToLower(sec.Chain)}
+		if u.PasswordHash == "" && u.Chain == "" {
+			return nil, fmt.Errorf("user %q: needs a password or a chain to log in with", name)
+		}
+		if u.PasswordHash != "" {
+			if _, err := bcrypt.Cost([]byte(u.PasswordHash)); err != nil {
+				return nil, fmt.Errorf("user %q: the password is not a bcrypt hash: %v", name, err)
+			}
+		}
+		if u.Chain != "" {
+			if b, err := hex.DecodeString(u.Chain); err != nil || len(b) != 32 {
+				return nil, fmt.Errorf("user %q: invalid chain id %q", name, sec.Chain)
+			}
+		}
+		if role == RoleSigner && u.Chain == "" {
+			return nil, fmt.Errorf("user %q: signers have to be bound to the chain of their authority", name)
+		}
+		users[name] = u
+	}
+	return users, nil
+}
+
+const (
+	// sessionCookie is the name of the cookie that holds the session token
+	sessionCookie = "nc_session"
+	// challengeTTL is how long a login challenge can be answered
+	challengeTTL = 5 * time.Minute
+)
+
+var errLogin = errors.New("invalid user, password or signature")
+
+type session struct {
+	user    *User
+	expires time.Time
+}
+
+// sessions keeps the logged in accounts and the open login challenges in
+// memory, so everyone has to log in again after a restart
+type sessions struct {
+	mtx    sync.Mutex
+	ttl    time.Duration
+	tokens map[string]*session
+	nonces map[string]time.Time
+}
+
+func newSessions(ttl time.Duration) *sessions {
+	s := new(sessions)
+	s.ttl = ttl
+	s.tokens = make(map[string]*session)
+	s.nonces = make(map[string]time.Time)
+	return s
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// create starts a session for the account and returns its token
+func (s *sessions) create(u *User) (string, time.Time) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	token := randomHex(32)
+	expires := time.Now().Add(s.ttl)
+	s.tokens[token] = &session{user: u, expires: expires}
+	return token, expires
+}
+
+// get returns the account of the session or nil if the token is unknown or
+// expired
+func (s *sessions) get(token string) *User {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	sess, ok := s.tokens[token]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(sess.expires) {
+		delete(s.tokens, token)
+		return nil
+	}
+	return sess.user
+}
+
+func (s *sessions) remove(token string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	delete(s.tokens, token)
+}
+
+// challenge returns a new nonce to sign for a login
+func (s *sessions) challenge() string {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	now := time.Now()
+	for n, expires := range s.nonces {
+		if now.After(expires) {
+			delete(s.nonces, n)
+		}
+	}
+	nonce := randomHex(16)
+	s.nonces[nonce] = now.Add(challengeTTL)
+	return nonce
+}
+
+// useChallenge returns true if the nonce was handed out and is still valid.
+// Every nonce can only be used once.
+func (s *sessions) useChallenge(nonce string) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	expires, ok := s.nonces[nonce]
+	delete(s.nonces, nonce)
+	return ok && time.Now().Before(expires)
+}
+
+// authenticate logs in with a password, or with the signature of a login
+// challenge if the nonce is set. The signature has to be made with the
+// current signing key of the account's authority.
+func (nc *NetworkControl) authenticate(name, password, nonce, signature string) (*User, error) {
+	u, ok := nc.users[name]
+	if nonce == "" {
+		if !ok || !u.CheckPassword(password) {
+			return nil, errLogin
+		}
+		return u, nil
+	}
+
+	if !nc.sessions.useChallenge(nonce) {
+		return nil, errors.New("the login challenge is unknown or expired")
+	}
+	if !ok || u.Chain == "" {
+		return nil, errLogin
+	}
+	a, err := nc.ac.GetSpecific(u.Chain)
+	if err != nil {
+		return nil, err
+	}
+	if a == nil {
+		return nil, fmt.Errorf("%s is not a current authority", u.Chain)
+	}
+	pub, err := hex.DecodeString(a.SigningKey)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := hex.DecodeString(strings.TrimSpace(signature))
+	if err != nil || !authset.VerifyLogin(pub, nonce, sig) {
+		return nil, errLogin
+	}
+	return u, nil
+}
+
+// isAPI returns true for requests to the JSON API
+func isAPI(c echo.Context) bool {
+	return strings.HasPrefix(c.Path(), "/api/")
+}
+
+// requireJSON refuses API requests that change something unless they carry a
+// bearer token or a JSON body. Other sites can only send either after a CORS
+// preflight, which the API doesn't answer, so a plain form on another site
+// can't call the API even if no accounts are configured.
+func requireJSON(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		r := c.Request()
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			return next(c)
+		}
+		if strings.HasPrefix(r.Header.Get(echo.HeaderAuthorization), "Bearer ") {
+			return next(c)
+		}
+		if mt, _, err := mime.ParseMediaType(r.Header.Get(echo.HeaderContentType)); err != nil || mt != echo.MIMEApplicationJSON {
+			return apiFail(c, http.StatusUnsupportedMediaType, errors.New("requests have to be sent as application/json"))
+		}
+		return next(c)
+	}
+}
+
+// sessionToken returns the token of the bearer authorization header for the
+// API and of the session cookie for pages. The API ignores the cookie, so
+// other sites can't call it with the browser of a logged in user.
+func sessionToken(c echo.Context) string {
+	if isAPI(c) {
+		h := c.Request().Header.Get(echo.HeaderAuthorization)
+		if strings.HasPrefix(h, "Bearer ") {
+			return strings.TrimPrefix(h, "Bearer ")
+		}
+		return ""
+	}
+	if cookie, err := c.Cookie(sessionCookie); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+// require only lets accounts with at least the given role through. If no
+// accounts are configured, everyone has every role.
+func (nc *NetworkControl) require(role Role) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if len(nc.users) == 0 {
+				return next(c)
+			}
+
+			api := isAPI(c)
+			u := nc.sessions.get(sessionToken(c))
+			if u == nil {
+				if api {
+					return apiFail(c, http.StatusUnauthorized, errors.New("not logged in"))
+				}
+				return c.Redirect(http.StatusSeeOther, "/login")
+			}
+			if u.Role < role {
+				err := fmt.Errorf("account %s has the role %s, this needs %s", u.Name, u.Role, role)
+				if api {
+					return apiFail(c, http.StatusForbidden, err)
+				}
+				return nc.render(c, http.StatusForbidden, "error", err.Error())
+			}
+
+			c.Set("user", u)
+			return next(c)
+		}
+	}
+}
+
+// currentUser returns the logged in account, or nil if no accounts are
+// configured
+func currentUser(c echo.Context) *User {
+	u, _ := c.Get("user").(*User)
+	return u
+}
+
+// checkSigner makes sure the logged in account may add a signature of the
+// key. Only signers can add signatures, and only of the authority they are
+// bound to. Routes that add signatures next to other things, like the QR
+// import, rely on this rather than the role of the route.
+func (nc *NetworkControl) checkSigner(c echo.Context, pubkey []byte) error {
+	u := currentUser(c)
+	if u == nil {
+		return nil
+	}
+	if u.Role < RoleSigner {
+		return fmt.Errorf("account %s has the role %s, adding a signature needs %s", u.Name, u.Role, RoleSigner)
+	}
+	if u.Chain == "" {
+		return fmt.Errorf("account %s is not bound to an authority", u.Name)
+	}
+
+	a, err := nc.ac.GetSpecific(u.Chain)
+	if err != nil {
+		return err
+	}
+	if a == nil || a.SigningKey != hex.EncodeToString(pubkey) {
+		return fmt.Errorf("key %x is not the signing key of %s, the authority of account %s", pubkey, u.Chain, u.Name)
+	}
+	return nil
+}
+
+// checkMerge runs checkSigner for every key whose signature the merged
+// message adds to the stored proposal, or to base if it isn't stored yet.
+// Merging a copy must not let an account add signatures it couldn't add by
+// hand.
+func (nc *NetworkControl) checkMerge(c echo.Context, base, merged *authset.Message) error {
+	if nc.store != nil {
+		if p, err := nc.store.Get(merged.Hash()); err == nil {
+			if stored, err := p.Decode(); err == nil {
+				base = stored
+			}
+		}
+	}
+	for _, s := range merged.Signatures {
+		if base.SignedBy(s.PubKey) {
+			continue
+		}
+		if err := nc.checkSigner(c, s.PubKey); err != nil {
+			return fmt.Errorf("the merge adds a signature of %x: %v", s.PubKey, err)
+		}
+	}
+	return nil
+}
+
+func (nc *NetworkControl) loginPage(c echo.Context) error {
+	return nc.printLogin(c, http.StatusOK, nil)
+}
+
+// loginView is the data of the login page
+type loginView struct {
+	Error string
+	// Nonce is the challenge for a login with a signing key
+	Nonce string
+}
+
+func (nc *NetworkControl) printLogin(c echo.Context, status int, loginErr error) error {
+	v := loginView{Nonce: nc.sessions.challenge()}
+	if loginErr != nil {
+		v.Error = loginErr.Error()
+	}
+	return nc.render(c, status, "login", v)
+}
+
+func (nc *NetworkControl) login(c echo.Context) error {
+	u, err := nc.authenticate(c.FormValue("user"), c.FormValue("password"), c.FormValue("nonce"), c.FormValue("signature"))
+	nc.record(c, audit.Record{Action: audit.Login, Actor: c.FormValue("user")}, err)
+	if err != nil {
+		return nc.printLogin(c, http.StatusUnauthorized, err)
+	}
+
+	token, expires := nc.sessions.create(u)
+	c.SetCookie(&http.Cookie{
+		Name:     sessionCookie,
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   c.IsTLS(),
+		SameSite: http.SameSiteLaxMode,
+	})
+	return c.Redirect(http.StatusSeeOther, "/")
+}
+
+// recordLogout records the logout of the session's account. The logout
+// routes are open to everyone, so the account is not in the context.
+func (nc *NetworkControl) recordLogout(c echo.Context) {
+	if u := nc.sessions.get(sessionToken(c)); u != nil {
+		nc.record(c, audit.Record{Action: audit.Logout, Actor: u.Name}, nil)
+	}
+}
+
+func (nc *NetworkControl) logout(c echo.Context) error {
+	nc.recordLogout(c)
+	nc.sessions.remove(sessionToken(c))
+	c.SetCookie(&http.Cookie{Name: sessionCookie, Value: "", Path: "/", MaxAge: -1})
+	return c.Redirect(http.StatusSeeOther, "/login")
+}
@@ -0,0 +1,296 @@
+package networkcontrol
+
+import (
+	"encoding/hex"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/WhoSoup/factom-networkcontrol/authset"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testUsers are a viewer, a proposer and a sender with the password
+// "secret" and a signer bound to the authority of testKey(0)
+func testUsers(t *testing.T) map[string]*User {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]*User{
+		"viewer":   {Name: "viewer", PasswordHash: string(hash), Role: RoleViewer},
+		"proposer": {Name: "proposer", PasswordHash: string(hash), Role: RoleProposer},
+		"signer":   {Name: "signer", Role: RoleSigner, Chain: testChain(0)},
+		"sender":   {Name: "sender", PasswordHash: string(hash), Role: RoleSender},
+	}
+}
+
+// apiLoginAs logs in with the password, or with a signature of testKey(0)
+// for the signer, and returns the token
+func apiLoginAs(t *testing.T, e *echo.Echo, user string) string {
+	t.Helper()
+	req := apiLoginRequest{User: user, Password: "secret"}
+	if user == "signer" {
+		var ch apiChallenge
+		if code := apiCall(t, e, http.MethodGet, "/api/v1/login", nil, &ch); code != http.StatusOK {
+			t.Fatalf("challenge: status = %d", code)
+		}
+		req = apiLoginRequest{User: user, Nonce: ch.Nonce, Signature: hex.EncodeToString(authset.SignLogin(testKey(0), ch.Nonce))}
+	}
+
+	var login apiLogin
+	if code := apiCall(t, e, http.MethodPost, "/api/v1/login", req, &login); code != http.StatusOK {
+		t.Fatalf("login of %s: status = %d", user, code)
+	}
+	return login.Token
+}
+
+func TestLoadUsers(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		section userSection
+		wantErr bool
+	}{
+		{"password", userSection{Password: string(hash), Role: "viewer"}, false},
+		{"signer", userSection{Role: "signer", Chain: testChain(0)}, false},
+		{"unknown role", userSection{Password: string(hash), Role: "admin"}, true},
+		{"no way to log in", userSection{Role: "viewer"}, true},
+		{"plain password", userSection{Password: "secret", Role: "viewer"}, true},
+		{"invalid chain", userSection{Role: "signer", Chain: "abc"}, true},
+		{"signer without chain", userSection{Password: string(hash), Role: "signer"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadUsers(map[string]*userSection{"user": &tt.section})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSessions(t *testing.T) {
+	s := newSessions(time.Hour)
+	u := &User{Name: "alice"}
+
+	token, _ := s.create(u)
+	if s.get(token) != u {
+		t.Error("the session was not found")
+	}
+	s.remove(token)
+	if s.get(token) != nil {
+		t.Error("the session is still there after the logout")
+	}
+
+	expired := newSessions(-time.Second)
+	if token, _ := expired.create(u); expired.get(token) != nil {
+		t.Error("an expired session is still valid")
+	}
+
+	nonce := s.challenge()
+	if !s.useChallenge(nonce) {
+		t.Error("the challenge was not accepted")
+	}
+	if s.useChallenge(nonce) {
+		t.Error("the challenge was accepted twice")
+	}
+	if s.useChallenge("unknown") {
+		t.Error("an unknown challenge was accepted")
+	}
+}
+
+func TestAPIRoles(t *testing.T) {
+	e := testServer(t, Config{Users: testUsers(t), Store: openStore(t)})
+	viewer := apiLoginAs(t, e, "viewer")
+	proposer := apiLoginAs(t, e, "proposer")
+	signer := apiLoginAs(t, e, "signer")
+
+	m := testMessage(t)
+	create := apiCreateRequest{Type: "add", ChainID: testChain(9), ServerType: "audit"}
+	sign := func(k int) map[string]string {
+		return map[string]string{
+			"message":   m.Hex(),
+			"pubkey":    testKey(k).Pub.String(),
+			"signature": hex.EncodeToString(testKey(k).Sign(m.SigningHash).Bytes()),
+		}
+	}
+
+	tests := []struct {
+		name   string
+		token  string
+		method string
+		path   string
+		body   interface{}
+		want   int
+	}{
+		{"not logged in", "", http.MethodGet, "/api/v1/network", nil, http.StatusUnauthorized},
+		{"unknown token", "unknown", http.MethodGet, "/api/v1/network", nil, http.StatusUnauthorized},
+		{"viewer looks", viewer, http.MethodGet, "/api/v1/network", nil, http.StatusOK},
+		{"viewer checks", viewer, http.MethodPost, "/api/v1/check", map[string]string{"message": m.Hex()}, http.StatusOK},
+		{"viewer crafts", viewer, http.MethodPost, "/api/v1/create", create, http.StatusForbidden},
+		{"proposer crafts", proposer, http.MethodPost, "/api/v1/create", create, http.StatusOK},
+		{"proposer signs", proposer, http.MethodPost, "/api/v1/sign", sign(0), http.StatusForbidden},
+		{"signer signs with its key", signer, http.MethodPost, "/api/v1/sign", sign(0), http.StatusOK},
+		{"signer signs with another key", signer, http.MethodPost, "/api/v1/sign", sign(1), http.StatusForbidden},
+		{"signer sends", signer, http.MethodPost, "/api/v1/send", map[string]string{"message": m.Hex()}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fail apiError
+			if code := apiCallAs(t, e, tt.token, tt.method, tt.path, tt.body, &fail); code != tt.want {
+				t.Errorf("status = %d, want %d: %s", code, tt.want, fail.Error)
+			}
+		})
+	}
+
+	if code := apiCallAs(t, e, viewer, http.MethodPost, "/api/v1/logout", nil, nil); code != http.StatusNoContent {
+		t.Fatalf("logout: status = %d", code)
+	}
+	if code := apiCallAs(t, e, viewer, http.MethodGet, "/api/v1/network", nil, &apiError{}); code != http.StatusUnauthorized {
+		t.Errorf("after the logout: status = %d", code)
+	}
+}
+
+func TestAPIMergeSigner(t *testing.T) {
+	e := testServer(t, Config{Users: testUsers(t), Store: openStore(t)})
+	proposer := apiLoginAs(t, e, "proposer")
+	signer := apiLoginAs(t, e, "signer")
+
+	m := testMessage(t)
+	own, err := authset.Sign(m, testKey(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := authset.Sign(m, testKey(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		a, b  *authset.Message
+		want  int
+	}{
+		{"proposer adds a signature", proposer, m, own, http.StatusForbidden},
+		{"signer adds another key", signer, m, other, http.StatusForbidden},
+		{"signer adds its own key", signer, m, own, http.StatusOK},
+		// the signature of key 0 is stored now, so merging it adds nothing
+		{"proposer merges a stored signature", proposer, m, own, http.StatusOK},
+		// the copy in the request is no proof that the signature is stored
+		{"signature passed in the base", proposer, other, m, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fail apiError
+			code := apiCallAs(t, e, tt.token, http.MethodPost, "/api/v1/merge", map[string]string{
+				"message": tt.a.Hex(),
+				"other":   tt.b.Hex(),
+			}, &fail)
+			if code != tt.want {
+				t.Errorf("status = %d, want %d: %s", code, tt.want, fail.Error)
+			}
+		})
+	}
+}
+
+// webClient logs in to the pages with the password and keeps the session
+// and CSRF cookies
+type webClient struct {
+	t      *testing.T
+	srv    *httptest.Server
+	client *http.Client
+}
+
+func newWebClient(t *testing.T, e *echo.Echo, user string) *webClient {
+	t.Helper()
+	srv := httptest.NewServer(e)
+	t.Cleanup(srv.Close)
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &webClient{t: t, srv: srv, client: &http.Client{
+		Jar: jar,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}}
+
+	resp, err := w.client.Get(srv.URL + "/login")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if code := w.post("/login", url.Values{"user": {user}, "password": {"secret"}}); code != http.StatusSeeOther {
+		t.Fatalf("login of %s: status = %d", user, code)
+	}
+	return w
+}
+
+// post sends the form with the CSRF token
+func (w *webClient) post(path string, form url.Values) int {
+	w.t.Helper()
+	u, _ := url.Parse(w.srv.URL)
+	for _, c := range w.client.Jar.Cookies(u) {
+		if c.Name == "nc_csrf" {
+			form.Set("csrf", c.Value)
+		}
+	}
+	resp, err := w.client.Post(w.srv.URL+path, echo.MIMEApplicationForm, strings.NewReader(form.Encode()))
+	if err != nil {
+		w.t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestWebRoles(t *testing.T) {
+	e := testServer(t, Config{Users: testUsers(t), Store: openStore(t)})
+	viewer := newWebClient(t, e, "viewer")
+	proposer := newWebClient(t, e, "proposer")
+
+	m := testMessage(t)
+	signed, err := authset.Sign(m, testKey(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		w    *webClient
+		path string
+		form url.Values
+		// want is 303 if the action succeeded, 403 if the route refused
+		// the role and 200 for the error page
+		want int
+	}{
+		// the pre-send checks only show the message, sending it needs a
+		// sender
+		{"viewer runs the checks", viewer, "/submit", url.Values{"fullmsg": {m.Hex()}}, http.StatusOK},
+		{"viewer sends", viewer, "/send", url.Values{"fullmsg": {m.Hex()}}, http.StatusForbidden},
+		{"viewer imports", viewer, "/import", url.Values{"fullmsg": {m.Hex()}}, http.StatusForbidden},
+		{"proposer imports", proposer, "/import", url.Values{"fullmsg": {m.Hex()}}, http.StatusSeeOther},
+		{"proposer merges nothing new", proposer, "/merge", url.Values{"fullmsg": {m.Hex()}, "othermsg": {m.Hex()}}, http.StatusSeeOther},
+		{"proposer merges a signature", proposer, "/merge", url.Values{"fullmsg": {m.Hex()}, "othermsg": {signed.Hex()}}, http.StatusOK},
+		{"proposer scans a copy", proposer, "/qr/import", url.Values{"fullmsg": {m.Hex()}, "frames": {signed.Hex()}}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := tt.w.post(tt.path, tt.form); code != tt.want {
+				t.Errorf("status = %d, want %d", code, tt.want)
+			}
+		})
+	}
+}
@@ -1,36 +1,138 @@
 package networkcontrol
 
 import (
+	"log"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/FactomProject/factom"
+	"github.com/WhoSoup/factom-networkcontrol/authset"
 )
 
+// staleFactor is how many intervals old the cache may get before it is no
+// longer served while a refresh is running
+const staleFactor = 10
+
+// AuthCache keeps the authority set for the given interval. It is safe for
+// concurrent use. Only one request to the source runs at a time, concurrent
+// callers share its result. Once the cache is older than the interval, the
+// old authority set is still returned while it is refreshed in the
+// background.
 type AuthCache struct {
+	source   authset.AuthoritySource
 	interval time.Duration
-	time     time.Time
 
-	cache []*factom.Authority
+	mtx      sync.Mutex
+	time     time.Time
+	cache    []*factom.Authority
+	err      error
+	inflight chan struct{} // closed when the running refresh is done
 }
 
-func NewAuthCache(d time.Duration) *AuthCache {
+func NewAuthCache(source authset.AuthoritySource, d time.Duration) *AuthCache {
 	ac := new(AuthCache)
+	ac.source = source
 	ac.interval = d
 	return ac
 }
 
+// Run refreshes the cache every interval until stop is closed, so requests
+// don't have to wait for the source
+func (ac *AuthCache) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(ac.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := ac.wait(ac.refresh()); err != nil {
+			log.Printf("authcache: %v", err)
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
 func (ac *AuthCache) Get() ([]*factom.Authority, error) {
-	if time.Since(ac.time) < ac.interval {
+	ac.mtx.Lock()
+	age := time.Since(ac.time)
+	if ac.cache != nil && age < ac.interval {
+		defer ac.mtx.Unlock()
 		return ac.cache, nil
 	}
 
-	auth, err := factom.GetAuthorities()
-	if err != nil {
+	// stale-while-revalidate
+	if ac.cache != nil && age < ac.interval*staleFactor {
+		cache := ac.cache
+		ac.mtx.Unlock()
+		ac.refresh()
+		return cache, nil
+	}
+	ac.mtx.Unlock()
+
+	if err := ac.wait(ac.refresh()); err != nil {
 		return nil, err
 	}
 
+	ac.mtx.Lock()
+	defer ac.mtx.Unlock()
+	return ac.cache, nil
+}
+
+// refresh starts loading the authority set from the source unless it is
+// already being loaded. Returns a channel that is closed when done.
+func (ac *AuthCache) refresh() chan struct{} {
+	ac.mtx.Lock()
+	defer ac.mtx.Unlock()
+
+	if ac.inflight != nil {
+		return ac.inflight
+	}
+
+	done := make(chan struct{})
+	ac.inflight = done
+
+	go func() {
+		auth, err := ac.source.Authorities()
+		if err == nil {
+			sortAuthorities(auth)
+		}
+
+		ac.mtx.Lock()
+		if err == nil {
+			ac.cache = auth
+			ac.time = time.Now()
+		}
+		ac.err = err
+		ac.inflight = nil
+		ac.mtx.Unlock()
+
+		close(done)
+	}()
+
+	return done
+}
+
+// wait blocks until the refresh is done and returns its error
+func (ac *AuthCache) wait(done chan struct{}) error {
+	<-done
+	ac.mtx.Lock()
+	defer ac.mtx.Unlock()
+	if ac.err != nil && ac.cache == nil {
+		return ac.err
+	}
+	if ac.err != nil && time.Since(ac.time) >= ac.interval*staleFactor {
+		return ac.err
+	}
+	return nil
+}
+
+// sortAuthorities puts the federated servers first, ordered by chain id
+func sortAuthorities(auth []*factom.Authority) {
 	sort.Slice(auth, func(i, j int) bool {
 		if auth[i].Status == auth[j].Status {
 			return strings.Compare(auth[i].AuthorityChainID, auth[j].AuthorityChainID) < 0
@@ -40,11 +142,6 @@ func (ac *AuthCache) Get() ([]*factom.Authority, error) {
 		}
 		return false
 	})
-
-	ac.cache = auth
-	ac.time = time.Now()
-
-	return ac.cache, nil
 }
 
 func (ac *AuthCache) GetSpecific(id string) (*factom.Authority, error) {
@@ -0,0 +1,813 @@
+// Command authctl crafts, signs, merges, checks and sends authority set
+// messages from the command line and verifies exported audit logs of the
+// control panel. Apart from "send" and "snapshot", every command works
+// offline if the authority set is loaded from a snapshot file.
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/FactomProject/factom"
+	"github.com/WhoSoup/factom-networkcontrol/audit"
+	"github.com/WhoSoup/factom-networkcontrol/authset"
+	"github.com/WhoSoup/factom-networkcontrol/identity"
+	"github.com/WhoSoup/factom-networkcontrol/qr"
+)
+
+const defaultFactomd = "https://api.factomd.net"
+
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"craft":    {"craft add|remove -chain <chainid> -type federated|audit [-t <time>]\n  authctl craft key -chain <chainid> -kind signing|anchor|matryoshka -key <hex> [-priority <n>] [-keytype p2pkh|p2sh] [-t <time>]", craft},
+		"inspect":  {"inspect [-a <snapshot>] [-quorum fed|all|<m>of<n>] [file]", inspect},
+		"sign":     {"sign (-key <keyfile> [-a <snapshot> | -f <factomd> | -nocheck] | -pubkey <hex> -sig <hex>) [file]", sign},
+		"merge":    {"merge <file a> <file b>", merge},
+		"check":    {"check [-a <snapshot> | -f <factomd>] [-quorum fed|all|<m>of<n>] [-window <duration>] [file]", check},
+		"send":     {"send [-f <factomd>] [file]", send},
+		"snapshot": {"snapshot [-f <factomd>]", snapshot},
+		"bundle":   {"bundle [-network main|test|local|custom:<name>] [file]", bundle},
+		"qr":       {"qr encode [-chunk <bytes>] [-o <prefix> [-size <pixels>] | -text] [file]\n  authctl qr join [file...]", qrcode},
+		"login":    {"login -key <keyfile> <nonce>", login},
+		"batch":    {"batch sign -key <keyfile> [-a <snapshot> | -f <factomd> | -nocheck] [file]\n  authctl batch check [-a <snapshot> | -f <factomd>] [-quorum fed|all|<m>of<n>] [-window <duration>] [file]", batch},
+		"audit":    {"audit verify [-head <hash>] [file]\n  authctl audit show [-message <hash>] [file]", auditCmd},
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: authctl <command> [arguments]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Messages are read as hex, as a bundle or as scanned QR frames from the given file, or stdin if the file is omitted or \"-\".")
+	fmt.Fprintln(os.Stderr, "Commands that output a message write it as hex to stdout, or as a bundle if they read one.")
+	fmt.Fprintln(os.Stderr)
+	for _, name := range []string{"craft", "inspect", "sign", "merge", "check", "send", "snapshot", "bundle", "qr", "batch", "login", "audit"} {
+		fmt.Fprintf(os.Stderr, "  authctl %s\n", commands[name].usage)
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+
+	if err := cmd.run(os.Args[2:]); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+// readFile reads the file, or stdin if the path is empty or "-"
+func readFile(path string) ([]byte, error) {
+	if path == "" || path == "-" {
+		return ioutil.ReadAll(os.Stdin)
+	}
+	return ioutil.ReadFile(path)
+}
+
+// readInput reads a hex encoded message or a bundle from the file or stdin,
+// either directly, as the text of scanned QR frames or as an image of a
+// single QR code. The bundle is nil if the input was hex.
+func readInput(path string) (*authset.Message, *authset.Bundle, error) {
+	data, err := readScanned(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if qr.IsFrame(string(data)) {
+		if data, err = qr.JoinText(data); err != nil {
+			return nil, nil, err
+		}
+	}
+	return authset.DecodeInput(data)
+}
+
+// readScanned reads the file or stdin and returns the text of the QR code if
+// it is an image
+func readScanned(path string) ([]byte, error) {
+	data, err := readFile(path)
+	if err != nil || !qr.IsImage(data) {
+		return data, err
+	}
+	text, err := qr.Decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return []byte(text), nil
+}
+
+// readMessage reads a hex encoded message or a bundle from the file or stdin
+func readMessage(path string) (*authset.Message, error) {
+	m, _, err := readInput(path)
+	return m, err
+}
+
+// readMessages reads hex encoded messages, one per line, from the file or
+// stdin. Empty lines are skipped.
+func readMessages(path string) ([]*authset.Message, error) {
+	data, err := readFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var msgs []*authset.Message
+	for i, line := range bytes.Split(data, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		m, err := authset.DecodeHex(string(line))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+		msgs = append(msgs, m)
+	}
+	if len(msgs) == 0 {
+		return nil, errors.New("no messages found")
+	}
+	return msgs, nil
+}
+
+func writeMessage(m *authset.Message) {
+	fmt.Println(m.Hex())
+}
+
+// writeOutput writes the message as a bundle for the same network if the
+// input was a bundle, otherwise as hex
+func writeOutput(m *authset.Message, in *authset.Bundle) error {
+	if in == nil {
+		writeMessage(m)
+		return nil
+	}
+	data, err := authset.NewBundle(m, in.Network).Encode()
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+func fileArg(fs *flag.FlagSet) string {
+	if fs.NArg() > 0 {
+		return fs.Arg(0)
+	}
+	return ""
+}
+
+// authorities loads the authority set from the snapshot file if one is
+// given, otherwise from the factomd API
+func authorities(snapshot, factomd string) ([]*factom.Authority, error) {
+	var source authset.AuthoritySource = authset.LiveSource{}
+	if snapshot != "" {
+		source = authset.NewSnapshotSource(snapshot)
+	} else {
+		factom.SetFactomdServer(factomd)
+	}
+	return source.Authorities()
+}
+
+// parseTime accepts a unix timestamp in milliseconds or an RFC3339 time
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Now(), nil
+	}
+	if ms, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(0, ms*int64(time.Millisecond)), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+func craft(args []string) error {
+	if len(args) < 1 || (args[0] != "add" && args[0] != "remove" && args[0] != "key") {
+		return errors.New("usage: authctl " + commands["craft"].usage)
+	}
+
+	fs := flag.NewFlagSet("craft", flag.ExitOnError)
+	chain := fs.String("chain", "", "identity chain id of the server")
+	stype := fs.String("type", "", "server type: federated or audit")
+	kind := fs.String("kind", "", "key to change: signing, anchor or matryoshka")
+	key := fs.String("key", "", "new key as hex")
+	priority := fs.Int("priority", 0, "priority of the bitcoin anchor key")
+	keytype := fs.String("keytype", "p2pkh", "type of the bitcoin anchor key: p2pkh or p2sh")
+	ts := fs.String("t", "", "message time as unix milliseconds or RFC3339, defaults to now")
+	fs.Parse(args[1:])
+
+	t, err := parseTime(*ts)
+	if err != nil {
+		return err
+	}
+
+	var m *authset.Message
+	if args[0] == "key" {
+		kc, err := authset.ParseKeyChange(*kind, *key, *priority, *keytype)
+		if err != nil {
+			return err
+		}
+		if m, err = authset.BuildChangeKey(*chain, kc, t); err != nil {
+			return err
+		}
+		writeMessage(m)
+		return nil
+	}
+
+	st, err := authset.ParseServerType(*stype)
+	if err != nil {
+		return err
+	}
+
+	if args[0] == "add" {
+		m, err = authset.BuildAddServer(*chain, st, t)
+	} else {
+		m, err = authset.BuildRemoveServer(*chain, st, t)
+	}
+	if err != nil {
+		return err
+	}
+
+	writeMessage(m)
+	return nil
+}
+
+func inspect(args []string) error {
+	fs := flag.NewFlagSet("inspect", flag.ExitOnError)
+	snap := fs.String("a", "", "authority set snapshot used to identify signers")
+	quorum := fs.String("quorum", "fed", "quorum rule: fed, all or <m>of<n>")
+	fs.Parse(args)
+
+	rule, err := authset.ParseQuorumRule(*quorum)
+	if err != nil {
+		return err
+	}
+
+	m, in, err := readInput(fileArg(fs))
+	if err != nil {
+		return err
+	}
+
+	var auth []*factom.Authority
+	if *snap != "" {
+		if auth, err = authset.LoadSnapshot(*snap); err != nil {
+			return err
+		}
+	}
+
+	if in != nil {
+		fmt.Printf("Network:       %s\n", in.Network)
+	}
+	fmt.Printf("Summary:       %s\n", authset.Summary(m))
+	fmt.Printf("Type:          %s\n", m.TypeName())
+	fmt.Printf("Chain ID:      %s\n", m.ChainID)
+	if kc := m.KeyChange; kc != nil {
+		fmt.Printf("Key:           %s\n", kc.Kind)
+		fmt.Printf("New Key:       %x\n", kc.Key)
+		if kc.Kind == authset.AnchorKey {
+			fmt.Printf("Priority:      %d\n", kc.Priority)
+			fmt.Printf("Key Type:      %s\n", kc.KeyTypeName())
+		}
+	} else {
+		fmt.Printf("Server Type:   %s\n", m.ServerType)
+	}
+	fmt.Printf("Time:          %s (%s)\n", m.Timestamp.UTC(), time.Until(m.Timestamp).Round(time.Second))
+	fmt.Printf("Payload:       %x\n", m.Payload)
+	fmt.Printf("Signing Hash:  %x\n", m.SigningHash)
+	fmt.Printf("Signatures:    %d\n", len(m.Signatures))
+	if auth != nil {
+		signers, required := rule.Tally(m, auth)
+		fmt.Printf("Quorum:        %d of %d required (%s)\n", signers, required, rule.ForMessage(m))
+	}
+	for _, s := range m.Signatures {
+		valid := "valid"
+		if !s.Valid {
+			valid = "INVALID"
+		}
+		signer := ""
+		if auth != nil {
+			signer = " not an authority"
+			if a := authset.FindSigner(auth, s.PubKey); a != nil {
+				signer = fmt.Sprintf(" %s (%s)", a.AuthorityChainID, a.Status)
+				if !rule.ForMessage(m).Counts(a) {
+					signer += " does not count"
+				}
+			}
+		}
+		fmt.Printf("  %x %s%s\n", s.PubKey, valid, signer)
+	}
+	return nil
+}
+
+func sign(args []string) error {
+	fs := flag.NewFlagSet("sign", flag.ExitOnError)
+	keyfile := fs.String("key", "", "file containing the private key (hex, sk1-sk4, idsec or factomd.conf)")
+	snap := fs.String("a", "", "authority set snapshot used to verify the key, the factomd API is used if omitted")
+	factomd := fs.String("f", defaultFactomd, "factomd API endpoint")
+	nocheck := fs.Bool("nocheck", false, "sign without checking that the key belongs to an authority")
+	pubkey := fs.String("pubkey", "", "public key of an existing signature")
+	sig := fs.String("sig", "", "existing signature of the signing hash")
+	fs.Parse(args)
+
+	m, in, err := readInput(fileArg(fs))
+	if err != nil {
+		return err
+	}
+
+	var signed *authset.Message
+	if *keyfile != "" {
+		key, err := authset.LoadKey(*keyfile)
+		if err != nil {
+			return err
+		}
+
+		if *nocheck {
+			signed, err = authset.Sign(m, key)
+			if err != nil {
+				return err
+			}
+		} else {
+			auth, err := authorities(*snap, *factomd)
+			if err != nil {
+				return err
+			}
+			var a *factom.Authority
+			signed, a, err = authset.SignAsAuthority(m, key, auth)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "signed as %s (%s)\n", a.AuthorityChainID, a.Status)
+		}
+	} else {
+		if *pubkey == "" || *sig == "" {
+			return errors.New("either -key or both -pubkey and -sig are required")
+		}
+		pub, err := hex.DecodeString(*pubkey)
+		if err != nil {
+			return err
+		}
+		s, err := hex.DecodeString(*sig)
+		if err != nil {
+			return err
+		}
+		signed, err = authset.AddSignature(m, pub, s)
+		if err != nil {
+			return err
+		}
+	}
+
+	return writeOutput(signed, in)
+}
+
+func merge(args []string) error {
+	if len(args) != 2 {
+		return errors.New("usage: authctl " + commands["merge"].usage)
+	}
+
+	a, in, err := readInput(args[0])
+	if err != nil {
+		return err
+	}
+	b, err := readMessage(args[1])
+	if err != nil {
+		return err
+	}
+
+	merged, err := authset.MergeSignatures(a, b)
+	if err != nil {
+		return err
+	}
+
+	return writeOutput(merged, in)
+}
+
+func check(args []string) error {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	snap := fs.String("a", "", "authority set snapshot, the factomd API is used if omitted")
+	factomd := fs.String("f", defaultFactomd, "factomd API endpoint")
+	quorum := fs.String("quorum", "fed", "quorum rule: fed, all or <m>of<n>")
+	window := fs.Duration("window", authset.TimestampWindow, "how far the timestamp may be from the current time")
+	fs.Parse(args)
+
+	rule, err := authset.ParseQuorumRule(*quorum)
+	if err != nil {
+		return err
+	}
+
+	m, err := readMessage(fileArg(fs))
+	if err != nil {
+		return err
+	}
+
+	auth, err := authorities(*snap, *factomd)
+	if err != nil {
+		return err
+	}
+
+	report := authset.Validate(m, auth, rule, *window, time.Now())
+	if *snap == "" {
+		authset.CheckIdentity(report, m, auth, identity.LiveSource{})
+	}
+	printReport(report, "")
+	printIdentityNote(*snap)
+	printSimulation(report.Simulation)
+
+	if !report.OK() {
+		return errors.New("message failed the pre-send checks")
+	}
+	return nil
+}
+
+func printReport(report *authset.Report, indent string) {
+	fmt.Printf("%sSignatures: %d of %d required\n", indent, report.Signers, report.Required)
+	fmt.Println(indent + "Info:")
+	for _, i := range report.Info {
+		fmt.Println(indent + "  " + i)
+	}
+	fmt.Println(indent + "Errors:")
+	for _, e := range report.Errors {
+		fmt.Println(indent + "  " + e)
+	}
+}
+
+// printIdentityNote tells offline signers that the identities of added
+// servers were not checked, since they are read from the chains
+func printIdentityNote(snapshot string) {
+	if snapshot != "" {
+		fmt.Println("Identities of added servers were not checked, this needs the factomd API (-f) instead of a snapshot")
+	}
+}
+
+func printSimulation(sim *authset.Simulation) {
+	faultsBefore, faultsAfter := sim.Faults()
+	fmt.Println("Resulting authority set:")
+	fmt.Printf("  Federated:           %d -> %d\n", sim.FedBefore, sim.FedAfter)
+	fmt.Printf("  Audit:               %d -> %d\n", sim.AuditBefore, sim.AuditAfter)
+	fmt.Printf("  Signatures required: %d -> %d\n", sim.RequiredBefore, sim.RequiredAfter)
+	fmt.Printf("  Feds can go offline: %d -> %d\n", faultsBefore, faultsAfter)
+	fmt.Println("Warnings:")
+	for _, w := range sim.Warnings {
+		fmt.Println("  " + w)
+	}
+}
+
+func batch(args []string) error {
+	if len(args) < 1 || (args[0] != "sign" && args[0] != "check") {
+		return errors.New("usage: authctl " + commands["batch"].usage)
+	}
+	if args[0] == "sign" {
+		return batchSign(args[1:])
+	}
+	return batchCheck(args[1:])
+}
+
+// batchSign signs every message of the batch with the same key and writes
+// them in send order. Each message is checked against the authority set as it
+// will be when the message is processed.
+func batchSign(args []string) error {
+	fs := flag.NewFlagSet("batch sign", flag.ExitOnError)
+	keyfile := fs.String("key", "", "file containing the private key (hex, sk1-sk4, idsec or factomd.conf)")
+	snap := fs.String("a", "", "authority set snapshot used to verify the key, the factomd API is used if omitted")
+	factomd := fs.String("f", defaultFactomd, "factomd API endpoint")
+	nocheck := fs.Bool("nocheck", false, "sign without checking that the key belongs to an authority")
+	fs.Parse(args)
+
+	if *keyfile == "" {
+		return errors.New("-key is required")
+	}
+
+	msgs, err := readMessages(fileArg(fs))
+	if err != nil {
+		return err
+	}
+
+	key, err := authset.LoadKey(*keyfile)
+	if err != nil {
+		return err
+	}
+
+	var auth []*factom.Authority
+	if !*nocheck {
+		if auth, err = authorities(*snap, *factomd); err != nil {
+			return err
+		}
+	}
+
+	var signed []*authset.Message
+	current := auth
+	for i, m := range authset.SendOrder(msgs, auth) {
+		if m.SignedBy(key.Pub[:]) {
+			fmt.Fprintf(os.Stderr, "step %d: already signed\n", i+1)
+			signed = append(signed, m)
+			current = authset.Apply(m, current)
+			continue
+		}
+		if *nocheck {
+			s, err := authset.Sign(m, key)
+			if err != nil {
+				return fmt.Errorf("step %d: %v", i+1, err)
+			}
+			signed = append(signed, s)
+			continue
+		}
+
+		s, a, err := authset.SignAsAuthority(m, key, current)
+		if err != nil {
+			return fmt.Errorf("step %d: %v", i+1, err)
+		}
+		fmt.Fprintf(os.Stderr, "step %d: signed as %s (%s)\n", i+1, a.AuthorityChainID, a.Status)
+		signed = append(signed, s)
+		current = authset.Apply(m, current)
+	}
+
+	for _, m := range signed {
+		writeMessage(m)
+	}
+	return nil
+}
+
+func batchCheck(args []string) error {
+	fs := flag.NewFlagSet("batch check", flag.ExitOnError)
+	snap := fs.String("a", "", "authority set snapshot, the factomd API is used if omitted")
+	factomd := fs.String("f", defaultFactomd, "factomd API endpoint")
+	quorum := fs.String("quorum", "fed", "quorum rule: fed, all or <m>of<n>")
+	window := fs.Duration("window", authset.TimestampWindow, "how far the timestamp may be from the current time")
+	fs.Parse(args)
+
+	rule, err := authset.ParseQuorumRule(*quorum)
+	if err != nil {
+		return err
+	}
+
+	msgs, err := readMessages(fileArg(fs))
+	if err != nil {
+		return err
+	}
+
+	auth, err := authorities(*snap, *factomd)
+	if err != nil {
+		return err
+	}
+
+	report := authset.ValidateBatch(msgs, auth, rule, *window, time.Now())
+	if *snap == "" {
+		authset.CheckBatchIdentity(report, auth, identity.LiveSource{})
+	}
+	for i, m := range report.Order {
+		fmt.Printf("Step %d: %s %s\n", i+1, m.TypeName(), m.ChainID)
+		printReport(report.Reports[i], "  ")
+	}
+	fmt.Println("Batch Errors:")
+	for _, e := range report.Errors {
+		fmt.Println("  " + e)
+	}
+
+	printIdentityNote(*snap)
+	printSimulation(report.Simulation)
+
+	if !report.OK() {
+		return errors.New("batch failed the pre-send checks")
+	}
+	return nil
+}
+
+func send(args []string) error {
+	fs := flag.NewFlagSet("send", flag.ExitOnError)
+	factomd := fs.String("f", defaultFactomd, "factomd API endpoint")
+	fs.Parse(args)
+
+	m, err := readMessage(fileArg(fs))
+	if err != nil {
+		return err
+	}
+
+	factom.SetFactomdServer(*factomd)
+	resp, err := factom.SendRawMsg(m.Hex())
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(resp)
+	return nil
+}
+
+func bundle(args []string) error {
+	fs := flag.NewFlagSet("bundle", flag.ExitOnError)
+	network := fs.String("network", "main", "network the message is meant for: main, test, local, custom:<name> or a hex id")
+	fs.Parse(args)
+
+	id, err := authset.ParseNetworkID(*network)
+	if err != nil {
+		return err
+	}
+
+	m, err := readMessage(fileArg(fs))
+	if err != nil {
+		return err
+	}
+
+	return writeOutput(m, &authset.Bundle{Network: id.String()})
+}
+
+func qrcode(args []string) error {
+	if len(args) < 1 || (args[0] != "encode" && args[0] != "join") {
+		return errors.New("usage: authctl " + commands["qr"].usage)
+	}
+
+	fs := flag.NewFlagSet("qr", flag.ExitOnError)
+	chunk := fs.Int("chunk", qr.DefaultChunk, "bytes of content per frame")
+	prefix := fs.String("o", "", "write the frames as <prefix>-<n>.png instead of printing them to the terminal")
+	size := fs.Int("size", 512, "width of the png images in pixels")
+	text := fs.Bool("text", false, "print the text of the frames instead of the codes")
+	fs.Parse(args[1:])
+
+	if args[0] == "join" {
+		// the frames are text or images, one code per image
+		var data []byte
+		files := fs.Args()
+		if len(files) == 0 {
+			files = []string{""}
+		}
+		for _, f := range files {
+			text, err := readScanned(f)
+			if err != nil {
+				return err
+			}
+			data = append(append(data, text...), '\n')
+		}
+
+		content, err := qr.JoinText(data)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(content))
+		return nil
+	}
+
+	data, err := readFile(fileArg(fs))
+	if err != nil {
+		return err
+	}
+	frames, err := qr.Split(bytes.TrimSpace(data), *chunk)
+	if err != nil {
+		return err
+	}
+	for _, f := range frames {
+		if *text {
+			fmt.Println(f)
+			continue
+		}
+		if *prefix != "" {
+			png, err := qr.PNG(f.String(), *size)
+			if err != nil {
+				return err
+			}
+			name := fmt.Sprintf("%s-%d.png", *prefix, f.Index)
+			if err := ioutil.WriteFile(name, png, 0644); err != nil {
+				return err
+			}
+			fmt.Fprintln(os.Stderr, "wrote", name)
+			continue
+		}
+
+		code, err := qr.Terminal(f.String())
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Frame %d of %d\n%s\n", f.Index, f.Total, code)
+	}
+	return nil
+}
+
+func snapshot(args []string) error {
+	fs := flag.NewFlagSet("snapshot", flag.ExitOnError)
+	factomd := fs.String("f", defaultFactomd, "factomd API endpoint")
+	fs.Parse(args)
+
+	auth, err := authorities("", *factomd)
+	if err != nil {
+		return err
+	}
+
+	return authset.WriteSnapshot(os.Stdout, auth)
+}
+
+// login answers a login challenge of the control panel by signing the nonce
+// with a block signing key
+func login(args []string) error {
+	fs := flag.NewFlagSet("login", flag.ExitOnError)
+	keyfile := fs.String("key", "", "block signing key file")
+	fs.Parse(args)
+
+	if *keyfile == "" || fs.NArg() != 1 {
+		return errors.New("usage: authctl " + commands["login"].usage)
+	}
+
+	key, err := authset.LoadKey(*keyfile)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%x\n", authset.SignLogin(key, fs.Arg(0)))
+	return nil
+}
+
+func auditCmd(args []string) error {
+	if len(args) < 1 || (args[0] != "verify" && args[0] != "show") {
+		return errors.New("usage: authctl " + commands["audit"].usage)
+	}
+	if args[0] == "verify" {
+		return auditVerify(args[1:])
+	}
+	return auditShow(args[1:])
+}
+
+// auditVerify checks the hash chain of an exported audit log. With -head, the
+// last record also has to be the one with the given hash, which shows that no
+// records were cut off the end since the hash was written down.
+func auditVerify(args []string) error {
+	fs := flag.NewFlagSet("audit verify", flag.ExitOnError)
+	head := fs.String("head", "", "hash of the last record the log has to end with")
+	fs.Parse(args)
+
+	data, err := readFile(fileArg(fs))
+	if err != nil {
+		return err
+	}
+
+	n, last, err := audit.Verify(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("the audit log is broken after %d valid records: %v", n, err)
+	}
+	if *head != "" && *head != last {
+		return fmt.Errorf("the audit log ends with %s, not %s", last, *head)
+	}
+
+	fmt.Printf("%d records, the hash chain is intact\n", n)
+	fmt.Println("last hash:", last)
+	return nil
+}
+
+// auditShow verifies an exported audit log and prints its records, only those
+// of one message if -message is given
+func auditShow(args []string) error {
+	fs := flag.NewFlagSet("audit show", flag.ExitOnError)
+	message := fs.String("message", "", "only show the records of the message with this hash")
+	fs.Parse(args)
+
+	data, err := readFile(fileArg(fs))
+	if err != nil {
+		return err
+	}
+
+	if _, _, err := audit.Verify(bytes.NewReader(data)); err != nil {
+		return err
+	}
+	list, err := audit.Read(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	for _, r := range list {
+		if *message != "" && r.Message != *message {
+			continue
+		}
+		fmt.Printf("%d %s %s", r.Seq, r.Time.Format(time.RFC3339), r.Action)
+		if r.Actor != "" {
+			fmt.Printf(" by %s", r.Actor)
+		}
+		if r.IP != "" {
+			fmt.Printf(" from %s", r.IP)
+		}
+		if r.Message != "" {
+			fmt.Printf(" message %s", r.Message)
+		}
+		if r.Batch != "" {
+			fmt.Printf(" batch %s", r.Batch)
+		}
+		if r.Signer != "" {
+			fmt.Printf(" key %s", r.Signer)
+		}
+		if r.Height > 0 {
+			fmt.Printf(" at height %d", r.Height)
+		}
+		fmt.Printf(": %s\n", r.Result)
+	}
+	return nil
+}
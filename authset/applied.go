@@ -0,0 +1,53 @@
+package authset
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/FactomProject/factom"
+	"github.com/FactomProject/factomd/common/constants"
+)
+
+// AppliedIn checks whether the admin block contains the entry that the
+// network creates when it processes the message
+func AppliedIn(m *Message, ab *factom.ABlock) bool {
+	for _, e := range ab.ABEntries {
+		switch entry := e.(type) {
+		case *factom.AdminAddFederatedServer:
+			if m.Type == constants.ADDSERVER_MSG && m.ServerType == Federated && entry.IdentityChainID == m.ChainID {
+				return true
+			}
+		case *factom.AdminAddAuditServer:
+			if m.Type == constants.ADDSERVER_MSG && m.ServerType == Audit && entry.IdentityChainID == m.ChainID {
+				return true
+			}
+		case *factom.AdminRemoveFederatedServer:
+			// used for both federated and audit servers
+			if m.Type == constants.REMOVESERVER_MSG && entry.IdentityChainID == m.ChainID {
+				return true
+			}
+		case *factom.AdminAddFederatedServerKey:
+			if keyChanged(m, SigningKey, entry.IdentityChainID, entry.PublicKey) {
+				return true
+			}
+		case *factom.AdminAddFederatedServerBTCKey:
+			if keyChanged(m, AnchorKey, entry.IdentityChainID, entry.ECDSAPublicKey) {
+				return true
+			}
+		case *factom.AdminAddHash:
+			if keyChanged(m, MatryoshkaHash, entry.IdentityChainID, entry.MatryoshkaHash) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// keyChanged checks whether an admin block key entry is the one created by
+// the Change Server Key message
+func keyChanged(m *Message, kind KeyKind, chainID, key string) bool {
+	if m.KeyChange == nil || m.KeyChange.Kind != kind || m.ChainID != chainID {
+		return false
+	}
+	return strings.EqualFold(key, fmt.Sprintf("%x", m.KeyChange.Key))
+}
@@ -0,0 +1,526 @@
+package authset
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/FactomProject/factom"
+	"github.com/FactomProject/factomd/common/primitives"
+)
+
+// testKey returns a deterministic private key
+func testKey(t *testing.T, i int) *primitives.PrivateKey {
+	t.Helper()
+	seed := make([]byte, 32)
+	seed[0] = byte(i + 1)
+	return primitives.NewPrivateKeyFromHexBytes(seed)
+}
+
+func testChain(i int) string {
+	return strings.Repeat("0", 62) + hex.EncodeToString([]byte{byte(i)})
+}
+
+// testAuthorities returns three federated and two audit servers that sign
+// with testKey(0) to testKey(4)
+func testAuthorities(t *testing.T) []*factom.Authority {
+	t.Helper()
+	var auth []*factom.Authority
+	for i := 0; i < 5; i++ {
+		status := "federated"
+		if i >= 3 {
+			status = "audit"
+		}
+		auth = append(auth, &factom.Authority{
+			AuthorityChainID: testChain(i),
+			SigningKey:       testKey(t, i).Pub.String(),
+			Status:           status,
+		})
+	}
+	return auth
+}
+
+// testNow has millisecond precision like the messages
+var testNow = time.Unix(1600000000, 123*int64(time.Millisecond))
+
+// signWith signs the message with the test keys
+func signWith(t *testing.T, m *Message, keys ...int) *Message {
+	t.Helper()
+	for _, k := range keys {
+		var err error
+		if m, err = Sign(m, testKey(t, k)); err != nil {
+			t.Fatalf("signing with key %d: %v", k, err)
+		}
+	}
+	return m
+}
+
+func mustAdd(t *testing.T, chain string, st ServerType) *Message {
+	t.Helper()
+	m, err := BuildAddServer(chain, st, testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// duplicated attaches the signature of one key n times, which AddSignature
+// refuses but a message from elsewhere can carry
+func duplicated(t *testing.T, m *Message, key, n int) *Message {
+	t.Helper()
+	c, err := Decode(m.Raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := testKey(t, key).Sign(m.SigningHash)
+	for i := 0; i < n; i++ {
+		if err := c.msg.AddSignature(presigned{sig}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d, err := encode(c.msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func mustRemove(t *testing.T, chain string, st ServerType) *Message {
+	t.Helper()
+	m, err := BuildRemoveServer(chain, st, testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func mustKeyChange(t *testing.T, chain string, kc KeyChange) *Message {
+	t.Helper()
+	m, err := BuildChangeKey(chain, kc, testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestBuildDecode(t *testing.T) {
+	newKey := bytes.Repeat([]byte{0xab}, 32)
+	anchor := bytes.Repeat([]byte{0xcd}, 20)
+
+	build := map[string]func() (*Message, error){
+		"add federated": func() (*Message, error) { return BuildAddServer(testChain(7), Federated, testNow) },
+		"add audit":     func() (*Message, error) { return BuildAddServer(testChain(7), Audit, testNow) },
+		"remove":        func() (*Message, error) { return BuildRemoveServer(testChain(7), Audit, testNow) },
+		"signing key": func() (*Message, error) {
+			return BuildChangeKey(testChain(7), KeyChange{Kind: SigningKey, Key: newKey}, testNow)
+		},
+		"anchor key": func() (*Message, error) {
+			return BuildChangeKey(testChain(7), KeyChange{Kind: AnchorKey, Key: anchor, Priority: 2, KeyType: 1}, testNow)
+		},
+		"matryoshka": func() (*Message, error) {
+			return BuildChangeKey(testChain(7), KeyChange{Kind: MatryoshkaHash, Key: newKey}, testNow)
+		},
+	}
+
+	for name, f := range build {
+		t.Run(name, func(t *testing.T) {
+			m, err := f()
+			if err != nil {
+				t.Fatal(err)
+			}
+			d, err := DecodeHex(m.Hex())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if d.Type != m.Type || d.ChainID != testChain(7) || d.ServerType != m.ServerType {
+				t.Errorf("decoded %s %s %s, built %s %s %s", d.TypeName(), d.ChainID, d.ServerType, m.TypeName(), m.ChainID, m.ServerType)
+			}
+			if !d.Timestamp.Equal(testNow) {
+				t.Errorf("timestamp %s, want %s", d.Timestamp, testNow)
+			}
+			if d.Hash() != m.Hash() || len(d.Signatures) != 0 {
+				t.Errorf("decoded hash %s with %d signatures, built %s", d.Hash(), len(d.Signatures), m.Hash())
+			}
+
+			if m.SingleSignature() {
+				if !bytes.Equal(m.SigningHash, m.Payload) {
+					t.Error("key changes sign the payload itself")
+				}
+				if d.KeyChange == nil || !bytes.Equal(d.KeyChange.Key, m.KeyChange.Key) || d.KeyChange.Priority != m.KeyChange.Priority || d.KeyChange.KeyType != m.KeyChange.KeyType {
+					t.Errorf("key change %+v, want %+v", d.KeyChange, m.KeyChange)
+				}
+			} else {
+				sum := sha256.Sum256([]byte(hex.EncodeToString(m.Payload)))
+				if !bytes.Equal(m.SigningHash, sum[:]) {
+					t.Errorf("signing hash %x, want sha256(hex(payload)) %x", m.SigningHash, sum)
+				}
+			}
+		})
+	}
+}
+
+func TestBuildInvalid(t *testing.T) {
+	if _, err := BuildAddServer("abc", Federated, testNow); err != ErrInvalidChainID {
+		t.Errorf("short chain id: got %v, want %v", err, ErrInvalidChainID)
+	}
+	if _, err := BuildRemoveServer(strings.Repeat("x", 64), Federated, testNow); err != ErrInvalidChainID {
+		t.Errorf("chain id that isn't hex: got %v, want %v", err, ErrInvalidChainID)
+	}
+	if _, err := BuildChangeKey(testChain(1), KeyChange{Kind: SigningKey, Key: []byte{1}}, testNow); err != ErrInvalidKeyChange {
+		t.Errorf("short signing key: got %v, want %v", err, ErrInvalidKeyChange)
+	}
+	if _, err := BuildChangeKey(testChain(1), KeyChange{Kind: AnchorKey, Key: make([]byte, 20), KeyType: 2}, testNow); err != ErrInvalidKeyChange {
+		t.Errorf("anchor key type 2: got %v, want %v", err, ErrInvalidKeyChange)
+	}
+}
+
+func TestAddSignature(t *testing.T) {
+	m := mustAdd(t, testChain(3), Federated)
+	key := testKey(t, 0)
+	sig := key.Sign(m.SigningHash)
+
+	signed, err := AddSignature(m, sig.GetKey(), sig.GetSignature()[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(signed.Signatures) != 1 || !signed.Signatures[0].Valid || !bytes.Equal(signed.Signatures[0].PubKey, key.Pub[:]) {
+		t.Errorf("signatures %+v, want one valid signature of %x", signed.Signatures, key.Pub[:])
+	}
+	if len(m.Signatures) != 0 {
+		t.Error("the original message was modified")
+	}
+	if !bytes.Equal(signed.Payload, m.Payload) {
+		t.Error("the payload changed with the signature")
+	}
+
+	if _, err := AddSignature(signed, sig.GetKey(), sig.GetSignature()[:]); err != ErrAlreadySigned {
+		t.Errorf("second signature of the same key: got %v, want %v", err, ErrAlreadySigned)
+	}
+
+	other := key.Sign([]byte("something else"))
+	if _, err := AddSignature(m, other.GetKey(), other.GetSignature()[:]); err != ErrInvalidSignature {
+		t.Errorf("signature of other data: got %v, want %v", err, ErrInvalidSignature)
+	}
+	if _, err := AddSignature(m, key.Pub[:31], sig.GetSignature()[:]); err != ErrInvalidPubKey {
+		t.Errorf("short public key: got %v, want %v", err, ErrInvalidPubKey)
+	}
+}
+
+func TestMergeSignatures(t *testing.T) {
+	m := mustAdd(t, testChain(3), Federated)
+	a := signWith(t, m, 0)
+	b := signWith(t, m, 1)
+
+	merged, err := MergeSignatures(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(merged.ValidSignatures()) != 2 {
+		t.Errorf("merged has %d valid signatures, want 2", len(merged.ValidSignatures()))
+	}
+
+	again, err := MergeSignatures(merged, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(again.Signatures) != 2 {
+		t.Errorf("merging a known signature again gives %d signatures, want 2", len(again.Signatures))
+	}
+
+	if _, err := MergeSignatures(a, signWith(t, mustAdd(t, testChain(4), Federated), 1)); err != ErrMismatchedMsg {
+		t.Errorf("other chain: got %v, want %v", err, ErrMismatchedMsg)
+	}
+	if _, err := MergeSignatures(a, mustRemove(t, testChain(3), Federated)); err != ErrMismatchedType {
+		t.Errorf("other type: got %v, want %v", err, ErrMismatchedType)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	auth := testAuthorities(t)
+	fed := QuorumRule{Kind: FedMajority}
+	all := QuorumRule{Kind: AuthorityMajority}
+
+	tests := []struct {
+		name   string
+		m      *Message
+		rule   QuorumRule
+		window time.Duration
+		now    time.Time
+		ok     bool
+	}{
+		{"promote audit", signWith(t, mustAdd(t, testChain(3), Federated), 0, 1, 2), fed, 0, testNow, true},
+		{"fed majority, too few for factomd", signWith(t, mustAdd(t, testChain(3), Federated), 0, 1), fed, 0, testNow, false},
+		{"one key three times", duplicated(t, mustAdd(t, testChain(3), Federated), 0, 3), QuorumRule{Kind: FixedQuorum, M: 2, N: 5}, 0, testNow, false},
+		{"add new server", signWith(t, mustAdd(t, testChain(9), Audit), 0, 1, 3), fed, 0, testNow, true},
+		{"missing signature", signWith(t, mustAdd(t, testChain(3), Federated), 0), fed, 0, testNow, false},
+		{"audit signatures", signWith(t, mustAdd(t, testChain(3), Federated), 0, 3, 4), fed, 0, testNow, false},
+		{"audit signatures, all", signWith(t, mustAdd(t, testChain(3), Federated), 0, 3, 4), all, 0, testNow, true},
+		{"outside signatures", signWith(t, mustAdd(t, testChain(3), Federated), 0, 7), fed, 0, testNow, false},
+		{"too late", signWith(t, mustAdd(t, testChain(3), Federated), 0, 1, 2), fed, 0, testNow.Add(TimestampWindow + time.Second), false},
+		{"too early", signWith(t, mustAdd(t, testChain(3), Federated), 0, 1, 2), fed, 0, testNow.Add(-TimestampWindow - time.Second), false},
+		{"promote fed", signWith(t, mustAdd(t, testChain(0), Federated), 0, 1, 2), fed, 0, testNow, false},
+		{"demote audit", signWith(t, mustAdd(t, testChain(3), Audit), 0, 1, 2), fed, 0, testNow, false},
+		{"remove audit", signWith(t, mustRemove(t, testChain(4), Audit), 0, 1, 2), fed, 0, testNow, true},
+		{"remove unknown", signWith(t, mustRemove(t, testChain(9), Audit), 0, 1, 2), fed, 0, testNow, false},
+		{"wider window", signWith(t, mustAdd(t, testChain(3), Federated), 0, 1, 2), fed, 2 * time.Hour, testNow.Add(90 * time.Minute), true},
+		{"narrower window", signWith(t, mustAdd(t, testChain(3), Federated), 0, 1, 2), fed, time.Minute, testNow.Add(90 * time.Second), false},
+		{"fixed rule", signWith(t, mustAdd(t, testChain(3), Federated), 0, 1, 3), QuorumRule{Kind: FixedQuorum, M: 3, N: 5}, 0, testNow, true},
+		{"key change", signWith(t, mustKeyChange(t, testChain(1), KeyChange{Kind: SigningKey, Key: bytes.Repeat([]byte{1}, 32)}), 2), fed, 0, testNow, true},
+		{"key change by audit", signWith(t, mustKeyChange(t, testChain(1), KeyChange{Kind: SigningKey, Key: bytes.Repeat([]byte{1}, 32)}), 3), fed, 0, testNow, false},
+		{"key change to used key", signWith(t, mustKeyChange(t, testChain(1), KeyChange{Kind: SigningKey, Key: testKey(t, 2).Pub[:]}), 0), fed, 0, testNow, false},
+		{"key change of unknown", signWith(t, mustKeyChange(t, testChain(9), KeyChange{Kind: MatryoshkaHash, Key: bytes.Repeat([]byte{1}, 32)}), 0), fed, 0, testNow, false},
+		{"fixed rule, wrong set size", signWith(t, mustAdd(t, testChain(3), Federated), 0, 1, 2), QuorumRule{Kind: FixedQuorum, M: 3, N: 7}, 0, testNow, false},
+	}
+	for _, tt := range tests {
+		r := Validate(tt.m, auth, tt.rule, tt.window, tt.now)
+		if r.OK() != tt.ok {
+			t.Errorf("%s: ok = %t, want %t, errors %v", tt.name, r.OK(), tt.ok, r.Errors)
+		}
+	}
+}
+
+func TestAppliedIn(t *testing.T) {
+	promote := mustAdd(t, testChain(3), Federated)
+	demote := mustAdd(t, testChain(0), Audit)
+	remove := mustRemove(t, testChain(4), Audit)
+	key := mustKeyChange(t, testChain(1), KeyChange{Kind: MatryoshkaHash, Key: bytes.Repeat([]byte{0xab}, 32)})
+
+	ab := &factom.ABlock{ABEntries: []factom.ABEntry{
+		&factom.AdminAddFederatedServer{IdentityChainID: testChain(3)},
+		&factom.AdminRemoveFederatedServer{IdentityChainID: testChain(4)},
+		&factom.AdminAddHash{IdentityChainID: testChain(1), MatryoshkaHash: strings.Repeat("AB", 32)},
+	}}
+	if !AppliedIn(promote, ab) {
+		t.Error("the promotion is not found")
+	}
+	if !AppliedIn(remove, ab) {
+		t.Error("the removal is not found")
+	}
+	if AppliedIn(demote, ab) {
+		t.Error("the demotion is found without an audit server entry")
+	}
+	if AppliedIn(mustAdd(t, testChain(3), Audit), ab) {
+		t.Error("a demotion matches a promotion entry")
+	}
+	if !AppliedIn(key, ab) {
+		t.Error("the matryoshka hash change is not found")
+	}
+	if AppliedIn(mustKeyChange(t, testChain(1), KeyChange{Kind: MatryoshkaHash, Key: bytes.Repeat([]byte{0xac}, 32)}), ab) {
+		t.Error("a different matryoshka hash matches")
+	}
+	if AppliedIn(promote, &factom.ABlock{}) {
+		t.Error("found in an empty admin block")
+	}
+}
+
+func TestSimulate(t *testing.T) {
+	auth := testAuthorities(t)
+	fed := QuorumRule{Kind: FedMajority}
+
+	tests := []struct {
+		name         string
+		m            *Message
+		feds, audits int
+		required     int
+		warns        bool
+	}{
+		{"promote", mustAdd(t, testChain(3), Federated), 4, 1, 3, false},
+		{"add audit", mustAdd(t, testChain(9), Audit), 3, 3, 2, false},
+		{"demote", mustAdd(t, testChain(0), Audit), 2, 3, 2, true},
+		{"remove audit", mustRemove(t, testChain(4), Audit), 3, 1, 2, false},
+		{"remove fed", mustRemove(t, testChain(0), Federated), 2, 2, 2, true},
+	}
+	for _, tt := range tests {
+		s := Simulate(tt.m, auth, fed)
+		if s.FedAfter != tt.feds || s.AuditAfter != tt.audits || s.RequiredAfter != tt.required {
+			t.Errorf("%s: %d feds, %d audits, %d required, want %d, %d, %d", tt.name, s.FedAfter, s.AuditAfter, s.RequiredAfter, tt.feds, tt.audits, tt.required)
+		}
+		if (len(s.Warnings) > 0) != tt.warns {
+			t.Errorf("%s: warnings %v", tt.name, s.Warnings)
+		}
+	}
+
+	after := Apply(mustRemove(t, testChain(4), Audit), auth)
+	if len(after) != 4 || FindAuthority(after, testChain(4)) != nil {
+		t.Errorf("removing an audit server leaves %d authorities", len(after))
+	}
+
+	Apply(mustAdd(t, testChain(0), Audit), auth)
+	Simulate(mustAdd(t, testChain(0), Audit), auth, fed)
+	if auth[0].Status != "federated" {
+		t.Error("the given authority set was modified")
+	}
+}
+
+func TestParseQuorumRule(t *testing.T) {
+	tests := []struct {
+		in   string
+		want QuorumRule
+		err  bool
+	}{
+		{"", QuorumRule{Kind: FedMajority}, false},
+		{"fed", QuorumRule{Kind: FedMajority}, false},
+		{"all", QuorumRule{Kind: AuthorityMajority}, false},
+		{"3of5", QuorumRule{Kind: FixedQuorum, M: 3, N: 5}, false},
+		{"5of5", QuorumRule{Kind: FixedQuorum, M: 5, N: 5}, false},
+		{"6of5", QuorumRule{}, true},
+		{"0of3", QuorumRule{}, true},
+		{"most", QuorumRule{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseQuorumRule(tt.in)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("ParseQuorumRule(%q) = %+v, %v, want %+v, error %t", tt.in, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestTally(t *testing.T) {
+	auth := testAuthorities(t)
+	fed := QuorumRule{Kind: FedMajority}
+	all := QuorumRule{Kind: AuthorityMajority}
+	fixed := QuorumRule{Kind: FixedQuorum, M: 4, N: 5}
+
+	tests := []struct {
+		name     string
+		keys     []int
+		rule     QuorumRule
+		signers  int
+		required int
+	}{
+		{"fed, no signatures", nil, fed, 0, 2},
+		{"fed, two feds", []int{0, 1}, fed, 2, 2},
+		{"fed, audit doesn't count", []int{0, 3}, fed, 1, 2},
+		{"fed, outside key doesn't count", []int{0, 9}, fed, 1, 2},
+		{"all, two feds", []int{0, 1}, all, 2, 3},
+		{"all, audit counts", []int{0, 1, 3}, all, 3, 3},
+		{"fixed, audit counts", []int{0, 3, 4}, fixed, 3, 4},
+		{"fixed, everyone", []int{0, 1, 2, 3, 4}, fixed, 5, 4},
+	}
+	for _, tt := range tests {
+		m := signWith(t, mustAdd(t, testChain(3), Federated), tt.keys...)
+		signers, required := tt.rule.Tally(m, auth)
+		if signers != tt.signers || required != tt.required {
+			t.Errorf("%s: %d of %d, want %d of %d", tt.name, signers, required, tt.signers, tt.required)
+		}
+	}
+
+	m := duplicated(t, mustAdd(t, testChain(3), Federated), 0, 3)
+	if len(m.ValidSignatures()) != 3 {
+		t.Fatalf("the message carries %d valid signatures, want 3", len(m.ValidSignatures()))
+	}
+	for _, rule := range []QuorumRule{fed, all, fixed} {
+		if signers, _ := rule.Tally(m, auth); signers != 1 {
+			t.Errorf("%s: one key signing three times counts %d times", rule, signers)
+		}
+	}
+}
+
+func TestKeyChangeSingleSignature(t *testing.T) {
+	auth := testAuthorities(t)
+	m := mustKeyChange(t, testChain(2), KeyChange{Kind: SigningKey, Key: bytes.Repeat([]byte{1}, 32)})
+
+	fed := signWith(t, m, 0)
+	if _, err := Sign(fed, testKey(t, 1)); err != ErrSingleSignature {
+		t.Errorf("second key: got %v, want %v", err, ErrSingleSignature)
+	}
+	if _, err := MergeSignatures(fed, signWith(t, m, 1)); err != ErrSingleSignature {
+		t.Errorf("merging a second key: got %v, want %v", err, ErrSingleSignature)
+	}
+	if _, err := Sign(fed, testKey(t, 0)); err != ErrAlreadySigned {
+		t.Errorf("signing again with the same key: got %v, want %v", err, ErrAlreadySigned)
+	}
+
+	// the configured rule doesn't apply, one federated signature is enough
+	for _, rule := range []QuorumRule{{Kind: FedMajority}, {Kind: AuthorityMajority}, {Kind: FixedQuorum, M: 3, N: 5}} {
+		if got := rule.ForMessage(m); got.Kind != SingleFederated {
+			t.Errorf("%s: key changes use %s", rule, got)
+		}
+		if signers, required := rule.Tally(fed, auth); signers != 1 || required != 1 {
+			t.Errorf("%s: federated signature tallies %d of %d, want 1 of 1", rule, signers, required)
+		}
+		if signers, _ := rule.Tally(signWith(t, m, 3), auth); signers != 0 {
+			t.Errorf("%s: audit signature counts %d, want 0", rule, signers)
+		}
+	}
+}
+
+func TestParseKeyChange(t *testing.T) {
+	tests := []struct {
+		kind, key string
+		priority  int
+		keytype   string
+		ok        bool
+	}{
+		{"signing", strings.Repeat("ab", 32), 0, "", true},
+		{"matryoshka", strings.Repeat("ab", 32), 0, "", true},
+		{"anchor", strings.Repeat("ab", 20), 1, "p2sh", true},
+		{"anchor", strings.Repeat("ab", 20), 0, "p2pkh", true},
+		{"anchor", strings.Repeat("ab", 20), 0, "segwit", false},
+		{"anchor", strings.Repeat("ab", 32), 0, "p2pkh", false},
+		{"signing", strings.Repeat("ab", 20), 0, "", false},
+		{"signing", "not hex", 0, "", false},
+		{"efficiency", strings.Repeat("ab", 32), 0, "", false},
+	}
+	for _, tt := range tests {
+		_, err := ParseKeyChange(tt.kind, tt.key, tt.priority, tt.keytype)
+		if (err == nil) != tt.ok {
+			t.Errorf("ParseKeyChange(%s, %s, %d, %s): %v", tt.kind, tt.key, tt.priority, tt.keytype, err)
+		}
+	}
+}
+
+func TestSendOrder(t *testing.T) {
+	auth := testAuthorities(t)
+	rem := mustRemove(t, testChain(4), Audit)
+	demote := mustAdd(t, testChain(0), Audit)
+	key := mustKeyChange(t, testChain(1), KeyChange{Kind: MatryoshkaHash, Key: bytes.Repeat([]byte{1}, 32)})
+	add := mustAdd(t, testChain(9), Audit)
+	promote := mustAdd(t, testChain(3), Federated)
+
+	got := SendOrder([]*Message{rem, demote, key, add, promote}, auth)
+	want := []*Message{promote, add, key, demote, rem}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("step %d is %s %s, want %s %s", i+1, got[i].TypeName(), got[i].ChainID, want[i].TypeName(), want[i].ChainID)
+		}
+	}
+}
+
+func TestValidateBatch(t *testing.T) {
+	auth := testAuthorities(t)
+	fed := QuorumRule{Kind: FedMajority}
+
+	// after the promotion there are four feds, so the demotion needs three
+	// signatures
+	promote := signWith(t, mustAdd(t, testChain(3), Federated), 0, 1, 2)
+	demote := signWith(t, mustAdd(t, testChain(0), Audit), 0, 1)
+
+	r := ValidateBatch([]*Message{demote, promote}, auth, fed, 0, testNow)
+	if r.Order[0] != promote {
+		t.Fatal("the promotion is not sent first")
+	}
+	if !r.Reports[0].OK() || r.Reports[1].OK() || r.OK() {
+		t.Errorf("promotion ok %t, demotion ok %t, want the demotion to lack a signature", r.Reports[0].OK(), r.Reports[1].OK())
+	}
+	if r.Reports[1].Required != 3 {
+		t.Errorf("the demotion requires %d signatures, want 3", r.Reports[1].Required)
+	}
+
+	r = ValidateBatch([]*Message{signWith(t, demote, 2), promote}, auth, fed, 0, testNow)
+	if !r.OK() {
+		t.Errorf("batch errors %v %v %v", r.Errors, r.Reports[0].Errors, r.Reports[1].Errors)
+	}
+	if r.Simulation.FedAfter != 3 || r.Simulation.AuditAfter != 2 {
+		t.Errorf("the batch ends with %d feds and %d audits, want 3 and 2", r.Simulation.FedAfter, r.Simulation.AuditAfter)
+	}
+
+	r = ValidateBatch([]*Message{promote, signWith(t, mustAdd(t, testChain(3), Audit), 0, 1)}, auth, fed, 0, testNow)
+	if len(r.Errors) == 0 {
+		t.Error("two messages for the same chain pass")
+	}
+}
@@ -0,0 +1,114 @@
+package authset
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/FactomProject/factom"
+	"github.com/FactomProject/factomd/common/constants"
+)
+
+// the kinds of change in a batch, in the order they are sent
+const (
+	rankPromote = iota
+	rankAdd
+	rankKey
+	rankDemote
+	rankRemove
+)
+
+// rank returns the kind of change the message makes to the authority set
+func rank(m *Message, auth []*factom.Authority) int {
+	switch m.Type {
+	case constants.CHANGESERVER_KEY_MSG:
+		return rankKey
+	case constants.REMOVESERVER_MSG:
+		return rankRemove
+	}
+
+	a := FindAuthority(auth, m.ChainID)
+	switch {
+	case m.ServerType == Federated:
+		return rankPromote
+	case a != nil && a.Status == "federated":
+		return rankDemote
+	default:
+		return rankAdd
+	}
+}
+
+// SendOrder returns the messages in the order they should be sent, so the
+// network never has fewer servers than necessary in between: promotions and
+// additions first, then key changes, demotions and removals. Messages of the
+// same kind keep their order.
+func SendOrder(msgs []*Message, auth []*factom.Authority) []*Message {
+	order := append([]*Message(nil), msgs...)
+	sort.SliceStable(order, func(i, j int) bool {
+		return rank(order[i], auth) < rank(order[j], auth)
+	})
+	return order
+}
+
+// BatchReport is the result of the pre-send checks of several messages that
+// are sent together
+type BatchReport struct {
+	// Order is the messages in the order they will be sent
+	Order []*Message
+	// Reports are the checks of each message in Order against the authority
+	// set as it will be when the message is processed
+	Reports []*Report
+	// Errors are problems with the batch as a whole
+	Errors []string
+
+	// Simulation is the authority set after all messages are applied.
+	// Warnings include the ones of the steps in between.
+	Simulation *Simulation
+}
+
+// OK returns true if neither the batch nor any of its messages have errors
+func (r *BatchReport) OK() bool {
+	if len(r.Errors) > 0 {
+		return false
+	}
+	for _, rep := range r.Reports {
+		if !rep.OK() {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidateBatch checks the messages in send order. Every message is checked
+// against the authority set after the previous messages were applied, since
+// that is the set the network uses to verify its signatures.
+func ValidateBatch(msgs []*Message, auth []*factom.Authority, rule QuorumRule, window time.Duration, now time.Time) *BatchReport {
+	r := new(BatchReport)
+	r.Order = SendOrder(msgs, auth)
+
+	seen := make(map[string]bool)
+	for _, m := range r.Order {
+		if seen[m.ChainID] {
+			r.Errors = append(r.Errors, fmt.Sprintf("There is more than one message for %s", m.ChainID))
+		}
+		seen[m.ChainID] = true
+	}
+
+	var warnings []string
+	current := auth
+	for i, m := range r.Order {
+		rep := Validate(m, current, rule, window, now)
+		r.Reports = append(r.Reports, rep)
+
+		if i < len(r.Order)-1 {
+			for _, w := range rep.Simulation.Warnings {
+				warnings = append(warnings, fmt.Sprintf("After step %d: %s", i+1, w))
+			}
+		}
+		current = rep.Simulation.After
+	}
+
+	r.Simulation = compare(auth, current, rule)
+	r.Simulation.Warnings = append(warnings, r.Simulation.Warnings...)
+	return r
+}
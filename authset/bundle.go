@@ -0,0 +1,156 @@
+package authset
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/FactomProject/factomd/common/constants"
+)
+
+// BundleVersion is the version of the bundle format written by NewBundle
+const BundleVersion = 1
+
+var (
+	ErrBundleVersion  = errors.New("unsupported bundle version")
+	ErrBundleChecksum = errors.New("bundle checksum does not match, the file was modified or damaged")
+)
+
+// Bundle is a self-describing JSON file that carries a message between
+// signers. Everything apart from the message and the network is derived from
+// the message and checked when the bundle is decoded, so the summary a signer
+// reads always describes the message they sign.
+type Bundle struct {
+	Version int `json:"version"`
+	// Network is the name of the network the message is meant for
+	Network string `json:"network,omitempty"`
+	// Summary is a human readable description of the change
+	Summary   string `json:"summary"`
+	Type      string `json:"type"`
+	ChainID   string `json:"chainid"`
+	Timestamp int64  `json:"timestamp"`
+	// Message is the full hex encoded message including signatures
+	Message string `json:"message"`
+	// SigningData is the MarshalForKambani output that signers sign
+	SigningData string            `json:"signingdata"`
+	Signatures  []BundleSignature `json:"signatures"`
+	// Checksum is sha256(network + "\n" + message) as hex
+	Checksum string `json:"checksum"`
+}
+
+// BundleSignature is a signature carried in a bundle
+type BundleSignature struct {
+	PubKey    string `json:"pubkey"`
+	Signature string `json:"signature"`
+}
+
+// NewBundle creates a bundle of the message for the given network
+func NewBundle(m *Message, network string) *Bundle {
+	b := new(Bundle)
+	b.Version = BundleVersion
+	b.Network = network
+	b.Summary = Summary(m)
+	b.Type = m.TypeName()
+	b.ChainID = m.ChainID
+	b.Timestamp = m.Timestamp.UnixNano() / int64(time.Millisecond)
+	b.Message = m.Hex()
+	b.SigningData = hex.EncodeToString(m.SigningHash)
+	for _, s := range m.Signatures {
+		b.Signatures = append(b.Signatures, BundleSignature{
+			PubKey:    hex.EncodeToString(s.PubKey),
+			Signature: hex.EncodeToString(s.Signature),
+		})
+	}
+	b.Checksum = bundleChecksum(network, b.Message)
+	return b
+}
+
+func bundleChecksum(network, message string) string {
+	sum := sha256.Sum256([]byte(network + "\n" + message))
+	return hex.EncodeToString(sum[:])
+}
+
+// Encode returns the bundle as indented JSON
+func (b *Bundle) Encode() ([]byte, error) {
+	return json.MarshalIndent(b, "", "  ")
+}
+
+// DecodeBundle parses a bundle and returns the message it carries. The
+// checksum and all fields derived from the message have to match.
+func DecodeBundle(data []byte) (*Message, *Bundle, error) {
+	b := new(Bundle)
+	if err := json.Unmarshal(data, b); err != nil {
+		return nil, nil, err
+	}
+	if b.Version != BundleVersion {
+		return nil, nil, ErrBundleVersion
+	}
+	if b.Checksum != bundleChecksum(b.Network, b.Message) {
+		return nil, nil, ErrBundleChecksum
+	}
+
+	m, err := DecodeHex(b.Message)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// compare against a fresh bundle, so descriptions that were edited by
+	// hand are caught
+	want := NewBundle(m, b.Network)
+	switch {
+	case b.Summary != want.Summary:
+		return nil, nil, fmt.Errorf("bundle summary %q does not match the message: %q", b.Summary, want.Summary)
+	case b.Type != want.Type, b.ChainID != want.ChainID, b.Timestamp != want.Timestamp:
+		return nil, nil, errors.New("bundle type, chain id or timestamp does not match the message")
+	case b.SigningData != want.SigningData:
+		return nil, nil, errors.New("bundle signing data does not match the message")
+	case len(b.Signatures) != len(want.Signatures):
+		return nil, nil, errors.New("bundle signatures do not match the message")
+	}
+	for i := range b.Signatures {
+		if b.Signatures[i] != want.Signatures[i] {
+			return nil, nil, errors.New("bundle signatures do not match the message")
+		}
+	}
+
+	return m, b, nil
+}
+
+// IsBundle returns true if the data looks like a bundle rather than hex
+func IsBundle(data []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(data), []byte("{"))
+}
+
+// DecodeInput decodes either a bundle or a hex encoded message. The bundle
+// is nil for hex input.
+func DecodeInput(data []byte) (*Message, *Bundle, error) {
+	if IsBundle(data) {
+		return DecodeBundle(data)
+	}
+	m, err := DecodeHex(string(bytes.TrimSpace(data)))
+	return m, nil, err
+}
+
+// Summary describes the change the message makes in one sentence
+func Summary(m *Message) string {
+	var s string
+	switch m.Type {
+	case constants.ADDSERVER_MSG:
+		s = fmt.Sprintf("Make %s a %s server", m.ChainID, m.ServerType)
+	case constants.REMOVESERVER_MSG:
+		s = fmt.Sprintf("Remove %s server %s from the authority set", m.ServerType, m.ChainID)
+	case constants.CHANGESERVER_KEY_MSG:
+		kc := m.KeyChange
+		s = fmt.Sprintf("Set the %s of %s to %x", kc.Kind, m.ChainID, kc.Key)
+		if kc.Kind == AnchorKey {
+			s += fmt.Sprintf(" (priority %d, %s)", kc.Priority, kc.KeyTypeName())
+		}
+	default:
+		s = m.TypeName()
+	}
+	return fmt.Sprintf("%s, timestamp %s", s, m.Timestamp.UTC().Format("2006-01-02 15:04:05 MST"))
+}
@@ -0,0 +1,92 @@
+package authset
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestBundleRoundTrip(t *testing.T) {
+	msgs := map[string]*Message{
+		"unsigned": mustAdd(t, testChain(3), Federated),
+		"signed":   signWith(t, mustAdd(t, testChain(3), Federated), 0, 1),
+		"key":      signWith(t, mustKeyChange(t, testChain(1), KeyChange{Kind: AnchorKey, Key: make([]byte, 20), Priority: 1}), 2),
+	}
+	for name, m := range msgs {
+		data, err := NewBundle(m, "devnet").Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		d, b, err := DecodeBundle(data)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if d.Hex() != m.Hex() || b.Network != "devnet" {
+			t.Errorf("%s: decoded %s for %q, want %s for devnet", name, d.Hex(), b.Network, m.Hex())
+		}
+		if len(d.ValidSignatures()) != len(m.Signatures) {
+			t.Errorf("%s: %d valid signatures, want %d", name, len(d.ValidSignatures()), len(m.Signatures))
+		}
+	}
+}
+
+func TestBundleTampered(t *testing.T) {
+	m := signWith(t, mustAdd(t, testChain(3), Federated), 0)
+	other := signWith(t, mustAdd(t, testChain(4), Audit), 0)
+
+	tests := []struct {
+		name   string
+		modify func(b *Bundle)
+		err    error
+	}{
+		{"version", func(b *Bundle) { b.Version = BundleVersion + 1 }, ErrBundleVersion},
+		{"network", func(b *Bundle) { b.Network = "mainnet" }, ErrBundleChecksum},
+		{"message", func(b *Bundle) { b.Message = other.Hex() }, ErrBundleChecksum},
+		{"summary", func(b *Bundle) { b.Summary = Summary(other) }, nil},
+		{"chain id", func(b *Bundle) { b.ChainID = testChain(4) }, nil},
+		{"signing data", func(b *Bundle) { b.SigningData = strings.Repeat("00", 32) }, nil},
+		{"signatures", func(b *Bundle) { b.Signatures = nil }, nil},
+		// the checksum is recalculated, the summary still has to match
+		{"message and checksum", func(b *Bundle) {
+			b.Message = other.Hex()
+			b.Checksum = bundleChecksum(b.Network, b.Message)
+		}, nil},
+	}
+	for _, tt := range tests {
+		b := NewBundle(m, "devnet")
+		tt.modify(b)
+		data, err := json.Marshal(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _, err = DecodeBundle(data)
+		if err == nil || (tt.err != nil && err != tt.err) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestDecodeInput(t *testing.T) {
+	m := signWith(t, mustAdd(t, testChain(3), Federated), 0)
+
+	d, b, err := DecodeInput([]byte("  " + m.Hex() + "\n"))
+	if err != nil || b != nil || d.Hex() != m.Hex() {
+		t.Errorf("hex input: %v, bundle %v", err, b)
+	}
+
+	data, err := NewBundle(m, "").Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsBundle(append([]byte("\n"), data...)) {
+		t.Error("the bundle is not recognized")
+	}
+	d, b, err = DecodeInput(data)
+	if err != nil || b == nil || d.Hex() != m.Hex() {
+		t.Errorf("bundle input: %v, bundle %v", err, b)
+	}
+
+	if _, _, err := DecodeInput([]byte("not hex")); err == nil {
+		t.Error("invalid input is decoded")
+	}
+}
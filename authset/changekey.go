@@ -0,0 +1,212 @@
+package authset
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/FactomProject/factomd/common/constants"
+	"github.com/FactomProject/factomd/common/interfaces"
+	"github.com/FactomProject/factomd/common/messages"
+	"github.com/FactomProject/factomd/common/primitives"
+)
+
+var (
+	ErrInvalidKeyChange = errors.New("invalid key for the key type")
+	ErrSingleSignature  = errors.New("change server key messages can only carry a single signature")
+)
+
+// KeyKind is the key that a Change Server Key message replaces. The values
+// are the admin block entry types that factomd creates.
+type KeyKind byte
+
+const (
+	SigningKey     KeyKind = KeyKind(constants.TYPE_ADD_FED_SERVER_KEY)
+	AnchorKey      KeyKind = KeyKind(constants.TYPE_ADD_BTC_ANCHOR_KEY)
+	MatryoshkaHash KeyKind = KeyKind(constants.TYPE_ADD_MATRYOSHKA)
+)
+
+func (k KeyKind) String() string {
+	switch k {
+	case SigningKey:
+		return "Block Signing Key"
+	case AnchorKey:
+		return "Bitcoin Anchor Key"
+	case MatryoshkaHash:
+		return "Matryoshka Hash"
+	}
+	return fmt.Sprintf("Unknown (%d)", byte(k))
+}
+
+// ParseKeyKind turns "signing", "anchor" or "matryoshka" into a KeyKind
+func ParseKeyKind(s string) (KeyKind, error) {
+	switch s {
+	case "signing", "signingkey":
+		return SigningKey, nil
+	case "anchor", "btc":
+		return AnchorKey, nil
+	case "matryoshka", "mhash":
+		return MatryoshkaHash, nil
+	}
+	return 0, fmt.Errorf("invalid key kind: %s", s)
+}
+
+// KeyChange is the content of a Change Server Key message
+type KeyChange struct {
+	Kind KeyKind
+	// Priority and KeyType are only used by Bitcoin anchor keys. KeyType is
+	// 0 for P2PKH and 1 for P2SH.
+	Priority byte
+	KeyType  byte
+	// Key is 32 bytes for signing keys and matryoshka hashes, 20 bytes for
+	// Bitcoin anchor keys
+	Key []byte
+}
+
+// ParseKeyChange builds a KeyChange from its text form. The key is hex, the
+// key type is "p2pkh" or "p2sh" and only used for anchor keys.
+func ParseKeyChange(kind, key string, priority int, keytype string) (KeyChange, error) {
+	var kc KeyChange
+	var err error
+	if kc.Kind, err = ParseKeyKind(kind); err != nil {
+		return kc, err
+	}
+	if kc.Key, err = hex.DecodeString(key); err != nil {
+		return kc, err
+	}
+	if priority < 0 || priority > 255 {
+		return kc, fmt.Errorf("invalid key priority: %d", priority)
+	}
+	kc.Priority = byte(priority)
+
+	switch keytype {
+	case "", "p2pkh", "P2PKH":
+	case "p2sh", "P2SH":
+		kc.KeyType = 1
+	default:
+		return kc, fmt.Errorf("invalid key type: %s", keytype)
+	}
+
+	return kc, kc.validate()
+}
+
+// KeyTypeName returns the name of the Bitcoin key type
+func (kc *KeyChange) KeyTypeName() string {
+	switch kc.KeyType {
+	case 0:
+		return "P2PKH"
+	case 1:
+		return "P2SH"
+	}
+	return fmt.Sprintf("Unknown (%d)", kc.KeyType)
+}
+
+func (kc *KeyChange) validate() error {
+	switch kc.Kind {
+	case SigningKey, MatryoshkaHash:
+		if len(kc.Key) != 32 {
+			return ErrInvalidKeyChange
+		}
+	case AnchorKey:
+		if len(kc.Key) != 20 || kc.KeyType > 1 {
+			return ErrInvalidKeyChange
+		}
+	default:
+		return fmt.Errorf("invalid key kind: %d", byte(kc.Kind))
+	}
+	return nil
+}
+
+// BuildChangeKey creates an unsigned message that replaces one of the keys
+// of an authority
+func BuildChangeKey(chainID string, kc KeyChange, ts time.Time) (*Message, error) {
+	hash, err := parseChainID(chainID)
+	if err != nil {
+		return nil, err
+	}
+	if err := kc.validate(); err != nil {
+		return nil, err
+	}
+
+	key := make([]byte, 32)
+	copy(key, kc.Key)
+
+	msg := new(messages.ChangeServerKeyMsg)
+	msg.Timestamp = timestamp(ts)
+	msg.IdentityChainID = hash
+	msg.AdminBlockChange = byte(kc.Kind)
+	msg.KeyType = kc.KeyType
+	msg.KeyPriority = kc.Priority
+	msg.Key = primitives.NewHash(key)
+	return encode(msg)
+}
+
+// decodeKeyChange reads the key change out of the message
+func decodeKeyChange(msg *messages.ChangeServerKeyMsg) (*KeyChange, error) {
+	kc := new(KeyChange)
+	kc.Kind = KeyKind(msg.AdminBlockChange)
+	kc.Priority = msg.KeyPriority
+	kc.KeyType = msg.KeyType
+	kc.Key = msg.Key.Bytes()
+
+	if kc.Kind == AnchorKey {
+		if !bytes.Equal(kc.Key[20:], make([]byte, 12)) {
+			return nil, ErrInvalidKeyChange
+		}
+		kc.Key = kc.Key[:20]
+	}
+	if err := kc.validate(); err != nil {
+		return nil, err
+	}
+	return kc, nil
+}
+
+// singleSigned makes a Change Server Key message look like the multi
+// signature messages. The wire format only has room for one signature,
+// which has to be from a federated server, so adding a signature from a
+// different key fails instead of collecting it.
+type singleSigned struct {
+	*messages.ChangeServerKeyMsg
+}
+
+func (s singleSigned) AddSignature(key interfaces.Signer) error {
+	data, err := s.MarshalForSignature()
+	if err != nil {
+		return err
+	}
+	sig := key.Sign(data)
+	if s.Signature != nil && !bytes.Equal(s.Signature.GetKey(), sig.GetKey()) {
+		return ErrSingleSignature
+	}
+	s.Signature = sig
+	return nil
+}
+
+func (s singleSigned) GetSignatures() []interfaces.IFullSignature {
+	if s.Signature == nil {
+		return nil
+	}
+	return []interfaces.IFullSignature{s.Signature}
+}
+
+func (s singleSigned) VerifySignatures() ([]interfaces.IFullSignature, error) {
+	if s.Signature == nil {
+		return nil, nil
+	}
+	data, err := s.MarshalForSignature()
+	if err != nil {
+		return nil, err
+	}
+	if !s.Signature.Verify(data) {
+		return nil, nil
+	}
+	return []interfaces.IFullSignature{s.Signature}, nil
+}
+
+// MarshalForKambani returns the data that is signed. Unlike the server
+// messages, this is the payload itself and not a hash of it.
+func (s singleSigned) MarshalForKambani() ([]byte, error) {
+	return s.MarshalForSignature()
+}
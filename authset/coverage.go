@@ -0,0 +1,80 @@
+package authset
+
+import (
+	"encoding/hex"
+
+	"github.com/FactomProject/factom"
+)
+
+// SignatureState is whether an authority signed a message
+type SignatureState int
+
+const (
+	// Unsigned means the message has no signature of the authority's key
+	Unsigned SignatureState = iota
+	// Signed means the message has a valid signature of the authority's key
+	Signed
+	// Invalid means the message only has signatures of the authority's key
+	// that don't verify
+	Invalid
+	// NotAuthority is a signature of a key that doesn't belong to a current
+	// authority
+	NotAuthority
+)
+
+func (s SignatureState) String() string {
+	switch s {
+	case Signed:
+		return "signed"
+	case Invalid:
+		return "invalid"
+	case NotAuthority:
+		return "not an authority"
+	default:
+		return "unsigned"
+	}
+}
+
+// Coverage is the signature state of an authority, or a signature of a key
+// outside the authority set
+type Coverage struct {
+	// Authority is nil for keys outside the authority set
+	Authority *factom.Authority
+	PubKey    string
+	State     SignatureState
+	// Counts is true if the signature counts towards the quorum
+	Counts bool
+}
+
+// SignatureCoverage lists every authority in the order of the authority set
+// with whether it signed the message, followed by the signatures of keys that
+// are not in the authority set
+func SignatureCoverage(m *Message, auth []*factom.Authority, rule QuorumRule) []Coverage {
+	rule = rule.ForMessage(m)
+	states := make(map[string]SignatureState)
+	var outside []Coverage
+	for _, s := range m.Signatures {
+		key := hex.EncodeToString(s.PubKey)
+		if FindSigner(auth, s.PubKey) == nil {
+			outside = append(outside, Coverage{PubKey: key, State: NotAuthority})
+			continue
+		}
+		if s.Valid {
+			states[key] = Signed
+		} else if states[key] != Signed {
+			states[key] = Invalid
+		}
+	}
+
+	list := make([]Coverage, 0, len(auth)+len(outside))
+	for _, a := range auth {
+		state := states[a.SigningKey]
+		list = append(list, Coverage{
+			Authority: a,
+			PubKey:    a.SigningKey,
+			State:     state,
+			Counts:    state == Signed && rule.Counts(a),
+		})
+	}
+	return append(list, outside...)
+}
@@ -0,0 +1,46 @@
+package authset
+
+import (
+	"fmt"
+
+	"github.com/FactomProject/factom"
+	"github.com/FactomProject/factomd/common/constants"
+	"github.com/WhoSoup/factom-networkcontrol/identity"
+)
+
+// CheckIdentity fails the report if the message adds a server or promotes it
+// to federated and its identity is not fully registered on chain. factomd
+// accepts the message, but the server can't sign blocks without a management
+// chain and signing key. The identity is read from its chains with src.
+func CheckIdentity(r *Report, m *Message, auth []*factom.Authority, src identity.Source) {
+	if m.KeyChange != nil || m.Type != constants.ADDSERVER_MSG {
+		return
+	}
+	a := FindAuthority(auth, m.ChainID)
+	if a != nil && (m.ServerType != Federated || a.Status == "federated") {
+		return
+	}
+
+	id, err := identity.Resolve(src, m.ChainID)
+	if err != nil {
+		r.Errors = append(r.Errors, fmt.Sprintf("Unable to read the identity of %s: %v", m.ChainID, err))
+		return
+	}
+	missing := id.Missing()
+	for _, entry := range missing {
+		r.Errors = append(r.Errors, fmt.Sprintf("The identity of %s is not fully registered, it is missing %s", m.ChainID, entry))
+	}
+	if len(missing) == 0 {
+		r.Info = append(r.Info, fmt.Sprintf("The identity of %s is fully registered with the signing key %s", m.ChainID, id.SigningKey()))
+	}
+}
+
+// CheckBatchIdentity runs CheckIdentity for every step of the batch against
+// the authority set of that step
+func CheckBatchIdentity(r *BatchReport, auth []*factom.Authority, src identity.Source) {
+	current := auth
+	for i, m := range r.Order {
+		CheckIdentity(r.Reports[i], m, current, src)
+		current = r.Reports[i].Simulation.After
+	}
+}
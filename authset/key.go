@@ -0,0 +1,121 @@
+package authset
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/FactomProject/btcutil/base58"
+	"github.com/FactomProject/factom"
+	"github.com/FactomProject/factomd/common/primitives"
+)
+
+var (
+	ErrInvalidKey   = errors.New("unrecognized private key format")
+	ErrNotAuthority = errors.New("key does not belong to a current authority")
+)
+
+// skPrefixes are the prefixes of the human readable sk1 to sk4 private keys
+// created by serveridentity
+var skPrefixes = [][]byte{
+	{0x4d, 0xb6, 0xc9},
+	{0x4d, 0xb6, 0xe7},
+	{0x4d, 0xb7, 0x05},
+	{0x4d, 0xb7, 0x23},
+}
+
+// ParseKey parses a private key in one of the following formats:
+//   - 32 byte hex (LocalServerPrivKey in factomd.conf)
+//   - 64 byte hex (private key followed by the public key)
+//   - serveridentity human readable keys (sk1 to sk4)
+//   - idsec identity keys
+func ParseKey(s string) (*primitives.PrivateKey, error) {
+	s = strings.TrimSpace(s)
+
+	switch {
+	case strings.HasPrefix(s, "sk"):
+		raw := base58.Decode(s)
+		if len(raw) != 39 {
+			return nil, ErrInvalidKey
+		}
+		valid := false
+		for _, p := range skPrefixes {
+			if bytes.Equal(raw[:3], p) {
+				valid = true
+			}
+		}
+		if !valid {
+			return nil, ErrInvalidKey
+		}
+		check := sha256.Sum256(raw[:35])
+		check = sha256.Sum256(check[:])
+		if !bytes.Equal(check[:4], raw[35:]) {
+			return nil, errors.New("invalid key checksum")
+		}
+		return primitives.NewPrivateKeyFromHex(hex.EncodeToString(raw[3:35]))
+	case strings.HasPrefix(s, "idsec"):
+		key, err := factom.GetIdentityKey(s)
+		if err != nil {
+			return nil, err
+		}
+		return primitives.NewPrivateKeyFromHex(hex.EncodeToString(key.SecBytes()[:32]))
+	}
+
+	if _, err := hex.DecodeString(s); err != nil {
+		return nil, ErrInvalidKey
+	}
+	return primitives.NewPrivateKeyFromHex(s)
+}
+
+// LoadKey reads a private key from a file. Empty lines, section headers and
+// lines starting with "#" or ";" are skipped. The key can be on its own or in a
+// "LocalServerPrivKey = <key>" line as found in factomd.conf.
+func LoadKey(path string) (*primitives.PrivateKey, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' || line[0] == '[' {
+			continue
+		}
+
+		if i := strings.Index(line, "="); i >= 0 {
+			if !strings.EqualFold(strings.TrimSpace(line[:i]), "LocalServerPrivKey") {
+				continue
+			}
+			line = line[i+1:]
+		}
+
+		return ParseKey(line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return nil, fmt.Errorf("no private key found in %s", path)
+}
+
+// SignAsAuthority signs the message with the key after checking that it is
+// the block signing key of one of the given authorities
+func SignAsAuthority(m *Message, key *primitives.PrivateKey, auth []*factom.Authority) (*Message, *factom.Authority, error) {
+	a := FindSigner(auth, key.Pub[:])
+	if a == nil {
+		return nil, nil, ErrNotAuthority
+	}
+
+	signed, err := Sign(m, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return signed, a, nil
+}
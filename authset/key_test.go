@@ -0,0 +1,78 @@
+package authset
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseKey(t *testing.T) {
+	key := testKey(t, 0)
+	secret := hex.EncodeToString(key.Key[:32])
+
+	tests := []struct {
+		name string
+		in   string
+		ok   bool
+	}{
+		{"32 byte hex", secret, true},
+		{"64 byte hex", secret + hex.EncodeToString(key.Pub[:]), true},
+		{"whitespace", "  " + secret + "\n", true},
+		{"short hex", secret[:40], false},
+		{"not hex", "not a key", false},
+		{"bad sk", "sk1111111111111111111111111111111111111111111111111111", false},
+	}
+	for _, tt := range tests {
+		got, err := ParseKey(tt.in)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if tt.ok && got.Pub.String() != key.Pub.String() {
+			t.Errorf("%s: public key %s, want %s", tt.name, got.Pub, key.Pub)
+		}
+	}
+}
+
+func TestLoadKey(t *testing.T) {
+	key := testKey(t, 0)
+	conf := "; factomd.conf\n[app]\nNetwork = LOCAL\nLocalServerPrivKey = " + hex.EncodeToString(key.Key[:32]) + "\n"
+
+	path := filepath.Join(t.TempDir(), "factomd.conf")
+	if err := ioutil.WriteFile(path, []byte(conf), 0600); err != nil {
+		t.Fatal(err)
+	}
+	got, err := LoadKey(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Pub.String() != key.Pub.String() {
+		t.Errorf("public key %s, want %s", got.Pub, key.Pub)
+	}
+
+	empty := filepath.Join(t.TempDir(), "empty")
+	if err := ioutil.WriteFile(empty, []byte("# nothing\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadKey(empty); err == nil {
+		t.Error("a file without a key is loaded")
+	}
+}
+
+func TestSignAsAuthority(t *testing.T) {
+	auth := testAuthorities(t)
+	m := mustAdd(t, testChain(3), Federated)
+
+	signed, a, err := SignAsAuthority(m, testKey(t, 1), auth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.AuthorityChainID != testChain(1) || len(signed.ValidSignatures()) != 1 {
+		t.Errorf("signed as %s with %d signatures", a.AuthorityChainID, len(signed.ValidSignatures()))
+	}
+
+	if _, _, err := SignAsAuthority(m, testKey(t, 7), auth); err != ErrNotAuthority {
+		t.Errorf("outside key: got %v, want %v", err, ErrNotAuthority)
+	}
+}
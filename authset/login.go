@@ -0,0 +1,34 @@
+package authset
+
+import "github.com/FactomProject/factomd/common/primitives"
+
+// loginPrefix separates login signatures from message signatures. Server
+// messages are signed as a hash and key changes as their raw payload, which
+// starts with the message type byte. The prefix starts with "f", which is no
+// message type, so a signed login can never be replayed as a message
+// signature or the other way around.
+const loginPrefix = "factom-networkcontrol login:"
+
+// LoginData returns the data that is signed to answer a login challenge
+func LoginData(nonce string) []byte {
+	return []byte(loginPrefix + nonce)
+}
+
+// SignLogin signs the login challenge with a block signing key
+func SignLogin(key *primitives.PrivateKey, nonce string) []byte {
+	sig := key.Sign(LoginData(nonce))
+	return sig.GetSignature()[:]
+}
+
+// VerifyLogin checks the signature of a login challenge
+func VerifyLogin(pubkey []byte, nonce string, sig []byte) bool {
+	if len(pubkey) != 32 {
+		return false
+	}
+	signature := new(primitives.Signature)
+	signature.SetPub(pubkey)
+	if err := signature.SetSignature(sig); err != nil {
+		return false
+	}
+	return signature.Verify(LoginData(nonce))
+}
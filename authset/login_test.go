@@ -0,0 +1,46 @@
+package authset
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestLogin(t *testing.T) {
+	key := testKey(t, 0)
+	sig := SignLogin(key, "nonce")
+
+	if !VerifyLogin(key.Pub[:], "nonce", sig) {
+		t.Error("the login signature doesn't verify")
+	}
+	if VerifyLogin(key.Pub[:], "other nonce", sig) {
+		t.Error("the login signature verifies for another nonce")
+	}
+	if VerifyLogin(testKey(t, 1).Pub[:], "nonce", sig) {
+		t.Error("the login signature verifies for another key")
+	}
+}
+
+func TestLoginNotMessage(t *testing.T) {
+	key := testKey(t, 0)
+	msgs := map[string]*Message{
+		"server change": mustAdd(t, testChain(3), Federated),
+		"key change":    mustKeyChange(t, testChain(1), KeyChange{Kind: SigningKey, Key: bytes.Repeat([]byte{1}, 32)}),
+	}
+
+	for name, m := range msgs {
+		if bytes.HasPrefix(m.SigningHash, []byte(loginPrefix[:1])) {
+			t.Errorf("%s: the signed data starts like a login", name)
+		}
+
+		// a login with the signed data of the message as the nonce
+		nonce := string(m.SigningHash)
+		if _, err := AddSignature(m, key.Pub[:], SignLogin(key, nonce)); err != ErrInvalidSignature {
+			t.Errorf("%s: login signature as a message signature: got %v, want %v", name, err, ErrInvalidSignature)
+		}
+
+		signed := signWith(t, m, 0)
+		if VerifyLogin(key.Pub[:], nonce, signed.Signatures[0].Signature) {
+			t.Errorf("%s: the message signature is accepted as a login", name)
+		}
+	}
+}
@@ -0,0 +1,361 @@
+// Package authset crafts, decodes, signs, merges and validates the authority
+// set management messages (Add Server, Remove Server and Change Server Key)
+// that the control panel works with. It does not render anything, so it can
+// be used to script authset changes from other tools.
+package authset
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/FactomProject/factomd/common/constants"
+	"github.com/FactomProject/factomd/common/interfaces"
+	"github.com/FactomProject/factomd/common/messages"
+	"github.com/FactomProject/factomd/common/messages/msgsupport"
+	"github.com/FactomProject/factomd/common/primitives"
+)
+
+var (
+	ErrInvalidChainID   = errors.New("chain id must be 32 bytes hex")
+	ErrInvalidPubKey    = errors.New("public key must be 32 bytes")
+	ErrInvalidSignature = errors.New("signature is invalid")
+	ErrMismatchedType   = errors.New("mismatched message type")
+	ErrMismatchedMsg    = errors.New("messages are not for the same change")
+	ErrAlreadySigned    = errors.New("the key has already signed the message")
+)
+
+// ServerType is the type of server an authset message refers to
+type ServerType int
+
+const (
+	Federated ServerType = 0
+	Audit     ServerType = 1
+)
+
+func (st ServerType) String() string {
+	switch st {
+	case Federated:
+		return "Federated"
+	case Audit:
+		return "Audit"
+	}
+	return fmt.Sprintf("Unknown (%d)", int(st))
+}
+
+// ParseServerType turns "federated" or "audit" into a ServerType
+func ParseServerType(s string) (ServerType, error) {
+	switch s {
+	case "federated", "fed":
+		return Federated, nil
+	case "audit":
+		return Audit, nil
+	}
+	return 0, fmt.Errorf("invalid server type: %s", s)
+}
+
+// Signature is a single pubkey/signature pair attached to a message
+type Signature struct {
+	PubKey    []byte
+	Signature []byte
+	Valid     bool
+}
+
+// Message is the decoded form of an authset message
+type Message struct {
+	// Raw is the full binary message including signatures
+	Raw  []byte
+	Type byte
+
+	ChainID    string
+	ServerType ServerType
+	Timestamp  time.Time
+
+	// KeyChange is only set for Change Server Key messages
+	KeyChange *KeyChange
+
+	// Payload is the part of the message that is covered by signatures
+	Payload []byte
+	// SigningHash is the data that signers sign. It is sha256(hex(Payload))
+	// for server messages and the Payload itself for key changes.
+	SigningHash []byte
+
+	Signatures []Signature
+
+	msg multiSignable
+}
+
+// multiSignable is implemented by AddServerMsg, RemoveServerMsg and the
+// singleSigned wrapper of ChangeServerKeyMsg
+type multiSignable interface {
+	interfaces.IMsg
+	interfaces.MultiSignable
+	MarshalForKambani() ([]byte, error)
+}
+
+// presigned is a Signer that hands out an existing signature
+type presigned struct {
+	sig interfaces.IFullSignature
+}
+
+func (p presigned) Sign([]byte) interfaces.IFullSignature {
+	return p.sig
+}
+
+// TypeName returns the human readable name of the message type
+func (m *Message) TypeName() string {
+	switch m.Type {
+	case constants.ADDSERVER_MSG:
+		return "Add Server"
+	case constants.REMOVESERVER_MSG:
+		return "Remove Server"
+	case constants.CHANGESERVER_KEY_MSG:
+		return "Change Server Key"
+	}
+	return fmt.Sprintf("Unknown (%d)", m.Type)
+}
+
+// Hash returns the message hash that factomd uses to identify the message.
+// It only covers the payload, so it does not change when signatures are added.
+func (m *Message) Hash() string {
+	return primitives.Sha(m.Payload).String()
+}
+
+// Hex returns the full message as hex
+func (m *Message) Hex() string {
+	return hex.EncodeToString(m.Raw)
+}
+
+// SingleSignature returns true if the message can only carry one signature
+func (m *Message) SingleSignature() bool {
+	return m.Type == constants.CHANGESERVER_KEY_MSG
+}
+
+// ValidSignatures returns the signatures that verify against the message
+func (m *Message) ValidSignatures() []Signature {
+	var valid []Signature
+	for _, s := range m.Signatures {
+		if s.Valid {
+			valid = append(valid, s)
+		}
+	}
+	return valid
+}
+
+// SignedBy returns true if the message carries a signature of the key
+func (m *Message) SignedBy(pubkey []byte) bool {
+	for _, s := range m.Signatures {
+		if bytes.Equal(s.PubKey, pubkey) {
+			return true
+		}
+	}
+	return false
+}
+
+// DecodeHex decodes a hex encoded authset message
+func DecodeHex(s string) (*Message, error) {
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return Decode(data)
+}
+
+// Decode unmarshals an authset message and verifies the attached signatures
+func Decode(data []byte) (*Message, error) {
+	msg, err := msgsupport.UnmarshalMessage(data)
+	if err != nil {
+		return nil, err
+	}
+
+	m := new(Message)
+	m.Raw = data
+	m.Type = msg.Type()
+	// Timestamp.GetTime() treats the milliseconds as microseconds
+	m.Timestamp = time.Unix(0, msg.GetTimestamp().GetTimeMilli()*int64(time.Millisecond))
+
+	switch msg.Type() {
+	case constants.ADDSERVER_MSG:
+		add := msg.(*messages.AddServerMsg)
+		m.ChainID = add.ServerChainID.String()
+		m.ServerType = ServerType(add.ServerType)
+		m.msg = add
+	case constants.REMOVESERVER_MSG:
+		rem := msg.(*messages.RemoveServerMsg)
+		m.ChainID = rem.ServerChainID.String()
+		m.ServerType = ServerType(rem.ServerType)
+		m.msg = rem
+	case constants.CHANGESERVER_KEY_MSG:
+		csk := msg.(*messages.ChangeServerKeyMsg)
+		m.ChainID = csk.IdentityChainID.String()
+		if m.KeyChange, err = decodeKeyChange(csk); err != nil {
+			return nil, err
+		}
+		m.msg = singleSigned{csk}
+	default:
+		return nil, fmt.Errorf("invalid message type: %d", msg.Type())
+	}
+
+	if m.ServerType != Federated && m.ServerType != Audit {
+		return nil, errors.New("invalid server type")
+	}
+
+	if m.Payload, err = m.msg.MarshalForSignature(); err != nil {
+		return nil, err
+	}
+	if m.SigningHash, err = m.msg.MarshalForKambani(); err != nil {
+		return nil, err
+	}
+
+	validsigs, err := m.msg.VerifySignatures()
+	if err != nil {
+		return nil, err
+	}
+
+	valid := make(map[string]bool)
+	for _, v := range validsigs {
+		valid[fmt.Sprintf("%x", v.GetKey())] = true
+	}
+
+	for _, s := range m.msg.GetSignatures() {
+		m.Signatures = append(m.Signatures, Signature{
+			PubKey:    s.GetKey(),
+			Signature: s.GetSignature()[:],
+			Valid:     valid[fmt.Sprintf("%x", s.GetKey())],
+		})
+	}
+
+	return m, nil
+}
+
+// BuildAddServer creates an unsigned message that adds the chain to the
+// authority set, or changes its server type if it is already an authority
+func BuildAddServer(chainID string, st ServerType, ts time.Time) (*Message, error) {
+	hash, err := parseChainID(chainID)
+	if err != nil {
+		return nil, err
+	}
+
+	add := new(messages.AddServerMsg)
+	add.Timestamp = timestamp(ts)
+	add.ServerChainID = hash
+	add.ServerType = int(st)
+	return encode(add)
+}
+
+// BuildRemoveServer creates an unsigned message that removes the chain from
+// the authority set
+func BuildRemoveServer(chainID string, st ServerType, ts time.Time) (*Message, error) {
+	hash, err := parseChainID(chainID)
+	if err != nil {
+		return nil, err
+	}
+
+	rem := new(messages.RemoveServerMsg)
+	rem.Timestamp = timestamp(ts)
+	rem.ServerChainID = hash
+	rem.ServerType = int(st)
+	return encode(rem)
+}
+
+// AddSignature attaches a signature of the message's SigningHash. The
+// signature has to be valid for the given public key and the key can't have
+// signed the message already.
+func AddSignature(m *Message, pubkey, sig []byte) (*Message, error) {
+	if len(pubkey) != 32 {
+		return nil, ErrInvalidPubKey
+	}
+	if m.SignedBy(pubkey) {
+		return nil, ErrAlreadySigned
+	}
+
+	signature := new(primitives.Signature)
+	signature.SetPub(pubkey)
+	if err := signature.SetSignature(sig); err != nil {
+		return nil, err
+	}
+
+	if !signature.Verify(m.SigningHash) {
+		return nil, ErrInvalidSignature
+	}
+
+	// work on a fresh copy so m is left untouched
+	c, err := Decode(m.Raw)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.msg.AddSignature(presigned{signature}); err != nil {
+		return nil, err
+	}
+	return encode(c.msg)
+}
+
+// MergeSignatures returns a copy of a that contains all signatures of b that
+// a does not have yet. Both messages have to be for the same change.
+func MergeSignatures(a, b *Message) (*Message, error) {
+	if a.Type != b.Type {
+		return nil, ErrMismatchedType
+	}
+	if !bytes.Equal(a.Payload, b.Payload) {
+		return nil, ErrMismatchedMsg
+	}
+
+	c, err := Decode(a.Raw)
+	if err != nil {
+		return nil, err
+	}
+
+	has := make(map[string]bool)
+	for _, sig := range c.msg.GetSignatures() {
+		has[fmt.Sprintf("%x", sig.GetKey())] = true
+	}
+
+	for _, sig := range b.msg.GetSignatures() {
+		if has[fmt.Sprintf("%x", sig.GetKey())] {
+			continue
+		}
+		has[fmt.Sprintf("%x", sig.GetKey())] = true
+		if err := c.msg.AddSignature(presigned{sig}); err != nil {
+			return nil, err
+		}
+	}
+
+	return encode(c.msg)
+}
+
+func encode(msg interfaces.IMsg) (*Message, error) {
+	data, err := msg.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return Decode(data)
+}
+
+func parseChainID(chainID string) (interfaces.IHash, error) {
+	if !IsChainID(chainID) {
+		return nil, ErrInvalidChainID
+	}
+	return primitives.HexToHash(chainID)
+}
+
+func timestamp(ts time.Time) interfaces.Timestamp {
+	return primitives.NewTimestampFromMilliseconds(uint64(ts.UnixNano() / int64(time.Millisecond)))
+}
+
+// IsChainID checks whether s is a 32 byte hex string
+func IsChainID(s string) bool {
+	if len(s) != 64 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// Sign signs the message's SigningHash with the key and attaches the signature
+func Sign(m *Message, key interfaces.Signer) (*Message, error) {
+	sig := key.Sign(m.SigningHash)
+	return AddSignature(m, sig.GetKey(), sig.GetSignature()[:])
+}
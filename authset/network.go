@@ -0,0 +1,65 @@
+package authset
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/FactomProject/factomd/common/constants"
+	"github.com/FactomProject/factomd/common/primitives"
+)
+
+// NetworkID identifies a factom network the same way factomd does. Messages
+// don't contain it, so it is only used to label bundles and profiles.
+type NetworkID uint32
+
+const (
+	MainNet  NetworkID = NetworkID(constants.MAIN_NETWORK_ID)
+	TestNet  NetworkID = NetworkID(constants.TEST_NETWORK_ID)
+	LocalNet NetworkID = NetworkID(constants.LOCAL_NETWORK_ID)
+)
+
+// CustomNet returns the id of a custom network as factomd derives it from
+// the -customnet name
+func CustomNet(name string) NetworkID {
+	b := primitives.Sha([]byte(name)).Bytes()[:4]
+	return NetworkID(uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3]))
+}
+
+// ParseNetworkID accepts "main", "test", "local", "custom:<name>" or the id
+// as hex like "0xfa92e5a2"
+func ParseNetworkID(s string) (NetworkID, error) {
+	s = strings.TrimSpace(s)
+	switch strings.ToLower(s) {
+	case "main", "mainnet":
+		return MainNet, nil
+	case "test", "testnet":
+		return TestNet, nil
+	case "local", "localnet":
+		return LocalNet, nil
+	}
+
+	if strings.HasPrefix(strings.ToLower(s), "custom:") && len(s) > len("custom:") {
+		return CustomNet(s[len("custom:"):]), nil
+	}
+	if strings.HasPrefix(strings.ToLower(s), "0x") {
+		if id, err := strconv.ParseUint(s[2:], 16, 32); err == nil {
+			return NetworkID(id), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid network %q, must be main, test, local, custom:<name> or a hex id", s)
+}
+
+// String returns "main", "test", "local" or the hex id of a custom network.
+// The result can be parsed by ParseNetworkID.
+func (n NetworkID) String() string {
+	switch n {
+	case MainNet:
+		return "main"
+	case TestNet:
+		return "test"
+	case LocalNet:
+		return "local"
+	}
+	return fmt.Sprintf("0x%08x", uint32(n))
+}
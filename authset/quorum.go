@@ -0,0 +1,138 @@
+package authset
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/FactomProject/factom"
+)
+
+var ErrInvalidQuorum = errors.New("quorum rule must be \"fed\", \"all\" or \"<m>of<n>\"")
+
+// QuorumKind is the way the number of required signatures is determined
+type QuorumKind int
+
+const (
+	// FedMajority requires signatures from a majority of the federated
+	// servers. Signatures of audit servers don't count.
+	FedMajority QuorumKind = iota
+	// AuthorityMajority requires signatures from a majority of all
+	// authorities, federated and audit
+	AuthorityMajority
+	// FixedQuorum requires M signatures from any authority
+	FixedQuorum
+	// SingleFederated requires one signature from a federated server. It is
+	// what factomd accepts for Change Server Key messages and can't be
+	// configured.
+	SingleFederated
+)
+
+// networkRule is what factomd itself requires before it accepts a message,
+// regardless of the configured rule
+var networkRule = QuorumRule{Kind: AuthorityMajority}
+
+// QuorumRule decides how many signatures a message needs and whose count.
+// The zero value is a federated majority.
+type QuorumRule struct {
+	Kind QuorumKind
+	// M and N are only used by FixedQuorum. M is the number of signatures
+	// required, N is the expected size of the authority set.
+	M, N int
+}
+
+// ParseQuorumRule parses "fed", "all" or a fixed rule like "3of5"
+func ParseQuorumRule(s string) (QuorumRule, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "fed", "federated":
+		return QuorumRule{Kind: FedMajority}, nil
+	case "all", "authority":
+		return QuorumRule{Kind: AuthorityMajority}, nil
+	}
+
+	var q QuorumRule
+	q.Kind = FixedQuorum
+	if _, err := fmt.Sscanf(strings.ToLower(s), "%dof%d", &q.M, &q.N); err != nil {
+		return QuorumRule{}, ErrInvalidQuorum
+	}
+	if q.M < 1 || q.M > q.N {
+		return QuorumRule{}, ErrInvalidQuorum
+	}
+	return q, nil
+}
+
+func (q QuorumRule) String() string {
+	switch q.Kind {
+	case AuthorityMajority:
+		return "majority of all authorities"
+	case FixedQuorum:
+		return fmt.Sprintf("%d of %d authorities", q.M, q.N)
+	case SingleFederated:
+		return "a single federated server"
+	default:
+		return "majority of federated servers"
+	}
+}
+
+// Counts returns true if a signature of the authority counts towards the quorum
+func (q QuorumRule) Counts(a *factom.Authority) bool {
+	if a == nil {
+		return false
+	}
+	if q.Kind == FedMajority || q.Kind == SingleFederated {
+		return a.Status == "federated"
+	}
+	return true
+}
+
+// Required returns the number of signatures needed with the given authority set
+func (q QuorumRule) Required(auth []*factom.Authority) int {
+	switch q.Kind {
+	case AuthorityMajority:
+		return len(auth)/2 + 1
+	case FixedQuorum:
+		return q.M
+	case SingleFederated:
+		return 1
+	default:
+		fed, _ := count(auth)
+		return fed/2 + 1
+	}
+}
+
+// ForMessage returns the rule that applies to the message. Change Server Key
+// messages only carry one signature, so they always use SingleFederated.
+func (q QuorumRule) ForMessage(m *Message) QuorumRule {
+	if m.SingleSignature() {
+		return QuorumRule{Kind: SingleFederated}
+	}
+	return q
+}
+
+// Tally returns the number of authorities with a valid signature that count
+// towards the quorum and the number required. Every key counts once, no
+// matter how many signatures of it the message carries.
+func (q QuorumRule) Tally(m *Message, auth []*factom.Authority) (signers, required int) {
+	q = q.ForMessage(m)
+	seen := make(map[string]bool)
+	for _, sig := range m.ValidSignatures() {
+		key := fmt.Sprintf("%x", sig.PubKey)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if q.Counts(FindSigner(auth, sig.PubKey)) {
+			signers++
+		}
+	}
+	return signers, q.Required(auth)
+}
+
+// Role returns the status of the authority that the key belongs to, or an
+// empty string if it doesn't belong to a current authority
+func Role(auth []*factom.Authority, pubkey []byte) string {
+	if a := FindSigner(auth, pubkey); a != nil {
+		return a.Status
+	}
+	return ""
+}
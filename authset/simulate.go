@@ -0,0 +1,130 @@
+package authset
+
+import (
+	"fmt"
+
+	"github.com/FactomProject/factom"
+	"github.com/FactomProject/factomd/common/constants"
+)
+
+// MinFederated is the smallest number of federated servers considered safe.
+// With fewer, the network can't keep reaching consensus when a fed goes
+// offline.
+const MinFederated = 3
+
+// Simulation is the authority set before and after a message is applied
+type Simulation struct {
+	Before []*factom.Authority
+	After  []*factom.Authority
+
+	FedBefore, FedAfter     int
+	AuditBefore, AuditAfter int
+
+	// RequiredBefore and RequiredAfter are the number of signatures needed
+	// for an authority set change under the quorum rule
+	RequiredBefore, RequiredAfter int
+
+	// Warnings are the ways the resulting network is less safe
+	Warnings []string
+}
+
+// Faults returns how many feds can go offline before and after the change
+// with the remaining feds still having a majority
+func (s *Simulation) Faults() (before, after int) {
+	return faults(s.FedBefore), faults(s.FedAfter)
+}
+
+func faults(feds int) int {
+	if feds == 0 {
+		return 0
+	}
+	return feds - (feds/2 + 1)
+}
+
+// Simulate applies the message to a copy of the authority set. The given
+// authorities are not modified.
+func Simulate(m *Message, auth []*factom.Authority, rule QuorumRule) *Simulation {
+	return compare(auth, Apply(m, auth), rule)
+}
+
+// Apply returns the authority set after the message is processed by the
+// network. The given authorities are not modified.
+func Apply(m *Message, auth []*factom.Authority) []*factom.Authority {
+	var after []*factom.Authority
+
+	status := "federated"
+	if m.ServerType == Audit {
+		status = "audit"
+	}
+
+	found := false
+	for _, a := range auth {
+		if a.AuthorityChainID != m.ChainID {
+			after = append(after, a)
+			continue
+		}
+
+		found = true
+		switch m.Type {
+		case constants.ADDSERVER_MSG:
+			changed := *a
+			changed.Status = status
+			after = append(after, &changed)
+		case constants.CHANGESERVER_KEY_MSG:
+			changed := *a
+			switch m.KeyChange.Kind {
+			case SigningKey:
+				changed.SigningKey = fmt.Sprintf("%x", m.KeyChange.Key)
+			case MatryoshkaHash:
+				changed.MatryoshkaHash = fmt.Sprintf("%x", m.KeyChange.Key)
+			}
+			after = append(after, &changed)
+		}
+	}
+
+	if !found && m.Type == constants.ADDSERVER_MSG {
+		after = append(after, &factom.Authority{AuthorityChainID: m.ChainID, Status: status})
+	}
+
+	return after
+}
+
+// compare describes the difference between two authority sets
+func compare(before, after []*factom.Authority, rule QuorumRule) *Simulation {
+	s := new(Simulation)
+	s.Before = before
+	s.After = after
+
+	s.FedBefore, s.AuditBefore = count(s.Before)
+	s.FedAfter, s.AuditAfter = count(s.After)
+	s.RequiredBefore = rule.Required(s.Before)
+	s.RequiredAfter = rule.Required(s.After)
+
+	faultsBefore, faultsAfter := s.Faults()
+	switch {
+	case s.FedAfter == 0:
+		s.Warnings = append(s.Warnings, "The network would have no federated servers left and halt")
+	case faultsAfter == 0:
+		s.Warnings = append(s.Warnings, fmt.Sprintf("With %d feds, the network can't reach quorum if a single fed goes offline", s.FedAfter))
+	case faultsAfter < faultsBefore:
+		s.Warnings = append(s.Warnings, fmt.Sprintf("The network can only tolerate %d feds going offline instead of %d", faultsAfter, faultsBefore))
+	}
+
+	if s.FedAfter > 0 && s.FedAfter < MinFederated {
+		s.Warnings = append(s.Warnings, fmt.Sprintf("Only %d feds remain, at least %d are recommended", s.FedAfter, MinFederated))
+	}
+
+	return s
+}
+
+// count returns the number of federated and audit servers
+func count(auth []*factom.Authority) (fed, audit int) {
+	for _, a := range auth {
+		if a.Status == "federated" {
+			fed++
+		} else {
+			audit++
+		}
+	}
+	return
+}
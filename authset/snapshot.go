@@ -0,0 +1,57 @@
+package authset
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/FactomProject/factom"
+)
+
+// snapshot is the format of the factomd "authorities" API response
+type snapshot struct {
+	Authorities []*factom.Authority `json:"authorities"`
+}
+
+// ReadSnapshot reads a saved authority set. It accepts both a plain JSON list
+// of authorities and the result of the factomd "authorities" API call.
+func ReadSnapshot(r io.Reader) ([]*factom.Authority, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		var auth []*factom.Authority
+		if err := json.Unmarshal(data, &auth); err != nil {
+			return nil, err
+		}
+		return auth, nil
+	}
+
+	snap := new(snapshot)
+	if err := json.Unmarshal(data, snap); err != nil {
+		return nil, err
+	}
+	return snap.Authorities, nil
+}
+
+// LoadSnapshot reads a saved authority set from a file
+func LoadSnapshot(path string) ([]*factom.Authority, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadSnapshot(f)
+}
+
+// WriteSnapshot saves the authority set in the format of the factomd API
+func WriteSnapshot(w io.Writer, auth []*factom.Authority) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(snapshot{Authorities: auth})
+}
@@ -0,0 +1,44 @@
+package authset
+
+import (
+	"github.com/FactomProject/factom"
+)
+
+// AuthoritySource provides the current authority set of a network
+type AuthoritySource interface {
+	Authorities() ([]*factom.Authority, error)
+}
+
+// LiveSource queries the factomd API set via factom.SetFactomdServer
+type LiveSource struct{}
+
+var _ AuthoritySource = LiveSource{}
+
+func (LiveSource) Authorities() ([]*factom.Authority, error) {
+	return factom.GetAuthorities()
+}
+
+// SnapshotSource reads the authority set from a snapshot file. The file is
+// read on every call, so it can be replaced while in use.
+type SnapshotSource struct {
+	Path string
+}
+
+var _ AuthoritySource = (*SnapshotSource)(nil)
+
+func NewSnapshotSource(path string) *SnapshotSource {
+	return &SnapshotSource{Path: path}
+}
+
+func (s *SnapshotSource) Authorities() ([]*factom.Authority, error) {
+	return LoadSnapshot(s.Path)
+}
+
+// StaticSource is a fixed authority set kept in memory
+type StaticSource []*factom.Authority
+
+var _ AuthoritySource = StaticSource(nil)
+
+func (s StaticSource) Authorities() ([]*factom.Authority, error) {
+	return s, nil
+}
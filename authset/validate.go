@@ -0,0 +1,169 @@
+package authset
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/FactomProject/factom"
+	"github.com/FactomProject/factomd/common/constants"
+)
+
+// TimestampWindow is how far a message's timestamp may be from the current
+// time for factomd to accept it, unless the network is configured otherwise
+const TimestampWindow = time.Hour
+
+// Report is the result of the pre-send checks of a message.
+// Errors are problems that will likely get the message rejected or that
+// would do something unintended, Info describes what the message will do.
+type Report struct {
+	Info   []string
+	Errors []string
+
+	// Signers is the number of valid signatures that count towards the quorum
+	Signers int
+	// Required is the number of signatures needed to pass
+	Required int
+
+	// Simulation is the authority set after the message is applied
+	Simulation *Simulation
+}
+
+// OK returns true if no errors were found
+func (r *Report) OK() bool {
+	return len(r.Errors) == 0
+}
+
+// FindAuthority returns the authority with the given identity chain id or nil
+func FindAuthority(auth []*factom.Authority, chainID string) *factom.Authority {
+	for _, a := range auth {
+		if a.AuthorityChainID == chainID {
+			return a
+		}
+	}
+	return nil
+}
+
+// FindSigner returns the authority with the given signing key or nil
+func FindSigner(auth []*factom.Authority, pubkey []byte) *factom.Authority {
+	key := fmt.Sprintf("%x", pubkey)
+	for _, a := range auth {
+		if a.SigningKey == key {
+			return a
+		}
+	}
+	return nil
+}
+
+// Validate checks the message against the given authority set at the time
+// "now" the way the network would when receiving it. Signatures are counted
+// according to the quorum rule and the timestamp has to be within the window,
+// which defaults to TimestampWindow if zero. Server changes also need
+// signatures from a majority of all authorities, which is what factomd
+// checks, even if the quorum rule asks for fewer.
+func Validate(m *Message, auth []*factom.Authority, rule QuorumRule, window time.Duration, now time.Time) *Report {
+	r := new(Report)
+	rule = rule.ForMessage(m)
+	if window <= 0 {
+		window = TimestampWindow
+	}
+
+	diff := now.Sub(m.Timestamp)
+	if diff > window || diff < -window {
+		r.Errors = append(r.Errors, fmt.Sprintf("The timestamp is outside the acceptable window. Must be sent between %s and %s.",
+			m.Timestamp.Add(-window), m.Timestamp.Add(window)))
+	}
+
+	if m.KeyChange != nil {
+		validateKeyChange(r, m, auth)
+	} else {
+		validateServerChange(r, m, auth)
+	}
+
+	r.Simulation = Simulate(m, auth, rule)
+
+	if rule.Kind == FixedQuorum && rule.N != len(auth) {
+		r.Errors = append(r.Errors, fmt.Sprintf("The quorum rule expects %d authorities but there are %d", rule.N, len(auth)))
+	}
+
+	r.Signers, r.Required = rule.Tally(m, auth)
+	if r.Signers < r.Required {
+		r.Errors = append(r.Errors, fmt.Sprintf("There are only %d valid signatures. Need at least %d to pass (%s)", r.Signers, r.Required, rule))
+	}
+
+	if !m.SingleSignature() {
+		if signers, required := networkRule.Tally(m, auth); signers < required {
+			r.Errors = append(r.Errors, fmt.Sprintf("factomd only accepts the message with valid signatures from %d of the %d authorities, there are %d", required, len(auth), signers))
+		}
+	}
+
+	return r
+}
+
+// validateServerChange checks adding, promoting, demoting and removing servers
+func validateServerChange(r *Report, m *Message, auth []*factom.Authority) {
+	adding := m.Type == constants.ADDSERVER_MSG
+	if a := FindAuthority(auth, m.ChainID); a != nil {
+		isFed := a.Status == "federated"
+		if adding {
+			if m.ServerType == Federated {
+				if isFed {
+					r.Errors = append(r.Errors, "Promoting a node that is already a fed to fed")
+				} else {
+					r.Info = append(r.Info, "Promoting an Audit node to a Fed node and increasing # of feds")
+				}
+			} else if m.ServerType == Audit {
+				if isFed {
+					r.Info = append(r.Info, "Demoting a Fed node to an Audit node and decreasing # of feds")
+				} else {
+					r.Errors = append(r.Errors, "Demoting a node that is an audit node to audit node")
+				}
+			}
+		}
+	} else { // new server
+		if adding {
+			r.Info = append(r.Info, fmt.Sprintf("Promoting a new server into the authority set as %s Node", m.ServerType))
+		} else {
+			r.Errors = append(r.Errors, "Trying to remove a server that's not in the authority set")
+		}
+	}
+}
+
+// validateKeyChange checks replacing one of the keys of an authority
+func validateKeyChange(r *Report, m *Message, auth []*factom.Authority) {
+	kc := m.KeyChange
+	r.Info = append(r.Info, "Change Server Key messages carry a single signature. Any federated server can sign it, the quorum rule does not apply")
+
+	for _, sig := range m.ValidSignatures() {
+		if a := FindSigner(auth, sig.PubKey); a != nil && a.Status != "federated" {
+			r.Errors = append(r.Errors, "The message is signed by an audit server but needs to be signed by a federated server")
+		}
+	}
+
+	a := FindAuthority(auth, m.ChainID)
+	if a == nil {
+		r.Errors = append(r.Errors, "Trying to change the key of a server that's not in the authority set")
+		return
+	}
+
+	key := fmt.Sprintf("%x", kc.Key)
+	switch kc.Kind {
+	case SigningKey:
+		if a.SigningKey == key {
+			r.Errors = append(r.Errors, "The new block signing key is the same as the current one")
+			break
+		}
+		if other := FindSigner(auth, kc.Key); other != nil {
+			r.Errors = append(r.Errors, fmt.Sprintf("The new block signing key is already used by %s", other.AuthorityChainID))
+			break
+		}
+		r.Info = append(r.Info, fmt.Sprintf("Replacing the block signing key %s with %s", a.SigningKey, key))
+	case AnchorKey:
+		r.Info = append(r.Info, fmt.Sprintf("Setting the Bitcoin anchor key with priority %d to %s (%s)", kc.Priority, key, kc.KeyTypeName()))
+	case MatryoshkaHash:
+		if a.MatryoshkaHash == key {
+			r.Errors = append(r.Errors, "The new Matryoshka hash is the same as the current one")
+			break
+		}
+		r.Info = append(r.Info, fmt.Sprintf("Replacing the Matryoshka hash %s with %s", a.MatryoshkaHash, key))
+	}
+}
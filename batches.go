@@ -0,0 +1,389 @@
+package networkcontrol
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/FactomProject/factom"
+	"github.com/WhoSoup/factom-networkcontrol/audit"
+	"github.com/WhoSoup/factom-networkcontrol/authset"
+	"github.com/WhoSoup/factom-networkcontrol/proposal"
+	"github.com/labstack/echo/v4"
+)
+
+// createBatch bundles the selected proposals or the pasted messages into a
+// batch in send order
+func (nc *NetworkControl) createBatch(c echo.Context) error {
+	if nc.store == nil {
+		return nc.printError(c, proposal.ErrBatchNotFound)
+	}
+
+	var msgs []*authset.Message
+	form, err := c.FormParams()
+	if err != nil {
+		return nc.printError(c, err)
+	}
+	for _, id := range form["proposal"] {
+		p, err := nc.store.Get(id)
+		if err != nil {
+			return nc.printError(c, err)
+		}
+		m, err := p.Decode()
+		if err != nil {
+			return nc.printError(c, err)
+		}
+		msgs = append(msgs, m)
+	}
+	for _, line := range strings.Fields(c.FormValue("messages")) {
+		m, err := authset.DecodeHex(line)
+		if err != nil {
+			return nc.printError(c, err)
+		}
+		msgs = append(msgs, m)
+	}
+
+	auth, err := nc.ac.Get()
+	if err != nil {
+		return nc.printError(c, err)
+	}
+
+	b, err := nc.saveBatch(c, msgs, auth)
+	if err != nil {
+		return nc.printError(c, err)
+	}
+
+	return c.Redirect(http.StatusSeeOther, "/batch/"+b.ID)
+}
+
+// saveBatch stores the messages as a batch in send order and records it in
+// the audit log
+func (nc *NetworkControl) saveBatch(c echo.Context, msgs []*authset.Message, auth []*factom.Authority) (*proposal.Batch, error) {
+	b, err := nc.store.SaveBatch(authset.SendOrder(msgs, auth))
+	r := audit.Record{Action: audit.BatchCreate}
+	if b != nil {
+		r.Batch = b.ID
+	}
+	nc.record(c, r, err)
+	return b, err
+}
+
+// loadBatch returns the batch and its messages in send order
+func (nc *NetworkControl) loadBatch(id string) (*proposal.Batch, []*proposal.Proposal, []*authset.Message, error) {
+	if nc.store == nil {
+		return nil, nil, nil, proposal.ErrBatchNotFound
+	}
+
+	b, err := nc.store.GetBatch(id)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	props, msgs, err := nc.store.Members(b)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return b, props, msgs, nil
+}
+
+// batchView is the data of the batch page
+type batchView struct {
+	ID     string
+	Status string
+	// Messages are the messages in send order
+	Messages   []batchMessageRow
+	Info       []string
+	Errors     []string
+	Simulation *simulationView
+	Done       bool
+	Sendable   bool
+	ServerKey  string
+	// Payloads are the signing hashes of the messages that still take
+	// signatures, one per line
+	Payloads string
+	Rows     int
+}
+
+type batchMessageRow struct {
+	N          int
+	ProposalID string
+	Type       string
+	ChainID    string
+	Change     string
+	Signatures string
+	Status     string
+}
+
+func (nc *NetworkControl) batch(c echo.Context) error {
+	b, props, msgs, err := nc.loadBatch(c.Param("id"))
+	if err != nil {
+		return nc.printError(c, err)
+	}
+
+	auth, err := nc.ac.Get()
+	if err != nil {
+		return nc.printError(c, err)
+	}
+
+	// messages that were already applied are part of the authority set
+	first := 0
+	if b.Status == proposal.BatchSending {
+		first = b.Next
+	}
+	report := nc.validateBatch(msgs[first:], auth, time.Now())
+	reports := make(map[string]*authset.Report)
+	for i, m := range report.Order {
+		reports[m.Hash()] = report.Reports[i]
+	}
+
+	v := batchView{
+		ID:         b.ID,
+		Status:     batchStatusText(b),
+		Simulation: newSimulationView(report.Simulation),
+		Done:       b.Status == proposal.BatchDone,
+		Sendable:   b.Status == proposal.BatchDraft || b.Status == proposal.BatchFailed,
+	}
+
+	for i, m := range msgs {
+		row := batchMessageRow{
+			N:          i + 1,
+			ProposalID: props[i].ID,
+			Type:       m.TypeName(),
+			ChainID:    m.ChainID,
+			Change:     m.ServerType.String(),
+			Signatures: "applied",
+			Status:     statusText(props[i]),
+		}
+		if m.KeyChange != nil {
+			row.Change = m.KeyChange.Kind.String()
+		}
+		if rep, ok := reports[m.Hash()]; ok {
+			row.Signatures = fmt.Sprintf("%d of %d", rep.Signers, rep.Required)
+		}
+		v.Messages = append(v.Messages, row)
+	}
+
+	v.Errors = append(v.Errors, report.Errors...)
+	for i, rep := range report.Reports {
+		for _, s := range rep.Info {
+			v.Info = append(v.Info, fmt.Sprintf("Step %d: %s", first+i+1, s))
+		}
+		for _, e := range rep.Errors {
+			v.Errors = append(v.Errors, fmt.Sprintf("Step %d: %s", first+i+1, e))
+		}
+	}
+
+	if nc.key != nil {
+		v.ServerKey = nc.key.Pub.String()
+	}
+	var hashes []string
+	for _, m := range msgs[first:] {
+		hashes = append(hashes, hex.EncodeToString(m.SigningHash))
+	}
+	v.Payloads = strings.Join(hashes, "\n")
+	v.Rows = len(hashes) + 1
+
+	return nc.render(c, http.StatusOK, "batch", v)
+}
+
+// batchSignable returns the messages of the batch that still take signatures
+func batchSignable(b *proposal.Batch, msgs []*authset.Message) []*authset.Message {
+	if b.Status == proposal.BatchSending {
+		return msgs[b.Next:]
+	}
+	return msgs
+}
+
+func (nc *NetworkControl) batchSignKey(c echo.Context) error {
+	if nc.key == nil {
+		return nc.printError(c, errors.New("no signing key loaded"))
+	}
+
+	r := audit.Record{Action: audit.BatchSign, Batch: c.Param("id"), Signer: nc.key.Pub.String()}
+	if err := nc.checkSigner(c, nc.key.Pub[:]); err != nil {
+		nc.record(c, r, err)
+		return nc.printError(c, err)
+	}
+
+	b, _, msgs, err := nc.loadBatch(c.Param("id"))
+	if err != nil {
+		return nc.printError(c, err)
+	}
+
+	auth, err := nc.ac.Get()
+	if err != nil {
+		return nc.printError(c, err)
+	}
+
+	for _, m := range batchSignable(b, msgs) {
+		if m.SignedBy(nc.key.Pub[:]) {
+			continue
+		}
+		r.Message = m.Hash()
+		signed, _, err := authset.SignAsAuthority(m, nc.key, auth)
+		if err == nil {
+			_, err = nc.store.Save(signed)
+		}
+		nc.record(c, r, err)
+		if err != nil {
+			return nc.printError(c, err)
+		}
+	}
+
+	return c.Redirect(http.StatusSeeOther, "/batch/"+b.ID)
+}
+
+func (nc *NetworkControl) batchSign(c echo.Context) error {
+	b, _, msgs, err := nc.loadBatch(c.Param("id"))
+	if err != nil {
+		return nc.printError(c, err)
+	}
+
+	pubkey, err := hex.DecodeString(strings.TrimSpace(c.FormValue("pubkey")))
+	if err != nil {
+		return nc.printError(c, err)
+	}
+
+	r := audit.Record{Action: audit.BatchSign, Batch: b.ID, Signer: hex.EncodeToString(pubkey)}
+	if err := nc.checkSigner(c, pubkey); err != nil {
+		nc.record(c, r, err)
+		return nc.printError(c, err)
+	}
+
+	signable := batchSignable(b, msgs)
+	sigs := strings.Fields(c.FormValue("sigs"))
+	if len(sigs) != len(signable) {
+		return nc.printError(c, fmt.Errorf("expected %d signatures, got %d", len(signable), len(sigs)))
+	}
+
+	// check all signatures before saving any of them
+	var signed []*authset.Message
+	for i, m := range signable {
+		sig, err := hex.DecodeString(sigs[i])
+		if err != nil {
+			return nc.printError(c, err)
+		}
+		if m.SignedBy(pubkey) {
+			continue
+		}
+		s, err := authset.AddSignature(m, pubkey, sig)
+		if err != nil {
+			err = fmt.Errorf("signature %d: %v", i+1, err)
+			r.Message = m.Hash()
+			nc.record(c, r, err)
+			return nc.printError(c, err)
+		}
+		signed = append(signed, s)
+	}
+
+	for _, m := range signed {
+		r.Message = m.Hash()
+		_, err := nc.store.Save(m)
+		nc.record(c, r, err)
+		if err != nil {
+			return nc.printError(c, err)
+		}
+	}
+
+	return c.Redirect(http.StatusSeeOther, "/batch/"+b.ID)
+}
+
+func (nc *NetworkControl) batchSend(c echo.Context) error {
+	if nc.store == nil {
+		return nc.printError(c, proposal.ErrBatchNotFound)
+	}
+
+	b, err := nc.startBatch(c, c.Param("id"))
+	nc.record(c, audit.Record{Action: audit.BatchSend, Batch: c.Param("id")}, err)
+	if err != nil {
+		return nc.printError(c, err)
+	}
+
+	return c.Redirect(http.StatusSeeOther, "/batch/"+b.ID)
+}
+
+// startBatch starts sending the batch and sends the first message that
+// wasn't applied yet as an action of the user
+func (nc *NetworkControl) startBatch(c echo.Context, id string) (*proposal.Batch, error) {
+	b, err := nc.store.GetBatch(id)
+	if err != nil {
+		return nil, err
+	}
+	if b.Status == proposal.BatchSending || b.Status == proposal.BatchDone {
+		return nil, errors.New("the batch was already sent")
+	}
+
+	if _, err = nc.store.StartBatch(b.ID); err != nil {
+		return nil, err
+	}
+	send := func(m *authset.Message) error { return nc.sendChecked(c, m) }
+	if err := nc.tracker.AdvanceWith(b.ID, send); err != nil {
+		return nil, err
+	}
+	return nc.store.GetBatch(b.ID)
+}
+
+func (nc *NetworkControl) deleteBatch(c echo.Context) error {
+	if nc.store == nil {
+		return nc.printError(c, proposal.ErrBatchNotFound)
+	}
+
+	err := nc.store.DeleteBatch(c.Param("id"))
+	nc.record(c, audit.Record{Action: audit.BatchDelete, Batch: c.Param("id")}, err)
+	if err != nil {
+		return nc.printError(c, err)
+	}
+
+	return c.Redirect(http.StatusSeeOther, "/")
+}
+
+// sendChecked checks the message against the current authority set and sends
+// it. The tracker calls it for the next message of a batch once the previous
+// one was applied, and for scheduled proposals once they are due, with a nil
+// context, so the send is recorded as an action of the server. Starting a
+// batch passes the context of the user.
+func (nc *NetworkControl) sendChecked(c echo.Context, m *authset.Message) error {
+	auth, err := nc.ac.Get()
+	if err != nil {
+		return err
+	}
+
+	report := nc.validate(m, auth, time.Now())
+	if !report.OK() {
+		err = errors.New(strings.Join(report.Errors, "; "))
+	} else {
+		_, _, err = nc.sendMessage(m)
+	}
+	nc.record(c, audit.Record{Action: audit.Send, Message: m.Hash()}, err)
+	return err
+}
+
+// batchRow is a batch in the list on the index page
+type batchRow struct {
+	ID       string
+	Messages int
+	Status   string
+	Updated  string
+}
+
+// batchRows returns the list of stored batches
+func (nc *NetworkControl) batchRows() ([]batchRow, error) {
+	list, err := nc.store.Batches()
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []batchRow
+	for _, b := range list {
+		rows = append(rows, batchRow{
+			ID:       b.ID,
+			Messages: len(b.Proposals),
+			Status:   batchStatusText(b),
+			Updated:  b.Updated.Format("2006-01-02 15:04:05"),
+		})
+	}
+	return rows, nil
+}
@@ -0,0 +1,77 @@
+package networkcontrol
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/WhoSoup/factom-networkcontrol/authset"
+	"github.com/WhoSoup/factom-networkcontrol/qr"
+	"github.com/labstack/echo/v4"
+)
+
+// decodeInput decodes a hex message or a bundle, either directly or as
+// scanned QR frames. Bundles for a different network are rejected.
+func (nc *NetworkControl) decodeInput(data []byte) (*authset.Message, error) {
+	if qr.IsFrame(string(data)) {
+		var err error
+		if data, err = qr.JoinText(data); err != nil {
+			return nil, err
+		}
+	}
+
+	m, b, err := authset.DecodeInput(data)
+	if err != nil {
+		return nil, err
+	}
+	if b != nil && b.Network != "" {
+		id, err := authset.ParseNetworkID(b.Network)
+		if err != nil {
+			return nil, err
+		}
+		if id != nc.profile.Network {
+			return nil, fmt.Errorf("the bundle is for network %s but the control panel is connected to %s (%s)", id, nc.profile.Name, nc.profile.Network)
+		}
+	}
+	return m, nil
+}
+
+// formInput returns the message of the form field, or of the uploaded file
+// if the field is empty
+func formInput(c echo.Context, field string) ([]byte, error) {
+	if v := c.FormValue(field); v != "" {
+		return []byte(v), nil
+	}
+
+	fh, err := c.FormFile("bundle")
+	if err != nil {
+		return nil, fmt.Errorf("no message or bundle file given")
+	}
+	f, err := fh.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ioutil.ReadAll(f)
+}
+
+// bundle downloads the message as a bundle file
+func (nc *NetworkControl) bundle(c echo.Context) error {
+	m, err := authset.DecodeHex(c.FormValue("fullmsg"))
+	if err != nil {
+		return nc.printError(c, err)
+	}
+
+	data, err := authset.NewBundle(m, nc.profile.Network.String()).Encode()
+	if err != nil {
+		return nc.printError(c, err)
+	}
+
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s.json"`, bundleName(m)))
+	return c.Blob(http.StatusOK, echo.MIMEApplicationJSONCharsetUTF8, data)
+}
+
+// bundleName is the file name of a bundle without extension
+func bundleName(m *authset.Message) string {
+	return fmt.Sprintf("authset-%s-%.8s", m.ChainID[len(m.ChainID)-8:], m.Hash())
+}
@@ -0,0 +1,349 @@
+package networkcontrol
+
+import (
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/WhoSoup/factom-networkcontrol/authset"
+)
+
+// Settings are the startup settings of the control panel. They are read from
+// the defaults, the config file and the environment, in that order, and can
+// be overridden by command line flags.
+type Settings struct {
+	// Listen is the address the web server listens on
+	Listen string
+	// TLSCert and TLSKey enable https if both are set
+	TLSCert string
+	TLSKey  string
+	// LogFormat is "text" or "json"
+	LogFormat string
+	// Templates is a directory with templates that replace the built-in ones
+	Templates string
+
+	// Network is the name of the profile to use
+	Network string
+	// Factomd and Quorum override the settings of the profile if set
+	Factomd string
+	Quorum  string
+	// Profiles are the built-in profiles and those of the config file
+	Profiles map[string]*Profile
+
+	// DB is the path of the proposal database
+	DB string
+	// Audit is the path of the audit log
+	Audit string
+	// Snapshot is an authority set snapshot to use instead of the API
+	Snapshot string
+	// Key is a block signing key file
+	Key string
+	// Users are the operator accounts. Without any, there is no login.
+	Users map[string]*User
+	// Operators are the names of the authority operators by identity chain
+	Operators map[string]*Operator
+	// SessionTTL is how long a login lasts
+	SessionTTL time.Duration
+	// CacheTTL is how long the authority set is cached
+	CacheTTL time.Duration
+	// IdentityTTL is how often the identity chains are read again
+	IdentityTTL time.Duration
+
+	// URL is the public address of the control panel for links in
+	// notifications
+	URL string
+	// Mail is the SMTP server for notification mails
+	Mail MailSettings
+}
+
+// configFile is the layout of the TOML config file
+type configFile struct {
+	Server struct {
+		Listen    string
+		TLSCert   string `toml:"tls-cert"`
+		TLSKey    string `toml:"tls-key"`
+		LogFormat string `toml:"log-format"`
+		Templates string
+		Network   string
+	}
+	Storage struct {
+		DB       string
+		Audit    string
+		Snapshot string
+	}
+	Auth struct {
+		Key     string
+		Session string
+	}
+	Cache struct {
+		TTL      string
+		Identity string
+	}
+	Notify struct {
+		URL          string
+		SMTP         string
+		SMTPUser     string `toml:"smtp-user"`
+		SMTPPassword string `toml:"smtp-password"`
+		From         string
+	}
+	Profile  map[string]*profileSection
+	User     map[string]*userSection
+	Operator map[string]*operatorSection
+}
+
+// envPrefix starts the names of all environment variables
+const envPrefix = "NC_"
+
+// DefaultSettings returns the settings used when nothing else is configured
+func DefaultSettings() *Settings {
+	s := new(Settings)
+	s.Listen = ":8081"
+	s.LogFormat = "text"
+	s.Network = "mainnet"
+	s.Profiles = DefaultProfiles()
+	s.DB = "networkcontrol.db"
+	s.Audit = "networkcontrol-audit.jsonl"
+	s.CacheTTL = 5 * time.Second
+	s.IdentityTTL = 10 * time.Minute
+	s.SessionTTL = 12 * time.Hour
+	return s
+}
+
+// LoadSettings reads the config file on top of the defaults and then applies
+// the NC_* variables of the environment. An empty path skips the file. The
+// lookup function is usually os.LookupEnv.
+func LoadSettings(path string, lookup func(string) (string, bool)) (*Settings, error) {
+	s := DefaultSettings()
+
+	if path != "" {
+		var cfg configFile
+		md, err := toml.DecodeFile(path, &cfg)
+		if err != nil {
+			return nil, err
+		}
+		// a misspelled setting would silently keep its default otherwise
+		if keys := md.Undecoded(); len(keys) > 0 {
+			names := make([]string, len(keys))
+			for i, k := range keys {
+				names[i] = k.String()
+			}
+			return nil, fmt.Errorf("%s: unknown settings %s", path, strings.Join(names, ", "))
+		}
+		if err := s.applyFile(&cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	if lookup == nil {
+		return s, nil
+	}
+	for _, v := range []struct {
+		name string
+		dst  *string
+	}{
+		{"LISTEN", &s.Listen},
+		{"TLS_CERT", &s.TLSCert},
+		{"TLS_KEY", &s.TLSKey},
+		{"LOG_FORMAT", &s.LogFormat},
+		{"TEMPLATES", &s.Templates},
+		{"NETWORK", &s.Network},
+		{"FACTOMD", &s.Factomd},
+		{"QUORUM", &s.Quorum},
+		{"DB", &s.DB},
+		{"AUDIT", &s.Audit},
+		{"SNAPSHOT", &s.Snapshot},
+		{"KEY", &s.Key},
+		{"URL", &s.URL},
+		{"SMTP", &s.Mail.Server},
+		{"SMTP_USER", &s.Mail.User},
+		{"SMTP_PASSWORD", &s.Mail.Password},
+		{"MAIL_FROM", &s.Mail.From},
+	} {
+		if val, ok := lookup(envPrefix + v.name); ok {
+			*v.dst = val
+		}
+	}
+	for _, v := range []struct {
+		name string
+		dst  *time.Duration
+	}{
+		{"CACHE_TTL", &s.CacheTTL},
+		{"IDENTITY_TTL", &s.IdentityTTL},
+		{"SESSION_TTL", &s.SessionTTL},
+	} {
+		if val, ok := lookup(envPrefix + v.name); ok {
+			d, err := time.ParseDuration(val)
+			if err != nil {
+				return nil, fmt.Errorf("%s%s: %v", envPrefix, v.name, err)
+			}
+			*v.dst = d
+		}
+	}
+	return s, nil
+}
+
+func (s *Settings) applyFile(cfg *configFile) error {
+	set := func(dst *string, val string) {
+		if val != "" {
+			*dst = val
+		}
+	}
+	set(&s.Listen, cfg.Server.Listen)
+	set(&s.TLSCert, cfg.Server.TLSCert)
+	set(&s.TLSKey, cfg.Server.TLSKey)
+	set(&s.LogFormat, cfg.Server.LogFormat)
+	set(&s.Templates, cfg.Server.Templates)
+	set(&s.Network, cfg.Server.Network)
+	set(&s.DB, cfg.Storage.DB)
+	set(&s.Audit, cfg.Storage.Audit)
+	set(&s.Snapshot, cfg.Storage.Snapshot)
+	set(&s.Key, cfg.Auth.Key)
+	set(&s.URL, cfg.Notify.URL)
+	set(&s.Mail.Server, cfg.Notify.SMTP)
+	set(&s.Mail.User, cfg.Notify.SMTPUser)
+	set(&s.Mail.Password, cfg.Notify.SMTPPassword)
+	set(&s.Mail.From, cfg.Notify.From)
+
+	for _, v := range []struct {
+		name string
+		val  string
+		dst  *time.Duration
+	}{
+		{"cache ttl", cfg.Cache.TTL, &s.CacheTTL},
+		{"cache identity", cfg.Cache.Identity, &s.IdentityTTL},
+		{"auth session", cfg.Auth.Session, &s.SessionTTL},
+	} {
+		if v.val == "" {
+			continue
+		}
+		d, err := time.ParseDuration(v.val)
+		if err != nil {
+			return fmt.Errorf("%s: %v", v.name, err)
+		}
+		*v.dst = d
+	}
+
+	users, err := loadUsers(cfg.User)
+	if err != nil {
+		return err
+	}
+	s.Users = users
+
+	operators, err := loadOperators(cfg.Operator)
+	if err != nil {
+		return err
+	}
+	s.Operators = operators
+
+	return applyProfiles(s.Profiles, cfg.Profile)
+}
+
+// Profile returns the selected network profile with the factomd and quorum
+// overrides applied
+func (s *Settings) Profile() (*Profile, error) {
+	p, ok := s.Profiles[s.Network]
+	if !ok {
+		return nil, fmt.Errorf("unknown network profile %q, available: %s", s.Network, strings.Join(ProfileNames(s.Profiles), ", "))
+	}
+
+	cp := *p
+	if s.Factomd != "" {
+		cp.Factomd = s.Factomd
+	}
+	if s.Quorum != "" {
+		rule, err := authset.ParseQuorumRule(s.Quorum)
+		if err != nil {
+			return nil, err
+		}
+		cp.Quorum = rule
+	}
+	return &cp, nil
+}
+
+// Check validates the settings and returns every problem found. Files are
+// checked for existence but not opened, apart from the signing key and the
+// templates.
+func (s *Settings) Check() []error {
+	var errs []error
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if _, _, err := net.SplitHostPort(s.Listen); err != nil {
+		fail("listen address %q: %v", s.Listen, err)
+	}
+	if (s.TLSCert == "") != (s.TLSKey == "") {
+		fail("tls needs both a certificate and a key")
+	}
+	for name, f := range map[string]string{"tls certificate": s.TLSCert, "tls key": s.TLSKey, "snapshot": s.Snapshot} {
+		if f == "" {
+			continue
+		}
+		if _, err := os.Stat(f); err != nil {
+			fail("%s: %v", name, err)
+		}
+	}
+	if s.LogFormat != "text" && s.LogFormat != "json" {
+		fail("log format %q must be text or json", s.LogFormat)
+	}
+	if s.Templates != "" {
+		if _, err := LoadTemplates(s.Templates); err != nil {
+			fail("templates: %v", err)
+		}
+	}
+
+	if _, err := s.Profile(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if s.DB == "" {
+		fail("the database path is empty")
+	} else if fi, err := os.Stat(filepath.Dir(s.DB)); err != nil || !fi.IsDir() {
+		fail("the directory of database %q does not exist", s.DB)
+	}
+	if s.Audit == "" {
+		fail("the audit log path is empty")
+	} else if fi, err := os.Stat(filepath.Dir(s.Audit)); err != nil || !fi.IsDir() {
+		fail("the directory of audit log %q does not exist", s.Audit)
+	}
+	if s.Key != "" {
+		if _, err := authset.LoadKey(s.Key); err != nil {
+			fail("signing key %q: %v", s.Key, err)
+		}
+	}
+	if s.CacheTTL <= 0 {
+		fail("cache ttl must be positive")
+	}
+	if s.IdentityTTL <= 0 {
+		fail("identity ttl must be positive")
+	}
+	if s.SessionTTL <= 0 {
+		fail("session ttl must be positive")
+	}
+
+	if s.URL != "" {
+		if u, err := url.Parse(s.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			fail("notify url %q has to be a http or https url", s.URL)
+		}
+	}
+	if s.Mail.Server != "" {
+		if _, _, err := net.SplitHostPort(s.Mail.Server); err != nil {
+			fail("smtp server %q: %v", s.Mail.Server, err)
+		}
+		if _, err := mail.ParseAddress(s.Mail.From); err != nil {
+			fail("mail from %q: %v", s.Mail.From, err)
+		}
+	}
+	for chain, op := range s.Operators {
+		if op.Subscription != nil && len(op.Subscription.Email) > 0 && s.Mail.Server == "" {
+			fail("operator %q subscribed by email, but no smtp server is configured", chain)
+		}
+	}
+	return errs
+}
@@ -0,0 +1,152 @@
+package networkcontrol
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/WhoSoup/factom-networkcontrol/authset"
+)
+
+// writeConfig writes the config file into a temporary directory
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "networkcontrol.conf")
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// env is a lookup function for LoadSettings
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		v, ok := vars[name]
+		return v, ok
+	}
+}
+
+func TestLoadSettings(t *testing.T) {
+	path := writeConfig(t, `
+[server]
+listen = "127.0.0.1:9000"
+log-format = "json"
+network = "devnet"
+
+[storage]
+db = "/var/lib/nc/proposals.db"
+
+[cache]
+ttl = "30s"
+
+[profile.devnet]
+factomd = "localhost:8088"
+network = "custom:devnet"
+quorum = "2of3"
+window = "30m"
+
+[profile.mainnet]
+factomd = "https://mainnet.example.com"
+
+[operator."`+testChain(0)+`"]
+name = "Example Nodes"
+`)
+
+	s, err := LoadSettings(path, env(map[string]string{
+		"NC_LISTEN":    ":8090",
+		"NC_CACHE_TTL": "1m",
+		"NC_OTHER":     "ignored",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the environment wins over the file, the file over the defaults
+	if s.Listen != ":8090" {
+		t.Errorf("listen = %q, want the environment", s.Listen)
+	}
+	if s.CacheTTL != time.Minute {
+		t.Errorf("cache ttl = %s, want the environment", s.CacheTTL)
+	}
+	if s.LogFormat != "json" || s.DB != "/var/lib/nc/proposals.db" {
+		t.Errorf("log format %q and db %q are not the ones of the file", s.LogFormat, s.DB)
+	}
+	if s.Audit != DefaultSettings().Audit || s.SessionTTL != DefaultSettings().SessionTTL {
+		t.Errorf("audit %q and session ttl %s lost their defaults", s.Audit, s.SessionTTL)
+	}
+	if op := s.Operators[testChain(0)]; op == nil || op.Name != "Example Nodes" {
+		t.Errorf("operators = %v", s.Operators)
+	}
+
+	p, err := s.Profile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "devnet" || p.Window != 30*time.Minute {
+		t.Errorf("profile = %+v", p)
+	}
+	if want, _ := authset.ParseQuorumRule("2of3"); p.Quorum != want {
+		t.Errorf("quorum = %s, want %s", p.Quorum, want)
+	}
+	if want, _ := authset.ParseNetworkID("custom:devnet"); p.Network != want {
+		t.Errorf("network = %s, want custom:devnet", p.Network)
+	}
+
+	// a built-in profile is only changed where the file sets something
+	main := s.Profiles["mainnet"]
+	if main.Factomd != "https://mainnet.example.com" || main.Network != authset.MainNet || main.Window != authset.TimestampWindow {
+		t.Errorf("mainnet = %+v", main)
+	}
+}
+
+func TestLoadSettingsErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		env    map[string]string
+		want   string
+	}{
+		{"unknown setting", "[server]\nlisten = \":80\"\nlisen = \":81\"\n", nil, "server.lisen"},
+		{"unknown section", "[servers]\nlisten = \":80\"\n", nil, "servers"},
+		{"not toml", "listen: 80\n", nil, ""},
+		{"invalid duration", "[cache]\nttl = \"soon\"\n", nil, "cache ttl"},
+		{"new profile without network", "[profile.dev]\nfactomd = \"localhost:8088\"\n", nil, "factomd and network are required"},
+		{"invalid window", "[profile.mainnet]\nwindow = \"-1h\"\n", nil, "invalid window"},
+		{"invalid role", "[user.alice]\npassword = \"x\"\nrole = \"admin\"\n", nil, "invalid role"},
+		{"invalid environment duration", "", map[string]string{"NC_SESSION_TTL": "a day"}, "NC_SESSION_TTL"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := ""
+			if tt.config != "" {
+				path = writeConfig(t, tt.config)
+			}
+			_, err := LoadSettings(path, env(tt.env))
+			if err == nil {
+				t.Fatal("no error")
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error %q does not mention %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSettingsCheck(t *testing.T) {
+	s := DefaultSettings()
+	if errs := s.Check(); len(errs) != 0 {
+		t.Errorf("the defaults have problems: %v", errs)
+	}
+
+	s.Listen = "8081"
+	s.TLSCert = "cert.pem"
+	s.LogFormat = "xml"
+	s.Network = "moon"
+	s.CacheTTL = 0
+	s.Mail.Server = "smtp.example.com:25"
+	if errs := s.Check(); len(errs) < 6 {
+		t.Errorf("found %d problems, want every one: %v", len(errs), errs)
+	}
+}
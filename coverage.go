@@ -0,0 +1,172 @@
+package networkcontrol
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/FactomProject/factom"
+	"github.com/WhoSoup/factom-networkcontrol/authset"
+	"github.com/WhoSoup/factom-networkcontrol/proposal"
+	"github.com/labstack/echo/v4"
+)
+
+// coverageRow is an authority and whether it signed the proposal
+type coverageRow struct {
+	// Authority is the identity chain id, empty for keys outside the
+	// authority set
+	Authority string
+	Operator  *Operator
+	// Role is "federated" or "audit", empty for keys outside the authority set
+	Role   string
+	PubKey string
+	// State is "signed", "unsigned", "invalid" or "not an authority"
+	State  string
+	Counts bool
+
+	state authset.SignatureState
+}
+
+// coverageView is the data of the coverage page
+type coverageView struct {
+	ID      string
+	Summary string
+	Rule    string
+	// Signers is the number of signatures that count towards the quorum and
+	// Needed how many are still missing
+	Signers  int
+	Required int
+	Needed   int
+	// Closes is the end of the timestamp window and Left the time until then,
+	// or since then if the window is Closed
+	Closes time.Time
+	Left   time.Duration
+	Closed bool
+	// Role and Sort are the filter and sort order of the rows
+	Role    string
+	Sort    string
+	Filters []string
+	Sorts   []string
+	Rows    []coverageRow
+}
+
+// coverageFilters are the values of the role filter
+var coverageFilters = []string{"all", "federated", "audit"}
+
+// coverageSorts are the values of the sort order
+var coverageSorts = []string{"chain", "state", "role"}
+
+// newCoverageView lists the signature state of every authority for the
+// message. role is "all", "federated" or "audit" and by is "chain", "state"
+// or "role". Keys outside the authority set are only listed for "all".
+func (nc *NetworkControl) newCoverageView(id string, m *authset.Message, auth []*factom.Authority, role, by string) (*coverageView, error) {
+	if role == "" {
+		role = "all"
+	}
+	if by == "" {
+		by = "chain"
+	}
+	if !contains(coverageFilters, role) {
+		return nil, fmt.Errorf("invalid role %q, must be one of %v", role, coverageFilters)
+	}
+	if !contains(coverageSorts, by) {
+		return nil, fmt.Errorf("invalid sort %q, must be one of %v", by, coverageSorts)
+	}
+
+	rule := nc.profile.Quorum.ForMessage(m)
+	v := &coverageView{
+		ID:      id,
+		Summary: authset.Summary(m),
+		Rule:    rule.String(),
+		Closes:  m.Timestamp.Add(nc.profile.Window),
+		Role:    role,
+		Sort:    by,
+		Filters: coverageFilters,
+		Sorts:   coverageSorts,
+	}
+	v.Left = time.Until(v.Closes).Round(time.Second)
+	if v.Left < 0 {
+		v.Closed, v.Left = true, -v.Left
+	}
+	v.Signers, v.Required = rule.Tally(m, auth)
+	if v.Signers < v.Required {
+		v.Needed = v.Required - v.Signers
+	}
+
+	for _, cv := range authset.SignatureCoverage(m, auth, nc.profile.Quorum) {
+		row := coverageRow{PubKey: cv.PubKey, State: cv.State.String(), Counts: cv.Counts, state: cv.State}
+		if a := cv.Authority; a != nil {
+			row.Authority = a.AuthorityChainID
+			row.Operator = nc.operators[a.AuthorityChainID]
+			row.Role = a.Status
+		}
+		if role != "all" && row.Role != role {
+			continue
+		}
+		v.Rows = append(v.Rows, row)
+	}
+
+	sort.SliceStable(v.Rows, func(i, j int) bool {
+		a, b := v.Rows[i], v.Rows[j]
+		switch by {
+		case "state":
+			if a.state != b.state {
+				return a.state < b.state
+			}
+		case "role":
+			if a.Role != b.Role {
+				// federated first, keys outside the set last
+				return a.Role != "" && (b.Role == "" || a.Role > b.Role)
+			}
+		}
+		if a.Authority != b.Authority {
+			// keys outside the set last
+			return a.Authority != "" && (b.Authority == "" || a.Authority < b.Authority)
+		}
+		return a.PubKey < b.PubKey
+	})
+	return v, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+// loadProposal returns the stored proposal and its decoded message
+func (nc *NetworkControl) loadProposal(id string) (*proposal.Proposal, *authset.Message, error) {
+	if nc.store == nil {
+		return nil, nil, proposal.ErrNotFound
+	}
+	p, err := nc.store.Get(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	m, err := p.Decode()
+	if err != nil {
+		return nil, nil, err
+	}
+	return p, m, nil
+}
+
+func (nc *NetworkControl) coverage(c echo.Context) error {
+	p, m, err := nc.loadProposal(c.Param("id"))
+	if err != nil {
+		return nc.printError(c, err)
+	}
+	auth, err := nc.ac.Get()
+	if err != nil {
+		return nc.printError(c, err)
+	}
+
+	v, err := nc.newCoverageView(p.ID, m, auth, c.QueryParam("role"), c.QueryParam("sort"))
+	if err != nil {
+		return nc.printError(c, err)
+	}
+	return nc.render(c, http.StatusOK, "coverage", v)
+}
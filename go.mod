@@ -1,13 +1,14 @@
 module github.com/WhoSoup/factom-networkcontrol
 
-go 1.14
+go 1.16
 
 require (
+	github.com/BurntSushi/toml v1.3.2
 	github.com/FactomProject/FactomCode v0.3.5 // indirect
 	github.com/FactomProject/basen v0.0.0-20150613233007-fe3947df716e // indirect
 	github.com/FactomProject/bolt v1.1.0 // indirect
 	github.com/FactomProject/btcd v0.3.5 // indirect
-	github.com/FactomProject/btcutil v0.0.0-20160826074221-43986820ccd5 // indirect
+	github.com/FactomProject/btcutil v0.0.0-20160826074221-43986820ccd5
 	github.com/FactomProject/btcutilecc v0.0.0-20130527213604-d3a63a5752ec // indirect
 	github.com/FactomProject/dynrsrc v0.3.1 // indirect
 	github.com/FactomProject/ed25519 v0.0.0-20150814230546-38002c4fe7b6 // indirect
@@ -29,7 +30,7 @@ require (
 	github.com/FactomProject/snappy-go v0.0.0-20170202213131-f2f83b22c29e // indirect
 	github.com/FactomProject/web v0.1.0 // indirect
 	github.com/bmizerany/assert v0.0.0-20160611221934-b7ed37b82869 // indirect
-	github.com/boltdb/bolt v1.3.1 // indirect
+	github.com/boltdb/bolt v1.3.1
 	github.com/btcsuitereleases/btcutil v0.0.0-20150612230727-f2b1058a8255 // indirect
 	github.com/cmars/basen v0.0.0-20150613233007-fe3947df716e // indirect
 	github.com/gogo/protobuf v1.3.1 // indirect
@@ -39,10 +40,13 @@ require (
 	github.com/kr/pretty v0.2.0 // indirect
 	github.com/labstack/echo/v4 v4.1.16
 	github.com/labstack/gommon v0.3.0 // indirect
+	github.com/makiuchi-d/gozxing v0.0.2
 	github.com/onsi/ginkgo v1.14.0 // indirect
 	github.com/prometheus/client_golang v1.7.1 // indirect
 	github.com/rs/cors v1.7.0 // indirect
 	github.com/sirupsen/logrus v1.6.0 // indirect
+	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
+	golang.org/x/crypto v0.0.0-20200221231518-2aa609cf4a9d
 	gopkg.in/gcfg.v1 v1.2.3 // indirect
 	gopkg.in/warnings.v0 v0.1.2 // indirect
 	launchpad.net/gocheck v0.0.0-20140225173054-000000000087 // indirect
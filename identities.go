@@ -0,0 +1,255 @@
+package networkcontrol
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/FactomProject/factom"
+	"github.com/WhoSoup/factom-networkcontrol/authset"
+	"github.com/WhoSoup/factom-networkcontrol/identity"
+	"github.com/labstack/echo/v4"
+)
+
+// Operator is the name and website of the operator of an authority. Server
+// identities have no name on chain, so they are set in the config file.
+type Operator struct {
+	Name string
+	Link string
+	// Subscription is where the operator is notified about proposals, nil if
+	// they are not
+	Subscription *Subscription
+}
+
+// operatorSection is an [operator."chain id"] table of the config file
+type operatorSection struct {
+	Name          string
+	Link          string
+	Email         []string
+	Webhook       string
+	WebhookSecret string `toml:"webhook-secret"`
+	Events        []string
+}
+
+// loadOperators turns the operator sections of the config file into
+// operators by identity chain id
+func loadOperators(sections map[string]*operatorSection) (map[string]*Operator, error) {
+	ops := make(map[string]*Operator)
+	for chain, sec := range sections {
+		if b, err := hex.DecodeString(chain); err != nil || len(b) != 32 {
+			return nil, fmt.Errorf("operator %q: invalid chain id", chain)
+		}
+		if sec.Name == "" {
+			return nil, fmt.Errorf("operator %q: the name is empty", chain)
+		}
+		if sec.Link != "" {
+			u, err := url.Parse(sec.Link)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+				return nil, fmt.Errorf("operator %q: the link has to be a http or https url", chain)
+			}
+		}
+		op := &Operator{Name: sec.Name, Link: sec.Link}
+		if len(sec.Email) > 0 || sec.Webhook != "" {
+			sub, err := loadSubscription(sec)
+			if err != nil {
+				return nil, fmt.Errorf("operator %q: %v", chain, err)
+			}
+			op.Subscription = sub
+		}
+		ops[strings.ToLower(chain)] = op
+	}
+	return ops, nil
+}
+
+// loadSubscription reads the notification settings of an operator section
+func loadSubscription(sec *operatorSection) (*Subscription, error) {
+	events, err := ParseEvents(sec.Events)
+	if err != nil {
+		return nil, err
+	}
+	sub := &Subscription{Webhook: sec.Webhook, Secret: sec.WebhookSecret, Events: events}
+	for _, addr := range sec.Email {
+		a, err := mail.ParseAddress(addr)
+		if err != nil {
+			return nil, fmt.Errorf("email %q: %v", addr, err)
+		}
+		sub.Email = append(sub.Email, a.Address)
+	}
+	if sub.Webhook != "" {
+		u, err := url.Parse(sub.Webhook)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return nil, errors.New("the webhook has to be a http or https url")
+		}
+	}
+	return sub, nil
+}
+
+// IdentityCache keeps the identities of the authorities. Reading an identity
+// takes a request for every entry of its chains, so they are read in the
+// background and pages only show what is cached. It is safe for concurrent
+// use.
+type IdentityCache struct {
+	source   identity.Source
+	interval time.Duration
+
+	mtx   sync.Mutex
+	cache map[string]*identity.Identity
+}
+
+func NewIdentityCache(source identity.Source, d time.Duration) *IdentityCache {
+	ic := new(IdentityCache)
+	ic.source = source
+	ic.interval = d
+	ic.cache = make(map[string]*identity.Identity)
+	return ic
+}
+
+// Run reads the identities of the current authorities every interval until
+// stop is closed
+func (ic *IdentityCache) Run(ac *AuthCache, stop <-chan struct{}) {
+	ticker := time.NewTicker(ic.interval)
+	defer ticker.Stop()
+
+	for {
+		if auth, err := ac.Get(); err != nil {
+			log.Printf("identities: %v", err)
+		} else {
+			for _, a := range auth {
+				if _, err := ic.Resolve(a.AuthorityChainID); err != nil {
+					log.Printf("identities: %v", err)
+				}
+			}
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Get returns the cached identity, or nil if it hasn't been read yet
+func (ic *IdentityCache) Get(chainID string) *identity.Identity {
+	ic.mtx.Lock()
+	defer ic.mtx.Unlock()
+	return ic.cache[chainID]
+}
+
+// Resolve reads the identity from its chains and updates the cache
+func (ic *IdentityCache) Resolve(chainID string) (*identity.Identity, error) {
+	id, err := identity.Resolve(ic.source, chainID)
+	if err != nil {
+		return nil, err
+	}
+	ic.mtx.Lock()
+	ic.cache[id.ChainID] = id
+	ic.mtx.Unlock()
+	return id, nil
+}
+
+// identityWarnings compares the identity with the authority set and returns
+// what is missing on chain or differs from the authority set
+func identityWarnings(id *identity.Identity, a *factom.Authority) []string {
+	var warn []string
+	if missing := id.Missing(); len(missing) > 0 {
+		warn = append(warn, "incomplete identity, missing "+strings.Join(missing, ", "))
+	}
+	if a == nil {
+		return warn
+	}
+	// the authority set has a zero hash for servers without a management chain
+	if id.ManagementChain != "" && strings.Trim(a.ManagementChainID, "0") != "" && id.ManagementChain != a.ManagementChainID {
+		warn = append(warn, fmt.Sprintf("the authority set has the management chain %s, the identity registered %s", a.ManagementChainID, id.ManagementChain))
+	}
+	if key := id.SigningKey(); key != "" && key != a.SigningKey {
+		warn = append(warn, fmt.Sprintf("the signing key of the authority set %s is not the latest one on chain %s", a.SigningKey, key))
+	}
+	for _, ak := range a.AnchorKeys {
+		if ak == nil {
+			continue
+		}
+		cur := id.AnchorKey(ak.KeyLevel)
+		if cur != nil && cur.Key != ak.SigningKey {
+			warn = append(warn, fmt.Sprintf("the anchor key of priority %d of the authority set %s is not the latest one on chain %s", ak.KeyLevel, ak.SigningKey, cur.Key))
+		}
+	}
+	return warn
+}
+
+// identityStatus is the short identity status of an authority for tables
+// and its warnings
+func (nc *NetworkControl) identityStatus(a *factom.Authority) (string, []string) {
+	id := nc.identities.Get(a.AuthorityChainID)
+	if id == nil {
+		return "not read yet", nil
+	}
+	warn := identityWarnings(id, a)
+	switch {
+	case !id.Complete():
+		return "incomplete", warn
+	case len(warn) > 0:
+		return "differs", warn
+	}
+	return "complete", nil
+}
+
+// identityView is the data of the identity page
+type identityView struct {
+	*identity.Identity
+	Operator  *Operator
+	Authority *factom.Authority
+	Warnings  []string
+	// EfficiencyPercent is the efficiency formatted as a percentage
+	EfficiencyPercent string
+}
+
+func (nc *NetworkControl) identityPage(c echo.Context) error {
+	chain := strings.ToLower(c.Param("chainid"))
+	if b, err := hex.DecodeString(chain); err != nil || len(b) != 32 {
+		return nc.printError(c, fmt.Errorf("invalid chain id %q", c.Param("chainid")))
+	}
+
+	id, err := nc.identities.Resolve(chain)
+	if err != nil {
+		return nc.printError(c, err)
+	}
+	a, err := nc.ac.GetSpecific(chain)
+	if err != nil {
+		return nc.printError(c, err)
+	}
+
+	v := identityView{Identity: id, Operator: nc.operators[chain], Authority: a, Warnings: identityWarnings(id, a)}
+	if id.Efficiency != nil {
+		v.EfficiencyPercent = formatEfficiency(*id.Efficiency)
+	}
+	return nc.render(c, http.StatusOK, "identity", v)
+}
+
+// formatEfficiency turns hundredths of a percent into a percentage
+func formatEfficiency(eff uint16) string {
+	return fmt.Sprintf("%d.%02d%%", eff/100, eff%100)
+}
+
+// validate runs the pre-send checks of authset.Validate and checks the
+// identity of servers that are added
+func (nc *NetworkControl) validate(m *authset.Message, auth []*factom.Authority, now time.Time) *authset.Report {
+	r := authset.Validate(m, auth, nc.profile.Quorum, nc.profile.Window, now)
+	authset.CheckIdentity(r, m, auth, nc.identities.source)
+	return r
+}
+
+// validateBatch runs the checks of authset.ValidateBatch and checks the
+// identity of servers that are added in every step
+func (nc *NetworkControl) validateBatch(msgs []*authset.Message, auth []*factom.Authority, now time.Time) *authset.BatchReport {
+	r := authset.ValidateBatch(msgs, auth, nc.profile.Quorum, nc.profile.Window, now)
+	authset.CheckBatchIdentity(r, auth, nc.identities.source)
+	return r
+}
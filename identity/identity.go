@@ -0,0 +1,307 @@
+// Package identity reads the server identities of authorities from their
+// identity chain and server management subchain
+package identity
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/FactomProject/factomd/common/factoid"
+	"github.com/FactomProject/factomd/common/identityEntries"
+	"github.com/FactomProject/factomd/common/interfaces"
+	"github.com/FactomProject/factomd/common/primitives"
+)
+
+// Identity is the on-chain server identity of an authority
+type Identity struct {
+	ChainID string
+	// Created is the height of the first entry of the identity chain, zero if
+	// the chain does not exist
+	Created uint32
+	// Keys are the identity keys of level 1 to 4. Management entries have to
+	// be signed with the level 1 key.
+	Keys []string
+	// ManagementChain is the server management subchain registered in the
+	// identity chain
+	ManagementChain string
+	// Registered is the height of the Register Server Management entry
+	Registered uint32
+	// ManagementCreated is the height of the first entry of the subchain
+	ManagementCreated uint32
+
+	// SigningKeys is the history of block signing keys, the last one is the
+	// current key
+	SigningKeys []KeyEntry
+	// AnchorKeys is the history of bitcoin anchor keys of all priorities
+	AnchorKeys []AnchorKeyEntry
+	// MatryoshkaHash is the latest outermost matryoshka hash
+	MatryoshkaHash *KeyEntry
+	// Efficiency is the latest server efficiency in hundredths of a percent
+	Efficiency *uint16
+	// Coinbase is the latest factoid address of the coinbase payouts
+	Coinbase string
+
+	// Problems are the reasons the identity is incomplete or entries that
+	// were ignored
+	Problems []string
+}
+
+// KeyEntry is a key that was set at a height
+type KeyEntry struct {
+	Key    string
+	Height uint32
+	// Time is the timestamp signed into the entry
+	Time time.Time
+}
+
+// AnchorKeyEntry is a bitcoin anchor key that was set at a height
+type AnchorKeyEntry struct {
+	KeyEntry
+	Priority byte
+	// Type is P2PKH or P2SH
+	Type string
+}
+
+// SigningKey returns the current block signing key, empty if none was set
+func (id *Identity) SigningKey() string {
+	if len(id.SigningKeys) == 0 {
+		return ""
+	}
+	return id.SigningKeys[len(id.SigningKeys)-1].Key
+}
+
+// AnchorKey returns the current bitcoin anchor key of the priority
+func (id *Identity) AnchorKey(priority byte) *AnchorKeyEntry {
+	var cur *AnchorKeyEntry
+	for i := range id.AnchorKeys {
+		if id.AnchorKeys[i].Priority == priority {
+			cur = &id.AnchorKeys[i]
+		}
+	}
+	return cur
+}
+
+// Complete returns true if the identity has everything a server needs: an
+// identity chain, a registered management subchain, a block signing key, an
+// anchor key and a matryoshka hash
+func (id *Identity) Complete() bool {
+	return id.Created > 0 && id.ManagementCreated > 0 && id.Registered > 0 &&
+		len(id.SigningKeys) > 0 && len(id.AnchorKeys) > 0 && id.MatryoshkaHash != nil
+}
+
+// Missing lists the entries the identity lacks to be complete
+func (id *Identity) Missing() []string {
+	if id.Created == 0 {
+		return []string{"the identity chain"}
+	}
+	if id.Registered == 0 {
+		return []string{"a Register Server Management entry in the identity chain"}
+	}
+	if id.ManagementCreated == 0 {
+		return []string{"the server management chain " + id.ManagementChain}
+	}
+
+	var missing []string
+	if len(id.SigningKeys) == 0 {
+		missing = append(missing, "a New Block Signing Key entry in the server management chain")
+	}
+	if len(id.AnchorKeys) == 0 {
+		missing = append(missing, "a New Bitcoin Key entry in the server management chain")
+	}
+	if id.MatryoshkaHash == nil {
+		missing = append(missing, "a New Matryoshka Hash entry in the server management chain")
+	}
+	return missing
+}
+
+// Resolve reads the identity chain and its server management subchain. Only
+// entries that are signed with the level 1 identity key count, the same as
+// factomd does. Entries that are ignored are listed in Problems.
+func Resolve(src Source, chainID string) (*Identity, error) {
+	chainID = strings.ToLower(chainID)
+	id := &Identity{ChainID: chainID}
+
+	entries, err := src.Entries(chainID)
+	if err != nil {
+		return nil, fmt.Errorf("identity chain %s: %v", chainID, err)
+	}
+	if len(entries) == 0 {
+		return id, nil
+	}
+
+	first := entries[0]
+	ic, err := identityEntries.DecodeIdentityChainStructureFromExtIDs(first.ExtIDs)
+	if err != nil {
+		id.problem(first, "the first entry is not an identity chain: %v", err)
+		return id, nil
+	}
+	if ic.GetChainID().String() != chainID {
+		id.problem(first, "the first entry is the identity chain %s", ic.GetChainID())
+		return id, nil
+	}
+	id.Created = first.Height
+	key1 := ic.Key1
+	for _, k := range []interfaces.IHash{ic.Key1, ic.Key2, ic.Key3, ic.Key4} {
+		id.Keys = append(id.Keys, k.String())
+	}
+
+	for _, e := range entries[1:] {
+		if !isFunction(e, "Register Server Management") {
+			continue
+		}
+		rsm, err := identityEntries.DecodeRegisterServerManagementStructureFromExtIDs(e.ExtIDs)
+		if err != nil {
+			id.problem(e, "invalid server management registration: %v", err)
+			continue
+		}
+		if err := rsm.VerifySignature(key1); err != nil {
+			id.problem(e, "server management registration: %v", err)
+			continue
+		}
+		if id.Registered > 0 {
+			id.problem(e, "the server management subchain is already registered")
+			continue
+		}
+		id.ManagementChain = rsm.SubchainChainID.String()
+		id.Registered = e.Height
+	}
+
+	if id.ManagementChain == "" {
+		return id, nil
+	}
+	sub, err := src.Entries(id.ManagementChain)
+	if err != nil {
+		return nil, fmt.Errorf("server management chain %s: %v", id.ManagementChain, err)
+	}
+	if len(sub) == 0 {
+		return id, nil
+	}
+	sm, err := identityEntries.DecodeServerManagementStructureFromExtIDs(sub[0].ExtIDs)
+	if err != nil {
+		id.problem(sub[0], "the first entry is not a server management chain: %v", err)
+		return id, nil
+	}
+	if sm.GetChainID().String() != id.ManagementChain {
+		id.problem(sub[0], "the first entry is the server management chain %s", sm.GetChainID())
+		return id, nil
+	}
+	if sm.RootIdentityChainID.String() != chainID {
+		id.problem(sub[0], "the server management chain belongs to identity %s", sm.RootIdentityChainID)
+		return id, nil
+	}
+	id.ManagementCreated = sub[0].Height
+
+	for _, e := range sub[1:] {
+		id.apply(e, key1)
+	}
+	return id, nil
+}
+
+// apply adds an entry of the server management subchain
+func (id *Identity) apply(e Entry, key1 interfaces.IHash) {
+	if len(e.ExtIDs) < 2 {
+		return
+	}
+	fn := string(e.ExtIDs[1])
+
+	type signed interface {
+		VerifySignature(interfaces.IHash) error
+	}
+	var (
+		entry signed
+		root  interfaces.IHash
+		ts    []byte
+		err   error
+	)
+	switch fn {
+	case "New Block Signing Key":
+		var s *identityEntries.NewBlockSigningKeyStruct
+		s, err = identityEntries.DecodeNewBlockSigningKeyStructFromExtIDs(e.ExtIDs)
+		if err == nil {
+			entry, root, ts = s, s.RootIdentityChainID, s.Timestamp
+		}
+	case "New Bitcoin Key":
+		var s *identityEntries.NewBitcoinKeyStructure
+		s, err = identityEntries.DecodeNewBitcoinKeyStructureFromExtIDs(e.ExtIDs)
+		if err == nil {
+			entry, root, ts = s, s.RootIdentityChainID, s.Timestamp
+		}
+	case "New Matryoshka Hash":
+		var s *identityEntries.NewMatryoshkaHashStructure
+		s, err = identityEntries.DecodeNewMatryoshkaHashStructureFromExtIDs(e.ExtIDs)
+		if err == nil {
+			entry, root, ts = s, s.RootIdentityChainID, s.Timestamp
+		}
+	case "Server Efficiency":
+		var s *identityEntries.NewServerEfficiencyStruct
+		s, err = identityEntries.DecodeNewServerEfficiencyStructFromExtIDs(e.ExtIDs)
+		if err == nil {
+			entry, root, ts = s, s.RootIdentityChainID, s.Timestamp
+		}
+	case "Coinbase Address":
+		var s *identityEntries.NewCoinbaseAddressStruct
+		s, err = identityEntries.DecodeNewNewCoinbaseAddressStructFromExtIDs(e.ExtIDs)
+		if err == nil {
+			entry, root, ts = s, s.RootIdentityChainID, s.Timestamp
+		}
+	default:
+		return
+	}
+
+	if err != nil {
+		id.problem(e, "invalid %s entry: %v", fn, err)
+		return
+	}
+	if root.String() != id.ChainID {
+		id.problem(e, "%s entry for identity %s", fn, root)
+		return
+	}
+	if err := entry.VerifySignature(key1); err != nil {
+		id.problem(e, "%s entry: %v", fn, err)
+		return
+	}
+
+	k := KeyEntry{Height: e.Height, Time: entryTime(ts)}
+	switch s := entry.(type) {
+	case *identityEntries.NewBlockSigningKeyStruct:
+		k.Key = hex.EncodeToString(s.NewPublicKey)
+		id.SigningKeys = append(id.SigningKeys, k)
+	case *identityEntries.NewBitcoinKeyStructure:
+		k.Key = hex.EncodeToString(s.NewKey[:])
+		typ := "P2PKH"
+		if s.KeyType == 1 {
+			typ = "P2SH"
+		}
+		id.AnchorKeys = append(id.AnchorKeys, AnchorKeyEntry{KeyEntry: k, Priority: s.BitcoinKeyLevel, Type: typ})
+	case *identityEntries.NewMatryoshkaHashStructure:
+		k.Key = s.OutermostMHash.String()
+		id.MatryoshkaHash = &k
+	case *identityEntries.NewServerEfficiencyStruct:
+		eff := s.Efficiency
+		id.Efficiency = &eff
+	case *identityEntries.NewCoinbaseAddressStruct:
+		id.Coinbase = primitives.ConvertFctAddressToUserStr(factoid.NewAddress(s.CoinbaseAddress.Bytes()))
+	}
+}
+
+func (id *Identity) problem(e Entry, format string, args ...interface{}) {
+	id.Problems = append(id.Problems, fmt.Sprintf("entry %.16s at height %d: %s", e.Hash, e.Height, fmt.Sprintf(format, args...)))
+}
+
+// isFunction returns true if the entry is a version 0 entry of the function
+func isFunction(e Entry, fn string) bool {
+	return len(e.ExtIDs) > 1 && len(e.ExtIDs[0]) == 1 && e.ExtIDs[0][0] == 0 && string(e.ExtIDs[1]) == fn
+}
+
+// entryTime decodes the 8 byte timestamp of a management entry
+func entryTime(ts []byte) time.Time {
+	if len(ts) > 8 {
+		return time.Time{}
+	}
+	b := make([]byte, 8)
+	copy(b[8-len(ts):], ts)
+	return time.Unix(int64(binary.BigEndian.Uint64(b)), 0).UTC()
+}
@@ -0,0 +1,69 @@
+package identity
+
+import (
+	"time"
+
+	"github.com/FactomProject/factom"
+)
+
+// Entry is an entry of an identity chain together with the block it is in
+type Entry struct {
+	Hash   string
+	Height uint32
+	Time   time.Time
+	ExtIDs [][]byte
+}
+
+// Source reads all entries of a chain, oldest first. It returns an empty list
+// if the chain does not exist.
+type Source interface {
+	Entries(chainID string) ([]Entry, error)
+}
+
+// LiveSource reads the chains from the factomd API set via
+// factom.SetFactomdServer
+type LiveSource struct{}
+
+var _ Source = LiveSource{}
+
+func (LiveSource) Entries(chainID string) ([]Entry, error) {
+	head, _, err := factom.GetChainHead(chainID)
+	if err != nil {
+		if isMissingChain(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var entries []Entry
+	for keymr := head; keymr != "" && keymr != factom.ZeroHash; {
+		eb, err := factom.GetEBlock(keymr)
+		if err != nil {
+			return nil, err
+		}
+
+		block := make([]Entry, 0, len(eb.EntryList))
+		for _, ebe := range eb.EntryList {
+			e, err := factom.GetEntry(ebe.EntryHash)
+			if err != nil {
+				return nil, err
+			}
+			block = append(block, Entry{
+				Hash:   ebe.EntryHash,
+				Height: uint32(eb.Header.DBHeight),
+				Time:   time.Unix(ebe.Timestamp, 0).UTC(),
+				ExtIDs: e.ExtIDs,
+			})
+		}
+		entries = append(block, entries...)
+
+		keymr = eb.Header.PrevKeyMR
+	}
+	return entries, nil
+}
+
+// isMissingChain returns true for the API error of an unknown chain
+func isMissingChain(err error) bool {
+	jerr, ok := err.(*factom.JSONError)
+	return ok && jerr.Code == -32009
+}
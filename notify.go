@@ -0,0 +1,427 @@
+package networkcontrol
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/FactomProject/factom"
+	"github.com/WhoSoup/factom-networkcontrol/authset"
+	"github.com/WhoSoup/factom-networkcontrol/proposal"
+)
+
+// Event is a change of a proposal that operators can be notified about
+type Event string
+
+const (
+	// EventCreated is sent when a proposal is saved for the first time
+	EventCreated Event = "created"
+	// EventSigned is sent when a proposal gains a valid signature
+	EventSigned Event = "signed"
+	// EventQuorum is sent when a proposal has enough signatures to be sent
+	EventQuorum Event = "quorum"
+	// EventSent is sent when a proposal is submitted to the network
+	EventSent Event = "sent"
+	// EventApplied is sent when a proposal is found in an admin block
+	EventApplied Event = "applied"
+)
+
+var allEvents = []Event{EventCreated, EventSigned, EventQuorum, EventSent, EventApplied}
+
+// ParseEvents parses a list of event names. "all" or an empty list are every
+// event.
+func ParseEvents(names []string) (map[Event]bool, error) {
+	events := make(map[Event]bool)
+	if len(names) == 0 || (len(names) == 1 && strings.EqualFold(strings.TrimSpace(names[0]), "all")) {
+		for _, e := range allEvents {
+			events[e] = true
+		}
+		return events, nil
+	}
+
+	for _, name := range names {
+		e := Event(strings.ToLower(strings.TrimSpace(name)))
+		found := false
+		for _, known := range allEvents {
+			found = found || e == known
+		}
+		if !found {
+			return nil, fmt.Errorf("invalid event %q, must be one of created, signed, quorum, sent, applied or all", name)
+		}
+		events[e] = true
+	}
+	return events, nil
+}
+
+// Subscription is where and about what an operator wants to be notified
+type Subscription struct {
+	// Email are the addresses that get a mail for every event
+	Email []string
+	// Webhook is a url that gets the notification as a JSON POST request.
+	// If Secret is set, the body is signed with it.
+	Webhook string
+	Secret  string
+	Events  map[Event]bool
+}
+
+// MailSettings is the SMTP server that notification mails are sent with
+type MailSettings struct {
+	// Server is the host:port of the SMTP server
+	Server string
+	// User and Password are optional PLAIN auth credentials
+	User     string
+	Password string
+	From     string
+}
+
+// Notification is the JSON body of a webhook request
+type Notification struct {
+	Event Event     `json:"event"`
+	Time  time.Time `json:"time"`
+	// Network is the name of the network profile
+	Network string `json:"network"`
+	// Proposal is the proposal id and URL the link to its page, if the
+	// public url of the control panel is configured
+	Proposal string `json:"proposal"`
+	URL      string `json:"url,omitempty"`
+	Type     string `json:"type"`
+	ChainID  string `json:"chainid"`
+	Summary  string `json:"summary"`
+	Signers  int    `json:"signers"`
+	Required int    `json:"required"`
+	// NewSigners are the identity chains of the authorities whose signatures
+	// were added, for the signed event
+	NewSigners    []string `json:"newsigners,omitempty"`
+	AppliedHeight int64    `json:"appliedheight,omitempty"`
+	// Authority is the identity chain of the subscribed operator and Signed
+	// is true if the proposal carries its signature
+	Authority string `json:"authority"`
+	Signed    bool   `json:"signed"`
+}
+
+// signatureHeader carries the hex HMAC-SHA256 of the webhook body
+const signatureHeader = "X-Networkcontrol-Signature"
+
+// delivery is a notification for one subscriber
+type delivery struct {
+	sub *Subscription
+	n   Notification
+}
+
+// Notifier turns changes of proposals into events and delivers them to the
+// operators that subscribed to them. Deliveries are queued and sent in the
+// background, so the requests that change proposals are not held up by slow
+// webhooks or mail servers.
+type Notifier struct {
+	ac        *AuthCache
+	profile   *Profile
+	operators map[string]*Operator
+	mail      *MailSettings
+	// url is the public address of the control panel for links
+	url    string
+	client *http.Client
+	queue  chan delivery
+}
+
+func NewNotifier(ac *AuthCache, profile *Profile, operators map[string]*Operator, mail *MailSettings, url string) *Notifier {
+	n := new(Notifier)
+	n.ac = ac
+	n.profile = profile
+	n.operators = operators
+	n.mail = mail
+	n.url = strings.TrimSuffix(url, "/")
+	n.client = &http.Client{Timeout: 10 * time.Second}
+	n.queue = make(chan delivery, 256)
+	return n
+}
+
+// subscribed returns true if any operator subscribed to notifications
+func subscribed(operators map[string]*Operator) bool {
+	for _, op := range operators {
+		if op.Subscription != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Observe is the watch function of the proposal store
+func (n *Notifier) Observe(old, p *proposal.Proposal) {
+	m, err := p.Decode()
+	if err != nil {
+		log.Printf("notify: proposal %s: %v", p.ID, err)
+		return
+	}
+	auth := n.auth()
+	events, base, err := n.events(old, p, m, auth)
+	if err != nil {
+		log.Printf("notify: proposal %s: %v", p.ID, err)
+		return
+	}
+
+	for chain, op := range n.operators {
+		if op.Subscription == nil {
+			continue
+		}
+		for _, e := range events {
+			if !op.Subscription.Events[e.Event] {
+				continue
+			}
+			d := delivery{sub: op.Subscription, n: *base}
+			d.n.Event = e.Event
+			d.n.NewSigners = e.signers
+			d.n.Authority = chain
+			d.n.Signed = signedBy(m, auth, chain)
+			select {
+			case n.queue <- d:
+			default:
+				log.Printf("notify: queue full, dropping %s notification of proposal %s for %s", e.Event, p.ID, chain)
+			}
+		}
+	}
+}
+
+type event struct {
+	Event
+	signers []string
+}
+
+// events compares the proposal before and after a change. The returned
+// notification has everything but the event and the subscriber.
+func (n *Notifier) events(old, p *proposal.Proposal, m *authset.Message, auth []*factom.Authority) ([]event, *Notification, error) {
+	rule := n.profile.Quorum
+
+	var events []event
+	signers, required := rule.Tally(m, auth)
+	if old == nil {
+		events = append(events, event{Event: EventCreated})
+		if signers >= required {
+			events = append(events, event{Event: EventQuorum})
+		}
+	} else {
+		prev, err := old.Decode()
+		if err != nil {
+			return nil, nil, err
+		}
+		if added := newSigners(prev, m, auth); len(added) > 0 {
+			events = append(events, event{Event: EventSigned, signers: added})
+		}
+		if before, _ := rule.Tally(prev, auth); before < required && signers >= required {
+			events = append(events, event{Event: EventQuorum})
+		}
+		if old.Status != proposal.StatusPending && p.Status == proposal.StatusPending {
+			events = append(events, event{Event: EventSent})
+		}
+		if old.Status != proposal.StatusApplied && p.Status == proposal.StatusApplied {
+			events = append(events, event{Event: EventApplied})
+		}
+	}
+
+	base := &Notification{
+		Time:          time.Now().UTC(),
+		Network:       n.profile.Name,
+		Proposal:      p.ID,
+		Type:          m.TypeName(),
+		ChainID:       m.ChainID,
+		Summary:       authset.Summary(m),
+		Signers:       signers,
+		Required:      required,
+		AppliedHeight: p.AppliedHeight,
+	}
+	if n.url != "" {
+		base.URL = n.url + "/proposal/" + p.ID
+	}
+	return events, base, nil
+}
+
+// auth returns the cached authority set, or nil if it can't be loaded. The
+// notifications then count no signers.
+func (n *Notifier) auth() []*factom.Authority {
+	auth, err := n.ac.Get()
+	if err != nil {
+		log.Printf("notify: %v", err)
+	}
+	return auth
+}
+
+// newSigners returns the identity chains of the authorities that have a
+// valid signature in m but not in prev. Keys outside the authority set are
+// listed as their public key.
+func newSigners(prev, m *authset.Message, auth []*factom.Authority) []string {
+	had := make(map[string]bool)
+	for _, s := range prev.ValidSignatures() {
+		had[hex.EncodeToString(s.PubKey)] = true
+	}
+	var added []string
+	for _, s := range m.ValidSignatures() {
+		key := hex.EncodeToString(s.PubKey)
+		if had[key] {
+			continue
+		}
+		if a := authset.FindSigner(auth, s.PubKey); a != nil {
+			added = append(added, a.AuthorityChainID)
+		} else {
+			added = append(added, key)
+		}
+	}
+	return added
+}
+
+// signedBy returns true if the message has a valid signature of the
+// authority's current signing key
+func signedBy(m *authset.Message, auth []*factom.Authority, chain string) bool {
+	a := authset.FindAuthority(auth, chain)
+	if a == nil {
+		return false
+	}
+	for _, s := range m.ValidSignatures() {
+		if hex.EncodeToString(s.PubKey) == a.SigningKey {
+			return true
+		}
+	}
+	return false
+}
+
+// Run delivers the queued notifications until stop is closed
+func (n *Notifier) Run(stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case d := <-n.queue:
+			n.deliver(d)
+		}
+	}
+}
+
+// deliver sends the notification to the webhook and the mail addresses of
+// the subscription. Failed webhooks are tried again twice.
+func (n *Notifier) deliver(d delivery) {
+	if d.sub.Webhook != "" {
+		var err error
+		for try := 0; try < 3; try++ {
+			if try > 0 {
+				time.Sleep(time.Duration(try) * 5 * time.Second)
+			}
+			if err = n.post(d.sub, &d.n); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			log.Printf("notify: webhook of %s: %v", d.n.Authority, err)
+		}
+	}
+	if len(d.sub.Email) > 0 {
+		if err := n.sendMail(d.sub.Email, &d.n); err != nil {
+			log.Printf("notify: mail to %s: %v", strings.Join(d.sub.Email, ", "), err)
+		}
+	}
+}
+
+// post sends the notification to the webhook. The body is signed with
+// HMAC-SHA256 and the secret of the subscription.
+func (n *Notifier) post(sub *Subscription, note *Notification) error {
+	body, err := json.Marshal(note)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, sub.Webhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if sub.Secret != "" {
+		req.Header.Set(signatureHeader, "sha256="+SignWebhook(sub.Secret, body))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("status %s", resp.Status)
+	}
+	return nil
+}
+
+// SignWebhook returns the hex HMAC-SHA256 of a webhook body. Receivers
+// compare it to the X-Networkcontrol-Signature header without the "sha256="
+// prefix.
+func SignWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// sendMail sends the notification as a plain text mail
+func (n *Notifier) sendMail(to []string, note *Notification) error {
+	if n.mail == nil || n.mail.Server == "" {
+		return fmt.Errorf("no smtp server configured")
+	}
+
+	var auth smtp.Auth
+	if n.mail.User != "" {
+		host, _, err := net.SplitHostPort(n.mail.Server)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", n.mail.User, n.mail.Password, host)
+	}
+
+	from, err := mail.ParseAddress(n.mail.From)
+	if err != nil {
+		return err
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: [%s] %s: %s\r\n", note.Network, eventTitle(note), note.Type)
+	fmt.Fprintf(&msg, "Date: %s\r\n", note.Time.Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(&msg, "%s\r\n\r\n", note.Summary)
+	fmt.Fprintf(&msg, "Signatures: %d of %d required\r\n", note.Signers, note.Required)
+	if len(note.NewSigners) > 0 {
+		fmt.Fprintf(&msg, "Signed by: %s\r\n", strings.Join(note.NewSigners, ", "))
+	}
+	if note.Event != EventApplied && note.Event != EventSent {
+		if note.Signed {
+			fmt.Fprintf(&msg, "Your authority %s has signed.\r\n", note.Authority)
+		} else {
+			fmt.Fprintf(&msg, "Your authority %s has not signed yet.\r\n", note.Authority)
+		}
+	}
+	fmt.Fprintf(&msg, "\r\nProposal: %s\r\n", note.Proposal)
+	if note.URL != "" {
+		fmt.Fprintf(&msg, "%s\r\n", note.URL)
+	}
+	return smtp.SendMail(n.mail.Server, auth, from.Address, to, msg.Bytes())
+}
+
+// eventTitle describes the event for mail subjects
+func eventTitle(note *Notification) string {
+	switch note.Event {
+	case EventCreated:
+		return "New proposal"
+	case EventSigned:
+		return "New signature"
+	case EventQuorum:
+		return "Quorum reached"
+	case EventSent:
+		return "Sent to the network"
+	case EventApplied:
+		return fmt.Sprintf("Applied at height %d", note.AppliedHeight)
+	}
+	return string(note.Event)
+}
@@ -0,0 +1,175 @@
+package networkcontrol
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/WhoSoup/factom-networkcontrol/authset"
+)
+
+func TestParseEvents(t *testing.T) {
+	tests := []struct {
+		names   []string
+		want    []Event
+		wantErr bool
+	}{
+		{nil, allEvents, false},
+		{[]string{"all"}, allEvents, false},
+		{[]string{" Quorum ", "applied"}, []Event{EventQuorum, EventApplied}, false},
+		{[]string{"signed", "deleted"}, nil, true},
+		{[]string{"all", "sent"}, nil, true},
+	}
+	for _, tt := range tests {
+		events, err := ParseEvents(tt.names)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%v: got %v, want error %v", tt.names, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		want := make(map[Event]bool)
+		for _, e := range tt.want {
+			want[e] = true
+		}
+		if !reflect.DeepEqual(events, want) {
+			t.Errorf("%v: got %v, want %v", tt.names, events, want)
+		}
+	}
+}
+
+// webhook is a receiver that checks the signature of every request
+type webhook struct {
+	t      *testing.T
+	secret string
+	got    chan Notification
+}
+
+func (w *webhook) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.t.Error(err)
+		return
+	}
+	mac := hmac.New(sha256.New, []byte(w.secret))
+	mac.Write(body)
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); r.Header.Get(signatureHeader) != want {
+		w.t.Errorf("signature header %q, want %q", r.Header.Get(signatureHeader), want)
+	}
+
+	var n Notification
+	if err := json.Unmarshal(body, &n); err != nil {
+		w.t.Error(err)
+	}
+	w.got <- n
+}
+
+// next returns the next delivered notification
+func (w *webhook) next() Notification {
+	w.t.Helper()
+	select {
+	case n := <-w.got:
+		return n
+	case <-time.After(5 * time.Second):
+		w.t.Fatal("no notification was delivered")
+		return Notification{}
+	}
+}
+
+func TestNotifier(t *testing.T) {
+	all := &webhook{t: t, secret: "secret", got: make(chan Notification, 16)}
+	allSrv := httptest.NewServer(all)
+	defer allSrv.Close()
+	applied := &webhook{t: t, secret: "other", got: make(chan Notification, 16)}
+	appliedSrv := httptest.NewServer(applied)
+	defer appliedSrv.Close()
+
+	events, err := ParseEvents([]string{"applied"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	everything, err := ParseEvents(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	operators := map[string]*Operator{
+		testChain(0): {Name: "zero", Subscription: &Subscription{Webhook: allSrv.URL, Secret: all.secret, Events: everything}},
+		testChain(1): {Name: "one", Subscription: &Subscription{Webhook: appliedSrv.URL, Secret: applied.secret, Events: events}},
+		testChain(2): {Name: "two"},
+	}
+
+	store := openStore(t)
+	ac := NewAuthCache(testAuthorities(), time.Hour)
+	n := NewNotifier(ac, DefaultProfiles()["mainnet"], operators, nil, "https://nc.example.com/")
+	store.Watch(n.Observe)
+	stop := make(chan struct{})
+	defer close(stop)
+	go n.Run(stop)
+
+	m := testMessage(t)
+	save := func(m *authset.Message) {
+		t.Helper()
+		if _, err := store.Save(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	save(m)
+	if got := all.next(); got.Event != EventCreated || got.Proposal != m.Hash() || got.URL != "https://nc.example.com/proposal/"+m.Hash() {
+		t.Errorf("created: got %+v", got)
+	}
+
+	signed, err := authset.Sign(m, testKey(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	save(signed)
+	if got := all.next(); got.Event != EventSigned || !reflect.DeepEqual(got.NewSigners, []string{testChain(0)}) || !got.Signed || got.Signers != 1 {
+		t.Errorf("signed: got %+v", got)
+	}
+
+	if signed, err = authset.Sign(signed, testKey(1)); err != nil {
+		t.Fatal(err)
+	}
+	save(signed)
+	if got := all.next(); got.Event != EventSigned || !reflect.DeepEqual(got.NewSigners, []string{testChain(1)}) {
+		t.Errorf("second signature: got %+v", got)
+	}
+	if got := all.next(); got.Event != EventQuorum || got.Signers < got.Required {
+		t.Errorf("quorum: got %+v", got)
+	}
+
+	if _, err := store.MarkSent(m.Hash(), 10); err != nil {
+		t.Fatal(err)
+	}
+	if got := all.next(); got.Event != EventSent {
+		t.Errorf("sent: got %+v", got)
+	}
+
+	if _, err := store.MarkApplied(m.Hash(), 12); err != nil {
+		t.Fatal(err)
+	}
+	if got := all.next(); got.Event != EventApplied || got.AppliedHeight != 12 {
+		t.Errorf("applied: got %+v", got)
+	}
+
+	// the other operator only subscribed to applied proposals
+	if got := applied.next(); got.Event != EventApplied || got.Authority != testChain(1) || !got.Signed {
+		t.Errorf("applied for the second operator: got %+v", got)
+	}
+	select {
+	case got := <-applied.got:
+		t.Errorf("unsubscribed event %s was delivered", got.Event)
+	case got := <-all.got:
+		t.Errorf("unexpected event %s was delivered", got.Event)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
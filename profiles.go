@@ -0,0 +1,117 @@
+package networkcontrol
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/WhoSoup/factom-networkcontrol/authset"
+)
+
+// Profile is a network the control panel can connect to
+type Profile struct {
+	Name string
+	// Factomd is the API endpoint
+	Factomd string
+	// Network is written into bundles and bundles for other networks are
+	// rejected on import
+	Network authset.NetworkID
+	// Quorum is the rule used to count signatures
+	Quorum authset.QuorumRule
+	// Window is how far a message's timestamp may be from the current time
+	Window time.Duration
+	// Color is the background of the network banner on every page
+	Color string
+}
+
+// DefaultProfiles returns the built-in profiles for mainnet, testnet and a
+// local network
+func DefaultProfiles() map[string]*Profile {
+	return map[string]*Profile{
+		"mainnet": {
+			Name:    "mainnet",
+			Factomd: "https://api.factomd.net",
+			Network: authset.MainNet,
+			Window:  authset.TimestampWindow,
+			Color:   "#b03a2e",
+		},
+		"testnet": {
+			Name:    "testnet",
+			Factomd: "https://dev.factomd.net",
+			Network: authset.TestNet,
+			Window:  authset.TimestampWindow,
+			Color:   "#1f618d",
+		},
+		"local": {
+			Name:    "local",
+			Factomd: "localhost:8088",
+			Network: authset.LocalNet,
+			Window:  authset.TimestampWindow,
+			Color:   "#1e8449",
+		},
+	}
+}
+
+// profileSection is a [profile.name] table of the config file
+type profileSection struct {
+	Factomd string
+	Network string
+	Quorum  string
+	Window  string
+	Color   string
+}
+
+// applyProfiles adds the profiles of the config file to the built-in ones.
+// Profiles in the file override the built-in profile of the same name field
+// by field.
+func applyProfiles(profiles map[string]*Profile, sections map[string]*profileSection) error {
+	for name, sec := range sections {
+		p, ok := profiles[name]
+		if !ok {
+			p = &Profile{Name: name, Window: authset.TimestampWindow, Color: "#6c3483"}
+			if sec.Factomd == "" || sec.Network == "" {
+				return fmt.Errorf("profile %q: factomd and network are required", name)
+			}
+		}
+
+		if sec.Factomd != "" {
+			p.Factomd = sec.Factomd
+		}
+		if sec.Network != "" {
+			id, err := authset.ParseNetworkID(sec.Network)
+			if err != nil {
+				return fmt.Errorf("profile %q: %v", name, err)
+			}
+			p.Network = id
+		}
+		if sec.Quorum != "" {
+			rule, err := authset.ParseQuorumRule(sec.Quorum)
+			if err != nil {
+				return fmt.Errorf("profile %q: %v", name, err)
+			}
+			p.Quorum = rule
+		}
+		if sec.Window != "" {
+			window, err := time.ParseDuration(sec.Window)
+			if err != nil || window <= 0 {
+				return fmt.Errorf("profile %q: invalid window %q", name, sec.Window)
+			}
+			p.Window = window
+		}
+		if sec.Color != "" {
+			p.Color = sec.Color
+		}
+		profiles[name] = p
+	}
+	return nil
+}
+
+// ProfileNames returns the names of the profiles in alphabetical order
+func ProfileNames(profiles map[string]*Profile) []string {
+	var names []string
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,256 @@
+package proposal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/WhoSoup/factom-networkcontrol/authset"
+	"github.com/boltdb/bolt"
+)
+
+var (
+	ErrBatchNotFound = errors.New("batch not found")
+	ErrEmptyBatch    = errors.New("a batch needs at least two messages")
+	ErrInBatch       = errors.New("the proposal belongs to a batch, delete the batch first")
+)
+
+// BatchStatus is the state of a batch on the network
+type BatchStatus string
+
+const (
+	// BatchDraft batches have not been sent yet
+	BatchDraft BatchStatus = ""
+	// BatchSending batches are sent one message at a time, each after the
+	// previous one was applied
+	BatchSending BatchStatus = "sending"
+	// BatchDone batches had all of their messages applied
+	BatchDone BatchStatus = "done"
+	// BatchFailed batches stopped because a message expired or could not
+	// be sent
+	BatchFailed BatchStatus = "failed"
+)
+
+var bucketBatches = []byte("batches")
+
+// Batch is a group of proposals that are signed, checked and sent together.
+// The messages themselves are stored as regular proposals, so signatures
+// added to a batch also show up in the proposal and the other way around.
+type Batch struct {
+	ID      string    `json:"id"`
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+	// Proposals are the ids of the member proposals in send order
+	Proposals []string `json:"proposals"`
+
+	Status BatchStatus `json:"status,omitempty"`
+	// Next is the index of the proposal that is sent next
+	Next int `json:"next,omitempty"`
+	// Error is the reason a batch failed
+	Error string `json:"error,omitempty"`
+}
+
+// batchID is the hash of the sorted member ids, so the same set of messages
+// always ends up in the same batch
+func batchID(ids []string) string {
+	sorted := append([]string(nil), ids...)
+	sort.Strings(sorted)
+	h := sha256.New()
+	for _, id := range sorted {
+		h.Write([]byte(id))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// SaveBatch stores every message as a proposal and groups them into a batch
+// in the given order. If the batch already exists, only the signatures are
+// added and the order is updated.
+func (s *Store) SaveBatch(msgs []*authset.Message) (*Batch, error) {
+	if len(msgs) < 2 {
+		return nil, ErrEmptyBatch
+	}
+
+	var ids []string
+	for _, m := range msgs {
+		p, err := s.Save(m)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, p.ID)
+	}
+
+	b := new(Batch)
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketBatches)
+		id := batchID(ids)
+
+		now := time.Now()
+		b.ID = id
+		b.Created = now
+		if data := bucket.Get([]byte(id)); data != nil {
+			if err := json.Unmarshal(data, b); err != nil {
+				return err
+			}
+		}
+		if b.Status == BatchDraft {
+			b.Proposals = ids
+		}
+		b.Updated = now
+
+		data, err := json.Marshal(b)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(id), data)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// updateBatch modifies the stored batch inside a transaction
+func (s *Store) updateBatch(id string, f func(b *Batch)) (*Batch, error) {
+	b := new(Batch)
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketBatches)
+		data := bucket.Get([]byte(id))
+		if data == nil {
+			return ErrBatchNotFound
+		}
+		if err := json.Unmarshal(data, b); err != nil {
+			return err
+		}
+
+		f(b)
+		b.Updated = time.Now()
+
+		data, err := json.Marshal(b)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(id), data)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// StartBatch marks the batch as sending, starting with the first message
+func (s *Store) StartBatch(id string) (*Batch, error) {
+	return s.updateBatch(id, func(b *Batch) {
+		b.Status = BatchSending
+		b.Next = 0
+		b.Error = ""
+	})
+}
+
+// AdvanceBatch records that the next message was applied. The batch is done
+// once all messages are applied.
+func (s *Store) AdvanceBatch(id string) (*Batch, error) {
+	return s.updateBatch(id, func(b *Batch) {
+		b.Next++
+		if b.Next >= len(b.Proposals) {
+			b.Status = BatchDone
+		}
+	})
+}
+
+// FailBatch stops sending the batch
+func (s *Store) FailBatch(id string, reason string) (*Batch, error) {
+	return s.updateBatch(id, func(b *Batch) {
+		b.Status = BatchFailed
+		b.Error = reason
+	})
+}
+
+// GetBatch returns the batch with the given id
+func (s *Store) GetBatch(id string) (*Batch, error) {
+	b := new(Batch)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(bucketBatches).Get([]byte(id))
+		if data == nil {
+			return ErrBatchNotFound
+		}
+		return json.Unmarshal(data, b)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Batches returns all batches, most recently updated first
+func (s *Store) Batches() ([]*Batch, error) {
+	var list []*Batch
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketBatches).ForEach(func(k, v []byte) error {
+			b := new(Batch)
+			if err := json.Unmarshal(v, b); err != nil {
+				return err
+			}
+			list = append(list, b)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Updated.After(list[j].Updated)
+	})
+	return list, nil
+}
+
+// DeleteBatch removes the batch. The member proposals are kept.
+func (s *Store) DeleteBatch(id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketBatches)
+		if bucket.Get([]byte(id)) == nil {
+			return ErrBatchNotFound
+		}
+		return bucket.Delete([]byte(id))
+	})
+}
+
+// inBatch returns true if a stored batch contains the proposal
+func inBatch(tx *bolt.Tx, id string) (bool, error) {
+	found := false
+	err := tx.Bucket(bucketBatches).ForEach(func(k, v []byte) error {
+		b := new(Batch)
+		if err := json.Unmarshal(v, b); err != nil {
+			return err
+		}
+		for _, p := range b.Proposals {
+			if p == id {
+				found = true
+			}
+		}
+		return nil
+	})
+	return found, err
+}
+
+// Members returns the decoded messages of the batch in send order
+func (s *Store) Members(b *Batch) ([]*Proposal, []*authset.Message, error) {
+	var props []*Proposal
+	var msgs []*authset.Message
+	for _, id := range b.Proposals {
+		p, err := s.Get(id)
+		if err != nil {
+			return nil, nil, err
+		}
+		m, err := p.Decode()
+		if err != nil {
+			return nil, nil, err
+		}
+		props = append(props, p)
+		msgs = append(msgs, m)
+	}
+	return props, msgs, nil
+}
@@ -0,0 +1,142 @@
+package proposal
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/WhoSoup/factom-networkcontrol/authset"
+)
+
+func testBatch(t *testing.T) []*authset.Message {
+	t.Helper()
+	var msgs []*authset.Message
+	for _, c := range []string{"ab", "cd", "ef"} {
+		m, err := authset.BuildAddServer(strings.Repeat(c, 32), authset.Audit, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		msgs = append(msgs, m)
+	}
+	return msgs
+}
+
+func TestSaveBatch(t *testing.T) {
+	s := openStore(t)
+	msgs := testBatch(t)
+
+	if _, err := s.SaveBatch(msgs[:1]); err != ErrEmptyBatch {
+		t.Errorf("one message: got %v, want %v", err, ErrEmptyBatch)
+	}
+
+	b, err := s.SaveBatch(msgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b.Proposals) != 3 || b.Proposals[0] != msgs[0].Hash() {
+		t.Errorf("batch proposals %v", b.Proposals)
+	}
+
+	// the same messages in another order with a signature are the same
+	// batch, the signature ends up in the proposal
+	again, err := s.SaveBatch([]*authset.Message{msgs[2], signed(t, msgs[1], 1), msgs[0]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.ID != b.ID || again.Proposals[0] != msgs[2].Hash() {
+		t.Errorf("saved again as %s with order %v", again.ID, again.Proposals)
+	}
+	p, err := s.Get(msgs[1].Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m, err := p.Decode(); err != nil || len(m.ValidSignatures()) != 1 {
+		t.Errorf("the member proposal has no signature: %v", err)
+	}
+
+	props, members, err := s.Members(again)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(props) != 3 || members[0].Hash() != msgs[2].Hash() {
+		t.Errorf("members are not in batch order")
+	}
+
+	list, err := s.Batches()
+	if err != nil || len(list) != 1 {
+		t.Errorf("%d batches, %v", len(list), err)
+	}
+}
+
+func TestBatchStatus(t *testing.T) {
+	s := openStore(t)
+	msgs := testBatch(t)
+	b, err := s.SaveBatch(msgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if b, err = s.StartBatch(b.ID); err != nil || b.Status != BatchSending || b.Next != 0 {
+		t.Fatalf("started batch is %q at %d, %v", b.Status, b.Next, err)
+	}
+
+	// the order is fixed once sending started
+	if b, err = s.SaveBatch([]*authset.Message{msgs[2], msgs[1], msgs[0]}); err != nil || b.Proposals[0] != msgs[0].Hash() {
+		t.Errorf("the order of a sending batch changed: %v", err)
+	}
+
+	for i := 1; i <= 3; i++ {
+		if b, err = s.AdvanceBatch(b.ID); err != nil {
+			t.Fatal(err)
+		}
+		if b.Next != i {
+			t.Errorf("next is %d, want %d", b.Next, i)
+		}
+	}
+	if b.Status != BatchDone {
+		t.Errorf("batch is %q after all messages were applied", b.Status)
+	}
+
+	if b, err = s.FailBatch(b.ID, "expired"); err != nil || b.Status != BatchFailed || b.Error != "expired" {
+		t.Errorf("failed batch is %q with %q, %v", b.Status, b.Error, err)
+	}
+	if b, err = s.StartBatch(b.ID); err != nil || b.Status != BatchSending || b.Error != "" {
+		t.Errorf("restarted batch is %q with %q, %v", b.Status, b.Error, err)
+	}
+
+	if err := s.DeleteBatch(b.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetBatch(b.ID); err != ErrBatchNotFound {
+		t.Errorf("deleted batch: got %v, want %v", err, ErrBatchNotFound)
+	}
+	if _, err := s.Get(msgs[0].Hash()); err != nil {
+		t.Errorf("deleting the batch removed its proposals: %v", err)
+	}
+}
+
+func TestDeleteBatchMember(t *testing.T) {
+	s := openStore(t)
+	msgs := testBatch(t)
+	b, err := s.SaveBatch(msgs[:2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Save(msgs[2]); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Delete(msgs[0].Hash()); err != ErrInBatch {
+		t.Errorf("deleting a member: got %v, want %v", err, ErrInBatch)
+	}
+	if err := s.Delete(msgs[2].Hash()); err != nil {
+		t.Errorf("deleting a proposal outside the batch: %v", err)
+	}
+
+	if err := s.DeleteBatch(b.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete(msgs[0].Hash()); err != nil {
+		t.Errorf("deleting a former member: %v", err)
+	}
+}
@@ -0,0 +1,318 @@
+// Package proposal keeps authset messages that are still collecting
+// signatures in an embedded database, so drafts survive closed tabs and
+// signers can share a link instead of passing hex around.
+package proposal
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/WhoSoup/factom-networkcontrol/authset"
+	"github.com/boltdb/bolt"
+)
+
+var ErrNotFound = errors.New("proposal not found")
+
+// Status is the state of a proposal on the network
+type Status string
+
+const (
+	// StatusDraft proposals have not been sent yet
+	StatusDraft Status = ""
+	// StatusScheduled proposals are sent by the server once their schedule
+	// is due and the timestamp is inside the acceptance window
+	StatusScheduled Status = "scheduled"
+	// StatusPending proposals have been sent but were not found in an
+	// admin block yet
+	StatusPending Status = "pending"
+	// StatusApplied proposals were found in an admin block
+	StatusApplied Status = "applied"
+	// StatusExpired proposals were not applied before their timestamp
+	// left the acceptance window
+	StatusExpired Status = "expired"
+)
+
+var bucketProposals = []byte("proposals")
+
+// Proposal is a message and all the signatures collected for it so far.
+// The ID is the message hash, so every copy of the same message ends up in
+// the same proposal regardless of which signatures it carries.
+type Proposal struct {
+	ID      string    `json:"id"`
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+	// Message is the hex encoded message with all collected signatures
+	Message string `json:"message"`
+
+	Status Status    `json:"status,omitempty"`
+	SentAt time.Time `json:"sentat,omitempty"`
+	// Checked is the last directory block height that was searched for
+	// the message
+	Checked int64 `json:"checked,omitempty"`
+	// AppliedHeight is the height of the admin block containing the change
+	AppliedHeight int64 `json:"appliedheight,omitempty"`
+
+	// Schedule is set for scheduled proposals and kept after the schedule
+	// was cancelled, to show the reason
+	Schedule *Schedule `json:"schedule,omitempty"`
+}
+
+// Schedule is when a proposal is sent automatically. The message is sent
+// once both the time and the height are reached, whichever are set.
+type Schedule struct {
+	// At is the earliest time to send the message
+	At time.Time `json:"at,omitempty"`
+	// Height is the earliest directory block height to send the message
+	Height int64 `json:"height,omitempty"`
+	// Cancelled is the reason the server stopped the schedule
+	Cancelled string `json:"cancelled,omitempty"`
+}
+
+// Decode returns the decoded message of the proposal
+func (p *Proposal) Decode() (*authset.Message, error) {
+	return authset.DecodeHex(p.Message)
+}
+
+// Store is a BoltDB backed collection of proposals
+type Store struct {
+	db *bolt.DB
+	// watch is called after every change of a proposal
+	watch func(old, p *Proposal)
+}
+
+// Open opens or creates the database at the given path
+func Open(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(bucketProposals); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(bucketBatches)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Store{db: db}, nil
+}
+
+// Watch sets a function that is called after a proposal is created or
+// changed, with the proposal before and after the change. old is nil for new
+// proposals. It is called outside of the database transaction and must be set
+// before the store is used.
+func (s *Store) Watch(f func(old, p *Proposal)) {
+	s.watch = f
+}
+
+func (s *Store) changed(old, p *Proposal) {
+	if s.watch != nil {
+		s.watch(old, p)
+	}
+}
+
+// Close closes the database
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Save stores the message. If a proposal for the same message already
+// exists, the signatures of m are added to it. Returns the updated proposal.
+func (s *Store) Save(m *authset.Message) (*Proposal, error) {
+	var p, old *Proposal
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketProposals)
+		id := m.Hash()
+
+		now := time.Now()
+		p = &Proposal{ID: id, Created: now}
+
+		if data := b.Get([]byte(id)); data != nil {
+			if err := json.Unmarshal(data, p); err != nil {
+				return err
+			}
+			prev := *p
+			old = &prev
+
+			stored, err := p.Decode()
+			if err != nil {
+				return err
+			}
+
+			if m, err = authset.MergeSignatures(stored, m); err != nil {
+				return err
+			}
+		}
+
+		p.Message = hex.EncodeToString(m.Raw)
+		p.Updated = now
+
+		data, err := json.Marshal(p)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(id), data)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.changed(old, p)
+	return p, nil
+}
+
+// update modifies the stored proposal inside a transaction
+func (s *Store) update(id string, f func(p *Proposal)) (*Proposal, error) {
+	p, old := new(Proposal), new(Proposal)
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketProposals)
+		data := b.Get([]byte(id))
+		if data == nil {
+			return ErrNotFound
+		}
+		if err := json.Unmarshal(data, p); err != nil {
+			return err
+		}
+		*old = *p
+
+		f(p)
+
+		data, err := json.Marshal(p)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(id), data)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.changed(old, p)
+	return p, nil
+}
+
+// MarkSent sets the proposal to pending. The network is searched for the
+// message starting after the given directory block height.
+func (s *Store) MarkSent(id string, height int64) (*Proposal, error) {
+	return s.update(id, func(p *Proposal) {
+		p.Status = StatusPending
+		p.SentAt = time.Now()
+		p.Updated = p.SentAt
+		p.Checked = height
+		p.AppliedHeight = 0
+	})
+}
+
+// MarkScheduled sets the proposal to be sent automatically
+func (s *Store) MarkScheduled(id string, at time.Time, height int64) (*Proposal, error) {
+	return s.update(id, func(p *Proposal) {
+		p.Status = StatusScheduled
+		p.Updated = time.Now()
+		p.Schedule = &Schedule{At: at, Height: height}
+	})
+}
+
+// CancelSchedule sets a scheduled proposal back to draft. The reason is
+// empty if the schedule was removed by a user.
+func (s *Store) CancelSchedule(id string, reason string) (*Proposal, error) {
+	return s.update(id, func(p *Proposal) {
+		if p.Status != StatusScheduled {
+			return
+		}
+		p.Status = StatusDraft
+		p.Updated = time.Now()
+		if reason == "" {
+			p.Schedule = nil
+		} else {
+			p.Schedule.Cancelled = reason
+		}
+	})
+}
+
+// MarkChecked records that the blocks up to the given height did not
+// contain the message
+func (s *Store) MarkChecked(id string, height int64) (*Proposal, error) {
+	return s.update(id, func(p *Proposal) {
+		p.Checked = height
+	})
+}
+
+// MarkApplied records the height of the admin block containing the message
+func (s *Store) MarkApplied(id string, height int64) (*Proposal, error) {
+	return s.update(id, func(p *Proposal) {
+		p.Status = StatusApplied
+		p.Updated = time.Now()
+		p.Checked = height
+		p.AppliedHeight = height
+	})
+}
+
+// MarkExpired records that the message can no longer be applied
+func (s *Store) MarkExpired(id string) (*Proposal, error) {
+	return s.update(id, func(p *Proposal) {
+		p.Status = StatusExpired
+		p.Updated = time.Now()
+	})
+}
+
+// Get returns the proposal with the given id
+func (s *Store) Get(id string) (*Proposal, error) {
+	p := new(Proposal)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(bucketProposals).Get([]byte(id))
+		if data == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(data, p)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// List returns all proposals, most recently updated first
+func (s *Store) List() ([]*Proposal, error) {
+	var list []*Proposal
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketProposals).ForEach(func(k, v []byte) error {
+			p := new(Proposal)
+			if err := json.Unmarshal(v, p); err != nil {
+				return err
+			}
+			list = append(list, p)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Updated.After(list[j].Updated)
+	})
+	return list, nil
+}
+
+// Delete removes the proposal with the given id. Proposals that belong to a
+// batch can only be deleted after the batch.
+func (s *Store) Delete(id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketProposals)
+		if b.Get([]byte(id)) == nil {
+			return ErrNotFound
+		}
+		if found, err := inBatch(tx, id); err != nil {
+			return err
+		} else if found {
+			return ErrInBatch
+		}
+		return b.Delete([]byte(id))
+	})
+}
@@ -0,0 +1,179 @@
+package proposal
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/FactomProject/factomd/common/primitives"
+	"github.com/WhoSoup/factom-networkcontrol/authset"
+)
+
+func openStore(t *testing.T) *Store {
+	t.Helper()
+	s, err := Open(filepath.Join(t.TempDir(), "proposals.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func signed(t *testing.T, m *authset.Message, keys ...byte) *authset.Message {
+	t.Helper()
+	for _, k := range keys {
+		seed := make([]byte, 32)
+		seed[0] = k
+		var err error
+		if m, err = authset.Sign(m, primitives.NewPrivateKeyFromHexBytes(seed)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return m
+}
+
+func testMessage(t *testing.T) *authset.Message {
+	t.Helper()
+	m, err := authset.BuildAddServer(strings.Repeat("ab", 32), authset.Federated, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestSaveMerges(t *testing.T) {
+	s := openStore(t)
+	m := testMessage(t)
+
+	p, err := s.Save(signed(t, m, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ID != m.Hash() {
+		t.Errorf("proposal id %s, want the message hash %s", p.ID, m.Hash())
+	}
+	if _, err := s.Save(signed(t, m, 2, 1)); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err = s.Get(m.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := p.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.ValidSignatures()) != 2 {
+		t.Errorf("the proposal has %d signatures, want 2", len(d.ValidSignatures()))
+	}
+
+	other, err := authset.BuildRemoveServer(strings.Repeat("ab", 32), authset.Federated, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Save(other); err != nil {
+		t.Fatal(err)
+	}
+	list, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].ID != other.Hash() {
+		t.Errorf("list has %d proposals, the most recent is not first", len(list))
+	}
+}
+
+func TestDelete(t *testing.T) {
+	s := openStore(t)
+	m := testMessage(t)
+	if _, err := s.Save(m); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Delete(m.Hash()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(m.Hash()); err != ErrNotFound {
+		t.Errorf("deleted proposal: got %v, want %v", err, ErrNotFound)
+	}
+	if err := s.Delete(m.Hash()); err != ErrNotFound {
+		t.Errorf("deleting twice: got %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	s := openStore(t)
+	m := testMessage(t)
+	id := m.Hash()
+	if _, err := s.Save(m); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := s.MarkSent(id, 700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Status != StatusPending || p.Checked != 700 || p.SentAt.IsZero() {
+		t.Errorf("sent proposal is %q checked at %d, sent at %s", p.Status, p.Checked, p.SentAt)
+	}
+	if p, err = s.MarkChecked(id, 701); err != nil || p.Status != StatusPending || p.Checked != 701 {
+		t.Errorf("checked proposal is %q checked at %d, %v", p.Status, p.Checked, err)
+	}
+	if p, err = s.MarkApplied(id, 702); err != nil || p.Status != StatusApplied || p.AppliedHeight != 702 {
+		t.Errorf("applied proposal is %q at %d, %v", p.Status, p.AppliedHeight, err)
+	}
+
+	// sending again starts the search over
+	if p, err = s.MarkSent(id, 800); err != nil || p.Status != StatusPending || p.AppliedHeight != 0 {
+		t.Errorf("resent proposal is %q applied at %d, %v", p.Status, p.AppliedHeight, err)
+	}
+	if p, err = s.MarkExpired(id); err != nil || p.Status != StatusExpired {
+		t.Errorf("expired proposal is %q, %v", p.Status, err)
+	}
+
+	if _, err := s.MarkSent(strings.Repeat("0", 64), 1); err != ErrNotFound {
+		t.Errorf("unknown proposal: got %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	s := openStore(t)
+	m := testMessage(t)
+	id := m.Hash()
+	if _, err := s.Save(m); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := s.MarkScheduled(id, time.Now().Add(time.Hour), 500)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Status != StatusScheduled || p.Schedule == nil || p.Schedule.Height != 500 {
+		t.Errorf("scheduled proposal is %q with schedule %+v", p.Status, p.Schedule)
+	}
+
+	// the server keeps the schedule to show the reason, users remove it
+	p, err = s.CancelSchedule(id, "the message is invalid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Status != StatusDraft || p.Schedule == nil || p.Schedule.Cancelled != "the message is invalid" {
+		t.Errorf("cancelled proposal is %q with schedule %+v", p.Status, p.Schedule)
+	}
+	if _, err := s.MarkScheduled(id, time.Time{}, 600); err != nil {
+		t.Fatal(err)
+	}
+	if p, err = s.CancelSchedule(id, ""); err != nil || p.Schedule != nil {
+		t.Errorf("removed schedule is %+v, %v", p.Schedule, err)
+	}
+
+	// sent proposals are not touched
+	if _, err := s.MarkSent(id, 700); err != nil {
+		t.Fatal(err)
+	}
+	if p, err = s.CancelSchedule(id, "too late"); err != nil || p.Status != StatusPending {
+		t.Errorf("cancelling the schedule of a sent proposal made it %q, %v", p.Status, err)
+	}
+}
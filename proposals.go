@@ -0,0 +1,244 @@
+package networkcontrol
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FactomProject/factom"
+
+	"github.com/WhoSoup/factom-networkcontrol/audit"
+	"github.com/WhoSoup/factom-networkcontrol/authset"
+	"github.com/WhoSoup/factom-networkcontrol/proposal"
+	"github.com/labstack/echo/v4"
+)
+
+// showMessage saves the message as a proposal, merging it with any
+// signatures already collected, and redirects to the proposal page.
+// Without a store, the message is printed directly. The action that produced
+// the message is recorded in the audit log.
+func (nc *NetworkControl) showMessage(c echo.Context, m *authset.Message, r audit.Record) error {
+	r.Message = m.Hash()
+	if nc.store == nil {
+		nc.record(c, r, nil)
+		return nc.printMessage(c, m)
+	}
+
+	p, err := nc.store.Save(m)
+	nc.record(c, r, err)
+	if err != nil {
+		return nc.printError(c, err)
+	}
+
+	return c.Redirect(http.StatusSeeOther, "/proposal/"+p.ID)
+}
+
+func (nc *NetworkControl) proposal(c echo.Context) error {
+	if nc.store == nil {
+		return nc.printError(c, proposal.ErrNotFound)
+	}
+
+	p, err := nc.store.Get(c.Param("id"))
+	if err != nil {
+		return nc.printError(c, err)
+	}
+
+	m, err := p.Decode()
+	if err != nil {
+		return nc.printError(c, err)
+	}
+
+	return nc.printMessage(c, m)
+}
+
+func (nc *NetworkControl) deleteProposal(c echo.Context) error {
+	if nc.store == nil {
+		return nc.printError(c, proposal.ErrNotFound)
+	}
+
+	err := nc.store.Delete(c.Param("id"))
+	nc.record(c, audit.Record{Action: audit.Delete, Message: c.Param("id")}, err)
+	if err != nil {
+		return nc.printError(c, err)
+	}
+
+	return c.Redirect(http.StatusSeeOther, "/")
+}
+
+func (nc *NetworkControl) scheduleProposal(c echo.Context) error {
+	if nc.store == nil {
+		return nc.printError(c, proposal.ErrNotFound)
+	}
+
+	var at time.Time
+	if v := strings.TrimSpace(c.FormValue("at")); v != "" {
+		t, err := parseScheduleTime(v)
+		if err != nil {
+			return nc.printError(c, err)
+		}
+		at = t
+	}
+
+	var height int64
+	if v := strings.TrimSpace(c.FormValue("height")); v != "" {
+		h, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nc.printError(c, err)
+		}
+		height = h
+	}
+
+	p, err := nc.schedule(c.Param("id"), at, height)
+	nc.record(c, audit.Record{Action: audit.Schedule, Message: c.Param("id")}, err)
+	if err != nil {
+		return nc.printError(c, err)
+	}
+
+	return c.Redirect(http.StatusSeeOther, "/proposal/"+p.ID)
+}
+
+func (nc *NetworkControl) unscheduleProposal(c echo.Context) error {
+	if nc.store == nil {
+		return nc.printError(c, proposal.ErrNotFound)
+	}
+
+	p, err := nc.tracker.Unschedule(c.Param("id"))
+	nc.record(c, audit.Record{Action: audit.Unschedule, Message: c.Param("id")}, err)
+	if err != nil {
+		return nc.printError(c, err)
+	}
+
+	return c.Redirect(http.StatusSeeOther, "/proposal/"+p.ID)
+}
+
+// parseScheduleTime accepts "2006-01-02 15:04" in UTC or an RFC3339 time
+func parseScheduleTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02 15:04", s)
+}
+
+// schedule sets the proposal to be sent automatically at the given time
+// and height, whichever are set. The message has to pass the pre-send checks
+// apart from the timestamp, and the schedule has to be due before the
+// timestamp window closes.
+func (nc *NetworkControl) schedule(id string, at time.Time, height int64) (*proposal.Proposal, error) {
+	p, err := nc.store.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if p.Status != proposal.StatusDraft && p.Status != proposal.StatusScheduled {
+		return nil, errors.New("the proposal was already sent")
+	}
+
+	m, err := p.Decode()
+	if err != nil {
+		return nil, err
+	}
+
+	auth, err := nc.ac.Get()
+	if err != nil {
+		return nil, err
+	}
+
+	report := nc.validate(m, auth, m.Timestamp)
+	if !report.OK() {
+		return nil, errors.New(strings.Join(report.Errors, "; "))
+	}
+
+	_, closes := scheduleWindow(m, nc.profile.Window)
+	if time.Now().After(closes) {
+		return nil, fmt.Errorf("the timestamp window closed at %s", closes.UTC())
+	}
+	if at.After(closes) {
+		return nil, fmt.Errorf("the message has to be sent before the timestamp window closes at %s", closes.UTC())
+	}
+
+	if height > 0 {
+		heights, err := factom.GetHeights()
+		if err != nil {
+			return nil, err
+		}
+		head := heights.DirectoryBlockHeight
+		if expected := time.Now().Add(time.Duration(height-head) * blockTime); expected.After(closes) {
+			return nil, fmt.Errorf("block %d is expected around %s, after the timestamp window closes at %s",
+				height, expected.UTC().Format("2006-01-02 15:04"), closes.UTC())
+		}
+	}
+
+	if p, err = nc.store.MarkScheduled(p.ID, at, height); err != nil {
+		return nil, err
+	}
+	if err := nc.tracker.SendScheduled(); err != nil {
+		return nil, err
+	}
+	return nc.store.Get(p.ID)
+}
+
+// scheduleView is the schedule form of a draft, or the schedule of a
+// scheduled proposal
+type scheduleView struct {
+	ID    string
+	Draft bool
+	// Opens and Closes are the window the message can be sent in
+	Opens  string
+	Closes string
+	// Text describes the schedule of a scheduled proposal
+	Text string
+}
+
+// newScheduleView returns nil if the proposal can't be scheduled
+func newScheduleView(p *proposal.Proposal, m *authset.Message, window time.Duration) *scheduleView {
+	switch p.Status {
+	case proposal.StatusDraft:
+		opens, closes := scheduleWindow(m, window)
+		return &scheduleView{ID: p.ID, Draft: true, Opens: opens.UTC().Format("2006-01-02 15:04"), Closes: closes.UTC().Format("2006-01-02 15:04 MST")}
+	case proposal.StatusScheduled:
+		return &scheduleView{ID: p.ID, Text: scheduleText(p.Schedule)}
+	}
+	return nil
+}
+
+// proposalRow is a proposal in the list on the index page
+type proposalRow struct {
+	ID         string
+	Type       string
+	ChainID    string
+	ServerType string
+	Signatures int
+	Status     string
+	Updated    string
+	// Draft proposals can be bundled into a batch
+	Draft bool
+}
+
+// proposalRows returns the list of stored proposals
+func (nc *NetworkControl) proposalRows() ([]proposalRow, error) {
+	list, err := nc.store.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []proposalRow
+	for _, p := range list {
+		m, err := p.Decode()
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, proposalRow{
+			ID:         p.ID,
+			Type:       m.TypeName(),
+			ChainID:    m.ChainID,
+			ServerType: m.ServerType.String(),
+			Signatures: len(m.ValidSignatures()),
+			Status:     statusText(p),
+			Updated:    p.Updated.Format("2006-01-02 15:04:05"),
+			Draft:      p.Status == proposal.StatusDraft,
+		})
+	}
+	return rows, nil
+}
@@ -0,0 +1,234 @@
+// Package qr moves text across an air gap as QR codes. Content that doesn't
+// fit into one code is split into numbered frames that can be shown one
+// after another and put back together in any order after scanning.
+package qr
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"  // decode gif images
+	_ "image/jpeg" // decode jpeg images
+	_ "image/png"  // decode png images
+	"strconv"
+	"strings"
+
+	"github.com/makiuchi-d/gozxing"
+	zxqrcode "github.com/makiuchi-d/gozxing/qrcode"
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// DefaultChunk is the number of content bytes per frame. Codes of this size
+// are still easy to scan from a screen.
+const DefaultChunk = 300
+
+// prefix starts every frame
+const prefix = "NCQR:"
+
+var (
+	ErrNoFrames      = errors.New("no qr frames found")
+	ErrMixedFrames   = errors.New("the frames belong to different contents")
+	ErrFrameChecksum = errors.New("the joined frames do not match their checksum")
+	ErrInvalidFrame  = errors.New("invalid qr frame, expected " + prefix + "<n>/<total>:<id>:<data>")
+	ErrInvalidChunk  = errors.New("chunk size must be positive")
+	ErrNoCode        = errors.New("no qr code found in the image")
+)
+
+// Frame is one part of the split content
+type Frame struct {
+	Index int
+	Total int
+	// ID is the start of the sha256 of the whole content, so frames of
+	// different contents are not mixed up
+	ID   string
+	Data string
+}
+
+func (f Frame) String() string {
+	return fmt.Sprintf("%s%d/%d:%s:%s", prefix, f.Index, f.Total, f.ID, f.Data)
+}
+
+func contentID(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:4])
+}
+
+// Split cuts the content into frames of at most chunk bytes of data. Scanned
+// frames are passed around one per line, so the content is compacted first:
+// JSON is re-encoded without indentation and other text has its line breaks
+// replaced by spaces.
+func Split(content []byte, chunk int) ([]Frame, error) {
+	if chunk <= 0 {
+		return nil, ErrInvalidChunk
+	}
+
+	content = compact(content)
+
+	id := contentID(content)
+	total := (len(content) + chunk - 1) / chunk
+	if total == 0 {
+		total = 1
+	}
+
+	frames := make([]Frame, 0, total)
+	for i := 0; i < total; i++ {
+		end := (i + 1) * chunk
+		if end > len(content) {
+			end = len(content)
+		}
+		frames = append(frames, Frame{Index: i + 1, Total: total, ID: id, Data: string(content[i*chunk : end])})
+	}
+	return frames, nil
+}
+
+func compact(content []byte) []byte {
+	buf := new(bytes.Buffer)
+	if err := json.Compact(buf, content); err == nil {
+		return buf.Bytes()
+	}
+	return []byte(strings.Join(strings.Fields(string(content)), " "))
+}
+
+// IsFrame returns true if the text is a frame
+func IsFrame(s string) bool {
+	return strings.HasPrefix(strings.TrimSpace(s), prefix)
+}
+
+// ParseFrame parses the scanned text of a frame
+func ParseFrame(s string) (Frame, error) {
+	var f Frame
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, prefix) {
+		return f, ErrInvalidFrame
+	}
+
+	parts := strings.SplitN(s[len(prefix):], ":", 3)
+	if len(parts) != 3 {
+		return f, ErrInvalidFrame
+	}
+	pos := strings.SplitN(parts[0], "/", 2)
+	if len(pos) != 2 {
+		return f, ErrInvalidFrame
+	}
+
+	var err error
+	if f.Index, err = strconv.Atoi(pos[0]); err != nil {
+		return f, ErrInvalidFrame
+	}
+	if f.Total, err = strconv.Atoi(pos[1]); err != nil {
+		return f, ErrInvalidFrame
+	}
+	if f.Total < 1 || f.Index < 1 || f.Index > f.Total {
+		return f, ErrInvalidFrame
+	}
+
+	f.ID = parts[1]
+	f.Data = parts[2]
+	return f, nil
+}
+
+// Join puts the frames back together. Frames can be in any order and appear
+// more than once, since scanning an animated code sees every frame many
+// times.
+func Join(frames []Frame) ([]byte, error) {
+	if len(frames) == 0 {
+		return nil, ErrNoFrames
+	}
+
+	id, total := frames[0].ID, frames[0].Total
+	parts := make([]string, total)
+	have := make([]bool, total)
+	for _, f := range frames {
+		if f.ID != id || f.Total != total {
+			return nil, ErrMixedFrames
+		}
+		parts[f.Index-1] = f.Data
+		have[f.Index-1] = true
+	}
+
+	var missing []string
+	for i, ok := range have {
+		if !ok {
+			missing = append(missing, strconv.Itoa(i+1))
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("frames %s of %d are missing", strings.Join(missing, ", "), total)
+	}
+
+	content := []byte(strings.Join(parts, ""))
+	if contentID(content) != id {
+		return nil, ErrFrameChecksum
+	}
+	return content, nil
+}
+
+// JoinText joins frames given as scanned text, one per line. Lines that
+// are not frames are ignored.
+func JoinText(text []byte) ([]byte, error) {
+	var frames []Frame
+	scanner := bufio.NewScanner(bytes.NewReader(text))
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !IsFrame(line) {
+			continue
+		}
+		f, err := ParseFrame(line)
+		if err != nil {
+			return nil, err
+		}
+		frames = append(frames, f)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return Join(frames)
+}
+
+// PNG renders the text as a QR code image with the given width in pixels
+func PNG(text string, size int) ([]byte, error) {
+	return qrcode.Encode(text, qrcode.Medium, size)
+}
+
+// Terminal renders the text as a QR code made of block characters
+func Terminal(text string) (string, error) {
+	code, err := qrcode.New(text, qrcode.Medium)
+	if err != nil {
+		return "", err
+	}
+	return code.ToSmallString(false), nil
+}
+
+// IsImage returns true if the data is a png, jpeg or gif image
+func IsImage(data []byte) bool {
+	_, _, err := image.DecodeConfig(bytes.NewReader(data))
+	return err == nil
+}
+
+// Decode reads the QR code in a png, jpeg or gif image and returns its text.
+// Photos of a screen work as long as the code is in focus and not cut off.
+func Decode(data []byte) (string, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	bmp, err := gozxing.NewBinaryBitmapFromImage(img)
+	if err != nil {
+		return "", err
+	}
+
+	hints := map[gozxing.DecodeHintType]interface{}{gozxing.DecodeHintType_TRY_HARDER: true}
+	res, err := zxqrcode.NewQRCodeReader().Decode(bmp, hints)
+	if _, ok := err.(gozxing.NotFoundException); ok {
+		return "", ErrNoCode
+	} else if err != nil {
+		return "", err
+	}
+	return res.GetText(), nil
+}
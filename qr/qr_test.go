@@ -0,0 +1,176 @@
+package qr
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestSplitJoin(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		chunk   int
+		want    string
+		frames  int
+	}{
+		{"single", "0123456789abcdef", 300, "0123456789abcdef", 1},
+		{"exact", "0123456789abcdef", 8, "0123456789abcdef", 2},
+		{"uneven", "0123456789abcdef", 5, "0123456789abcdef", 4},
+		{"json", "{\n  \"version\": 1,\n  \"message\": \"0f\"\n}\n", 10, `{"version":1,"message":"0f"}`, 3},
+		{"text", "line one\nline  two\n", 4, "line one line two", 5},
+		{"empty", "", 10, "", 1},
+	}
+	for _, tt := range tests {
+		frames, err := Split([]byte(tt.content), tt.chunk)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if len(frames) != tt.frames {
+			t.Errorf("%s: %d frames, want %d", tt.name, len(frames), tt.frames)
+		}
+
+		// scanning sees the frames in any order and more than once
+		var scanned []Frame
+		for i := len(frames) - 1; i >= 0; i-- {
+			scanned = append(scanned, frames[i], frames[len(frames)-1-i])
+		}
+		got, err := Join(scanned)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s: joined %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := Split([]byte("abc"), 0); err != ErrInvalidChunk {
+		t.Errorf("chunk 0: got %v, want %v", err, ErrInvalidChunk)
+	}
+}
+
+func TestJoinErrors(t *testing.T) {
+	a, err := Split([]byte(strings.Repeat("a", 40)), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := Split([]byte(strings.Repeat("b", 40)), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Join(nil); err != ErrNoFrames {
+		t.Errorf("no frames: got %v, want %v", err, ErrNoFrames)
+	}
+	if _, err := Join([]Frame{a[0], a[1], b[2], a[3]}); err != ErrMixedFrames {
+		t.Errorf("mixed frames: got %v, want %v", err, ErrMixedFrames)
+	}
+
+	_, err = Join([]Frame{a[0], a[2]})
+	if err == nil || err.Error() != "frames 2, 4 of 4 are missing" {
+		t.Errorf("missing frames: got %v", err)
+	}
+
+	damaged := append([]Frame(nil), a...)
+	damaged[1].Data = "aaaaaaaaab"
+	if _, err := Join(damaged); err != ErrFrameChecksum {
+		t.Errorf("damaged frame: got %v, want %v", err, ErrFrameChecksum)
+	}
+}
+
+func TestParseFrame(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Frame
+		err  bool
+	}{
+		{"NCQR:1/2:0a1b2c3d:some data", Frame{Index: 1, Total: 2, ID: "0a1b2c3d", Data: "some data"}, false},
+		{"  NCQR:2/2:0a1b2c3d:a:b:c\n", Frame{Index: 2, Total: 2, ID: "0a1b2c3d", Data: "a:b:c"}, false},
+		{"NCQR:3/2:0a1b2c3d:data", Frame{}, true},
+		{"NCQR:0/2:0a1b2c3d:data", Frame{}, true},
+		{"NCQR:x/2:0a1b2c3d:data", Frame{}, true},
+		{"NCQR:1:0a1b2c3d:data", Frame{}, true},
+		{"NCQR:1/1:data", Frame{}, true},
+		{"1/1:0a1b2c3d:data", Frame{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseFrame(tt.in)
+		if (err != nil) != tt.err || (!tt.err && got != tt.want) {
+			t.Errorf("ParseFrame(%q) = %+v, %v", tt.in, got, err)
+		}
+	}
+
+	f := Frame{Index: 3, Total: 7, ID: "0a1b2c3d", Data: "x"}
+	if got, err := ParseFrame(f.String()); err != nil || got != f {
+		t.Errorf("round trip of %s: %+v, %v", f, got, err)
+	}
+}
+
+func TestJoinText(t *testing.T) {
+	content := []byte(strings.Repeat("0123456789", 10))
+	frames, err := Split(content, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var text strings.Builder
+	text.WriteString("scanned with my phone\n\n")
+	for i := len(frames) - 1; i >= 0; i-- {
+		text.WriteString(frames[i].String() + "\n")
+	}
+	got, err := JoinText([]byte(text.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("joined %q, want %q", got, content)
+	}
+
+	if _, err := JoinText([]byte("NCQR:broken\n")); err != ErrInvalidFrame {
+		t.Errorf("broken frame: got %v, want %v", err, ErrInvalidFrame)
+	}
+}
+
+func TestImageRoundTrip(t *testing.T) {
+	frames, err := Split([]byte(strings.Repeat("0123456789abcdef", 20)), DefaultChunk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range frames {
+		img, err := PNG(f.String(), 400)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !IsImage(img) {
+			t.Fatal("the png is not recognized as an image")
+		}
+		text, err := Decode(img)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if text != f.String() {
+			t.Errorf("decoded %q, want %q", text, f)
+		}
+	}
+	if _, err := Terminal(frames[0].String()); err != nil {
+		t.Error(err)
+	}
+
+	if IsImage([]byte(frames[0].String())) {
+		t.Error("text is recognized as an image")
+	}
+
+	blank := image.NewGray(image.Rect(0, 0, 100, 100))
+	for i := range blank.Pix {
+		blank.Pix[i] = 0xff
+	}
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, blank); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Decode(buf.Bytes()); err != ErrNoCode {
+		t.Errorf("blank image: got %v, want %v", err, ErrNoCode)
+	}
+}
@@ -0,0 +1,162 @@
+package networkcontrol
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"strings"
+
+	"github.com/WhoSoup/factom-networkcontrol/audit"
+	"github.com/WhoSoup/factom-networkcontrol/authset"
+	"github.com/WhoSoup/factom-networkcontrol/qr"
+	"github.com/labstack/echo/v4"
+)
+
+// qrView holds the QR codes of a message as data URIs
+type qrView struct {
+	// Payload is the signing hash
+	Payload template.URL
+	// Frames are the frames of the bundle, shown one after another
+	Frames []template.URL
+}
+
+// qrImage returns the text as a QR code in a data URI
+func qrImage(text string, size int) (template.URL, error) {
+	png, err := qr.PNG(text, size)
+	if err != nil {
+		return "", err
+	}
+	return template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(png)), nil
+}
+
+// qrView returns the signing payload and the bundle of the message as QR
+// codes
+func (nc *NetworkControl) qrView(m *authset.Message) (*qrView, error) {
+	v := new(qrView)
+	var err error
+	if v.Payload, err = qrImage(hex.EncodeToString(m.SigningHash), 256); err != nil {
+		return nil, err
+	}
+
+	data, err := authset.NewBundle(m, nc.profile.Network.String()).Encode()
+	if err != nil {
+		return nil, err
+	}
+	frames, err := qr.Split(data, qr.DefaultChunk)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range frames {
+		img, err := qrImage(f.String(), 360)
+		if err != nil {
+			return nil, err
+		}
+		v.Frames = append(v.Frames, img)
+	}
+	return v, nil
+}
+
+// qrImport adds the scanned signatures to the message. The scanned text is
+// either frames of a message or bundle, or a public key and signature.
+func (nc *NetworkControl) qrImport(c echo.Context) error {
+	m, err := authset.DecodeHex(c.FormValue("fullmsg"))
+	if err != nil {
+		return nc.printError(c, err)
+	}
+
+	text, err := scannedText(c)
+	if err != nil {
+		return nc.printError(c, err)
+	}
+	if qr.IsFrame(string(text)) {
+		if text, err = qr.JoinText(text); err != nil {
+			return nc.printError(c, err)
+		}
+	}
+
+	if pub, sig, ok := signaturePair(string(text)); ok {
+		r := audit.Record{Action: audit.Sign, Message: m.Hash(), Signer: hex.EncodeToString(pub)}
+		if err := nc.checkSigner(c, pub); err != nil {
+			nc.record(c, r, err)
+			return nc.printError(c, err)
+		}
+		signed, err := authset.AddSignature(m, pub, sig)
+		if err != nil {
+			nc.record(c, r, err)
+			return nc.printError(c, err)
+		}
+		return nc.showMessage(c, signed, r)
+	}
+
+	other, err := nc.decodeInput(text)
+	if err != nil {
+		return nc.printError(c, err)
+	}
+
+	r := audit.Record{Action: audit.Merge, Message: m.Hash()}
+	merged, err := authset.MergeSignatures(m, other)
+	if err == nil {
+		err = nc.checkMerge(c, m, merged)
+	}
+	if err != nil {
+		nc.record(c, r, err)
+		return nc.printError(c, err)
+	}
+	return nc.showMessage(c, merged, r)
+}
+
+// scannedText returns the pasted text and the codes of the uploaded images,
+// one per line. Codes that were both pasted and uploaded only appear once.
+func scannedText(c echo.Context) ([]byte, error) {
+	lines := strings.Split(c.FormValue("frames"), "\n")
+
+	if form, err := c.MultipartForm(); err == nil {
+		for _, fh := range form.File["images"] {
+			f, err := fh.Open()
+			if err != nil {
+				return nil, err
+			}
+			data, err := ioutil.ReadAll(f)
+			f.Close()
+			if err != nil {
+				return nil, err
+			}
+			text, err := qr.Decode(data)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", fh.Filename, err)
+			}
+			lines = append(lines, text)
+		}
+	}
+
+	var out []string
+	seen := make(map[string]bool)
+	for _, l := range lines {
+		l = strings.TrimSpace(l)
+		if l == "" || seen[l] {
+			continue
+		}
+		seen[l] = true
+		out = append(out, l)
+	}
+	return []byte(strings.Join(out, "\n")), nil
+}
+
+// signaturePair parses "<pubkey> <signature>" as hex
+func signaturePair(text string) (pub, sig []byte, ok bool) {
+	fields := strings.Fields(text)
+	if len(fields) != 2 {
+		return nil, nil, false
+	}
+	pub, err := hex.DecodeString(fields[0])
+	if err != nil || len(pub) != 32 {
+		return nil, nil, false
+	}
+	sig, err = hex.DecodeString(fields[1])
+	if err != nil || len(sig) != 64 {
+		return nil, nil, false
+	}
+	return pub, sig, true
+}
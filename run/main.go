@@ -1,20 +1,105 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/FactomProject/factom"
 	networkcontrol "github.com/WhoSoup/factom-networkcontrol"
+	"github.com/WhoSoup/factom-networkcontrol/audit"
+	"github.com/WhoSoup/factom-networkcontrol/authset"
+	"github.com/WhoSoup/factom-networkcontrol/proposal"
 )
 
 func main() {
-	factomd := flag.String("f", "https://api.factomd.net", "Specify the API endpoint to use")
+	config := flag.String("config", os.Getenv("NC_CONFIG"), "Config file with server settings and network profiles")
+	listen := flag.String("listen", "", "Address to listen on (default :8081)")
+	network := flag.String("network", "", "Name of the network profile to use (default mainnet)")
+	factomd := flag.String("f", "", "Specify the API endpoint to use instead of the one of the network profile")
+	db := flag.String("db", "", "Path to the proposal database (default networkcontrol.db)")
+	auditLog := flag.String("audit", "", "Path to the audit log (default networkcontrol-audit.jsonl)")
+	snapshot := flag.String("a", "", "Load the authority set from a snapshot file instead of the API")
+	keyfile := flag.String("key", "", "Load a block signing key to sign messages with (hex, sk1-sk4, idsec or factomd.conf)")
+	interval := flag.Duration("interval", 0, "How often the authority set is refreshed (default 5s)")
+	quorum := flag.String("quorum", "", "Quorum rule instead of the one of the network profile: fed (majority of feds), all (majority of all authorities) or a fixed <m>of<n>")
+	logFormat := flag.String("log", "", "Log format, text or json (default text)")
+	templates := flag.String("templates", "", "Directory with templates and a theme.css that replace the built-in ones")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [config check | password]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
 	flag.Parse()
-	factom.SetFactomdServer(*factomd)
-	fmt.Println("Using API:", *factomd)
+
+	settings, err := networkcontrol.LoadSettings(*config, os.LookupEnv)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// flags override the config file and the environment, but only if set
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "listen":
+			settings.Listen = *listen
+		case "network":
+			settings.Network = *network
+		case "f":
+			settings.Factomd = *factomd
+		case "db":
+			settings.DB = *db
+		case "audit":
+			settings.Audit = *auditLog
+		case "a":
+			settings.Snapshot = *snapshot
+		case "key":
+			settings.Key = *keyfile
+		case "interval":
+			settings.CacheTTL = *interval
+		case "quorum":
+			settings.Quorum = *quorum
+		case "log":
+			settings.LogFormat = *logFormat
+		case "templates":
+			settings.Templates = *templates
+		}
+	})
+
+	switch strings.Join(flag.Args(), " ") {
+	case "":
+	case "config check":
+		os.Exit(checkConfig(settings))
+	case "password":
+		os.Exit(hashPassword())
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if errs := settings.Check(); len(errs) > 0 {
+		for _, err := range errs {
+			log.Println(err)
+		}
+		log.Fatal("invalid configuration, see `run config check`")
+	}
+	if settings.LogFormat == "json" {
+		log.SetFlags(0)
+		log.SetOutput(jsonLog{os.Stderr})
+	}
+
+	profile, err := settings.Profile()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	factom.SetFactomdServer(profile.Factomd)
+	printSettings(settings, profile)
 
 	heights, err := factom.GetHeights()
 	if err != nil {
@@ -22,7 +107,144 @@ func main() {
 	}
 	fmt.Println("Using network at height:", heights.DirectoryBlockHeight)
 
-	srv := networkcontrol.CreateServer()
+	store, err := proposal.Open(settings.DB)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer store.Close()
+
+	auditlog, err := audit.Open(settings.Audit)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer auditlog.Close()
+
+	var cfg networkcontrol.Config
+	cfg.Store = store
+	cfg.Audit = auditlog
+	cfg.CacheInterval = settings.CacheTTL
+	cfg.Profile = profile
+	cfg.LogFormat = settings.LogFormat
+	cfg.Users = settings.Users
+	cfg.SessionTTL = settings.SessionTTL
+	cfg.IdentityInterval = settings.IdentityTTL
+	cfg.Operators = settings.Operators
+	cfg.URL = settings.URL
+	cfg.Mail = &settings.Mail
+	cfg.Templates, err = networkcontrol.LoadTemplates(settings.Templates)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if settings.Snapshot != "" {
+		cfg.Authorities = authset.NewSnapshotSource(settings.Snapshot)
+	}
+	if settings.Key != "" {
+		key, err := authset.LoadKey(settings.Key)
+		if err != nil {
+			log.Fatal(err)
+		}
+		cfg.SigningKey = key
+		fmt.Println("Using signing key:", key.Pub)
+	}
+
+	srv := networkcontrol.CreateServer(cfg)
 	defer srv.Shutdown(context.Background())
-	log.Fatal(srv.Start(":8081"))
+	if settings.TLSCert != "" {
+		log.Fatal(srv.StartTLS(settings.Listen, settings.TLSCert, settings.TLSKey))
+	}
+	log.Fatal(srv.Start(settings.Listen))
+}
+
+// printSettings prints the settings that are used
+func printSettings(s *networkcontrol.Settings, profile *networkcontrol.Profile) {
+	fmt.Printf("Using network profile: %s (%s)\n", profile.Name, profile.Network)
+	fmt.Println("Using API:", profile.Factomd)
+	fmt.Println("Using quorum rule:", profile.Quorum)
+	fmt.Println("Using timestamp window:", profile.Window)
+	fmt.Println("Using listen address:", s.Listen)
+	if s.TLSCert != "" {
+		fmt.Printf("Using TLS: %s, %s\n", s.TLSCert, s.TLSKey)
+	}
+	fmt.Println("Using database:", s.DB)
+	fmt.Println("Using audit log:", s.Audit)
+	fmt.Println("Using cache ttl:", s.CacheTTL)
+	fmt.Println("Using log format:", s.LogFormat)
+	if s.Templates != "" {
+		fmt.Println("Using templates:", s.Templates)
+	}
+	if len(s.Users) == 0 {
+		fmt.Println("WARNING: no user accounts configured, everyone who can reach the server can send messages")
+	} else {
+		fmt.Printf("Using %d user accounts, sessions last %s\n", len(s.Users), s.SessionTTL)
+	}
+	if s.Snapshot != "" {
+		fmt.Println("Using authority set snapshot:", s.Snapshot)
+	}
+	if s.Mail.Server != "" {
+		fmt.Printf("Using smtp server: %s, from %s\n", s.Mail.Server, s.Mail.From)
+	}
+}
+
+// checkConfig validates the settings without starting the server and
+// returns the exit code
+func checkConfig(s *networkcontrol.Settings) int {
+	errs := s.Check()
+	if profile, err := s.Profile(); err == nil {
+		printSettings(s, profile)
+		if s.Key != "" {
+			fmt.Println("Using signing key file:", s.Key)
+		}
+	}
+	if len(errs) > 0 {
+		fmt.Println()
+		for _, err := range errs {
+			fmt.Println("error:", err)
+		}
+		return 1
+	}
+	fmt.Println("configuration ok")
+	return 0
+}
+
+// hashPassword reads a password from stdin and prints its bcrypt hash for
+// the config file
+func hashPassword() int {
+	fmt.Fprint(os.Stderr, "Password: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		fmt.Fprintln(os.Stderr, "error: empty password")
+		return 1
+	}
+
+	hash, err := networkcontrol.HashPassword(password)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	fmt.Println(hash)
+	return 0
+}
+
+// jsonLog writes each log line as a json object
+type jsonLog struct {
+	w io.Writer
+}
+
+func (l jsonLog) Write(p []byte) (int, error) {
+	line, err := json.Marshal(map[string]string{
+		"time":    time.Now().Format(time.RFC3339),
+		"message": strings.TrimRight(string(p), "\n"),
+	})
+	if err != nil {
+		return 0, err
+	}
+	if _, err := l.w.Write(append(line, '\n')); err != nil {
+		return 0, err
+	}
+	return len(p), nil
 }
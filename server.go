@@ -1,678 +1,677 @@
 package networkcontrol
 
 import (
-	"bytes"
-	"crypto/sha256"
 	"encoding/hex"
 	"errors"
-	"fmt"
 	"net/http"
-	"regexp"
 	"strconv"
 	"time"
 
 	"github.com/FactomProject/factom"
-	"github.com/FactomProject/factomd/common/constants"
-	"github.com/FactomProject/factomd/common/interfaces"
-	"github.com/FactomProject/factomd/common/messages"
-	"github.com/FactomProject/factomd/common/messages/msgsupport"
 	"github.com/FactomProject/factomd/common/primitives"
+	"github.com/WhoSoup/factom-networkcontrol/audit"
+	"github.com/WhoSoup/factom-networkcontrol/authset"
+	"github.com/WhoSoup/factom-networkcontrol/identity"
+	"github.com/WhoSoup/factom-networkcontrol/proposal"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 )
 
 type NetworkControl struct {
-	ac *AuthCache
+	ac      *AuthCache
+	key     *primitives.PrivateKey
+	store   *proposal.Store
+	tracker *Tracker
+	// profile is the network the control panel is connected to. Its quorum
+	// rule decides which signatures count and how many are needed.
+	profile *Profile
+	// users are the operator accounts. Without any, everyone can do
+	// everything.
+	users     map[string]*User
+	sessions  *sessions
+	templates *Templates
+	// identities are the on-chain identities of the authorities and
+	// operators their names from the config file
+	identities *IdentityCache
+	operators  map[string]*Operator
+	// audit records every action, nil if there is no audit log
+	audit *audit.Log
 }
 
-const wrapper = `<!DOCTYPE html><html lang="en"><head><title>Network Control</title>
-<style type="text/css">
-* {
-	font-family: sans-serif;
+// Config holds the settings of the control panel
+type Config struct {
+	// SigningKey is an optional block signing key that the control panel
+	// can sign messages with directly
+	SigningKey *primitives.PrivateKey
+	// Authorities is where the authority set is loaded from. Defaults to the
+	// factomd API.
+	Authorities authset.AuthoritySource
+	// Store keeps messages as proposals that accumulate signatures. If nil,
+	// messages are only passed along in the forms.
+	Store *proposal.Store
+	// Profile is the network the control panel is connected to. It is shown
+	// on every page and sets the quorum rule and timestamp window. The API
+	// endpoint has to be set with factom.SetFactomdServer. Defaults to the
+	// built-in mainnet profile.
+	Profile *Profile
+	// CacheInterval is how long the authority set is cached before it is
+	// refreshed in the background. Defaults to 5 seconds.
+	CacheInterval time.Duration
+	// Users are the operator accounts that can log in. If empty, there is no
+	// login and everyone can do everything.
+	Users map[string]*User
+	// SessionTTL is how long a login lasts. Defaults to 12 hours.
+	SessionTTL time.Duration
+	// LogFormat is the format of the request log, "text" or "json".
+	// Defaults to text.
+	LogFormat string
+	// Templates are the html templates of the pages. Defaults to the
+	// built-in ones.
+	Templates *Templates
+	// Identities is where the identity chains of the authorities are read
+	// from. Defaults to the factomd API.
+	Identities identity.Source
+	// IdentityInterval is how often the identities are read again. Defaults
+	// to 10 minutes.
+	IdentityInterval time.Duration
+	// Operators are the names of the operators by identity chain id and
+	// their notification subscriptions. Notifications need a Store.
+	Operators map[string]*Operator
+	// URL is the public address of the control panel for links in
+	// notifications
+	URL string
+	// Mail is the SMTP server for operators subscribed by email
+	Mail *MailSettings
+	// Audit is the log that every action is recorded in. If nil, nothing is
+	// recorded.
+	Audit *audit.Log
 }
-.ms {
-	font-family: monospace;
-}
-td {
-	padding: 4px;
-}
-</style>
-%s
-</head><body>%s</body></html>`
 
-func CreateServer() *echo.Echo {
+// textLogFormat is the request log format for LogFormat "text"
+const textLogFormat = "${time_rfc3339} ${remote_ip} ${method} ${uri} ${status} ${latency_human} ${error}\n"
+
+func CreateServer(cfg Config) *echo.Echo {
 	nc := new(NetworkControl)
-	nc.ac = NewAuthCache(time.Second * 5)
+	if cfg.Authorities == nil {
+		cfg.Authorities = authset.LiveSource{}
+	}
+	if cfg.CacheInterval <= 0 {
+		cfg.CacheInterval = time.Second * 5
+	}
+	nc.ac = NewAuthCache(cfg.Authorities, cfg.CacheInterval)
+	go nc.ac.Run(nil)
+	nc.key = cfg.SigningKey
+	nc.store = cfg.Store
+	nc.profile = cfg.Profile
+	if nc.profile == nil {
+		nc.profile = DefaultProfiles()["mainnet"]
+	}
+	nc.users = cfg.Users
+	if cfg.SessionTTL <= 0 {
+		cfg.SessionTTL = 12 * time.Hour
+	}
+	nc.sessions = newSessions(cfg.SessionTTL)
+	nc.templates = cfg.Templates
+	if nc.templates == nil {
+		nc.templates = defaultTemplates()
+	}
+	if cfg.Identities == nil {
+		cfg.Identities = identity.LiveSource{}
+	}
+	if cfg.IdentityInterval <= 0 {
+		cfg.IdentityInterval = 10 * time.Minute
+	}
+	nc.identities = NewIdentityCache(cfg.Identities, cfg.IdentityInterval)
+	go nc.identities.Run(nc.ac, nil)
+	nc.operators = cfg.Operators
+	nc.audit = cfg.Audit
+	if nc.store != nil && subscribed(nc.operators) {
+		n := NewNotifier(nc.ac, nc.profile, nc.operators, cfg.Mail, cfg.URL)
+		nc.store.Watch(n.Observe)
+		go n.Run(nil)
+	}
+	if nc.store != nil {
+		send := func(m *authset.Message) error { return nc.sendChecked(nil, m) }
+		nc.tracker = NewTracker(nc.store, nc.ac, nc.profile, nc.validate, send, time.Minute)
+		nc.tracker.Audit(func(r audit.Record, err error) { nc.record(nil, r, err) })
+		go nc.tracker.Run(nil)
+	}
 
 	e := echo.New()
 
 	// Middleware
-	e.Use(middleware.Logger())
+	if cfg.LogFormat == "json" {
+		e.Use(middleware.Logger())
+	} else {
+		e.Use(middleware.LoggerWithConfig(middleware.LoggerConfig{Format: textLogFormat}))
+	}
 	e.Use(middleware.Recover())
-
-	e.GET("/craft/:action/:chainid", nc.craft)
-	e.GET("/", nc.index)
-	e.POST("/import", nc.imp)
-	e.POST("/create", nc.create)
-	e.POST("/sign", nc.sign)
-	e.POST("/submit", nc.submit)
-	e.POST("/send", nc.send)
-	e.POST("/merge", nc.merge)
+	// every form carries a token that other sites can't read, the API only
+	// takes JSON or a bearer token, which browsers don't send on their own
+	e.Use(middleware.CSRFWithConfig(middleware.CSRFConfig{
+		Skipper:        isAPI,
+		TokenLookup:    "form:csrf",
+		CookieName:     "nc_csrf",
+		CookiePath:     "/",
+		CookieHTTPOnly: true,
+	}))
+
+	viewer := nc.require(RoleViewer)
+	proposer := nc.require(RoleProposer)
+	signer := nc.require(RoleSigner)
+	sender := nc.require(RoleSender)
+
+	e.GET("/theme.css", nc.theme)
+	e.GET("/login", nc.loginPage)
+	e.POST("/login", nc.login)
+	e.POST("/logout", nc.logout)
+	e.GET("/craft/:action/:chainid", nc.craft, viewer)
+	e.GET("/", nc.index, viewer)
+	e.POST("/import", nc.imp, proposer)
+	e.POST("/create", nc.create, proposer)
+	e.POST("/sign", nc.sign, signer)
+	e.POST("/signkey", nc.signkey, signer)
+	e.POST("/submit", nc.submit, viewer)
+	e.POST("/send", nc.send, sender)
+	e.POST("/merge", nc.merge, proposer)
+	e.POST("/bundle", nc.bundle, viewer)
+	e.POST("/qr/import", nc.qrImport, proposer)
+	e.GET("/proposal/:id", nc.proposal, viewer)
+	e.GET("/proposal/:id/coverage", nc.coverage, viewer)
+	e.POST("/proposal/:id/delete", nc.deleteProposal, proposer)
+	e.POST("/proposal/:id/schedule", nc.scheduleProposal, sender)
+	e.POST("/proposal/:id/unschedule", nc.unscheduleProposal, sender)
+	e.POST("/batch", nc.createBatch, proposer)
+	e.GET("/batch/:id", nc.batch, viewer)
+	e.GET("/identity/:chainid", nc.identityPage, viewer)
+	e.GET("/audit", nc.auditPage, viewer)
+	e.GET("/audit.jsonl", nc.auditExport, viewer)
+	e.POST("/batch/:id/signkey", nc.batchSignKey, signer)
+	e.POST("/batch/:id/sign", nc.batchSign, signer)
+	e.POST("/batch/:id/send", nc.batchSend, sender)
+	e.POST("/batch/:id/delete", nc.deleteBatch, proposer)
+
+	nc.registerAPI(e.Group("/api/v1"))
 
 	return e
 }
 
-func printError(c echo.Context, err error) error {
-	var out bytes.Buffer
-
-	fmt.Fprintf(&out, wrapper, "", fmt.Sprintf("<h1>ERROR</h1>%s", err.Error()))
-	return c.HTMLBlob(http.StatusOK, out.Bytes())
+func (nc *NetworkControl) printError(c echo.Context, err error) error {
+	return nc.render(c, http.StatusOK, "error", err.Error())
 }
 
 func (nc *NetworkControl) imp(c echo.Context) error {
-	fdata := c.FormValue("fullmsg")
+	data, err := formInput(c, "fullmsg")
+	if err != nil {
+		return nc.printError(c, err)
+	}
 
-	data, err := hex.DecodeString(fdata)
+	m, err := nc.decodeInput(data)
 	if err != nil {
-		return printError(c, err)
+		return nc.printError(c, err)
 	}
 
-	return nc.printMessage(c, data)
+	return nc.showMessage(c, m, audit.Record{Action: audit.Import})
+}
+
+// indexView is the data of the index page
+type indexView struct {
+	Store       bool
+	Proposals   []proposalRow
+	Batches     []batchRow
+	Authorities []authorityRow
+}
+
+// authorityRow is an authority with its operator and identity status
+type authorityRow struct {
+	*factom.Authority
+	Operator *Operator
+	// Identity is the short identity status and IdentityWarnings what is
+	// wrong with it
+	Identity         string
+	IdentityWarnings []string
 }
 
 func (nc *NetworkControl) index(c echo.Context) error {
 	auth, err := nc.ac.Get()
 	if err != nil {
-		return printError(c, err)
+		return nc.printError(c, err)
 	}
 
-	out := new(bytes.Buffer)
-
-	fmt.Fprintf(out, `<h2><a href="/craft/add/new">Craft New Message</a></h2>`)
-
-	fmt.Fprintf(out, `<h2>Import Message</h2>
-	<form action="/import" method="POST">
-	<table><tr><td>Message</td><td><textarea name="fullmsg" cols="60" rows="5"></textarea></td></tr><tr><td></td><td><button type="submit">Import</button></td></tr></table>
-	</form>
-	`)
-
-	fmt.Fprintf(out, "<h2>Authorities</h2><table><tr><td><b>Identity Chain ID</b></td><td><b>PubKey</b></td><td><b>Status</b></td><td colspan=\"2\"></td></tr>")
+	v := indexView{Store: nc.store != nil}
 	for _, a := range auth {
-		pd := "Promote"
-		if a.Status == "federated" {
-			pd = "Demote"
+		row := authorityRow{Authority: a, Operator: nc.operators[a.AuthorityChainID]}
+		row.Identity, row.IdentityWarnings = nc.identityStatus(a)
+		v.Authorities = append(v.Authorities, row)
+	}
+	if nc.store != nil {
+		if v.Proposals, err = nc.proposalRows(); err != nil {
+			return nc.printError(c, err)
+		}
+		if v.Batches, err = nc.batchRows(); err != nil {
+			return nc.printError(c, err)
 		}
-		fmt.Fprintf(out, fmt.Sprintf(`<tr><td class="ms">%s</td><td class="ms">%s</td><td>%s</td><td><a href="/craft/add/%[1]s">%[4]s</a></td><td><a href="/craft/remove/%[1]s">Remove</a></td></tr>`, a.AuthorityChainID, a.SigningKey, a.Status, pd))
 	}
-	fmt.Fprintf(out, "</table>")
 
-	return c.HTML(http.StatusOK, fmt.Sprintf(wrapper, "", out.String()))
+	return nc.render(c, http.StatusOK, "index", v)
 }
 
-var isHex = regexp.MustCompile("^[a-fA-F0-9]{64}$")
+// craftView is the data of the form to create a message
+type craftView struct {
+	Action    string
+	Chain     string
+	Timestamp int64
+	// ServerType is the preselected server type
+	ServerType string
+}
 
 func (nc *NetworkControl) craft(c echo.Context) error {
 	action := c.Param("action")
 	chain := c.Param("chainid")
 	if chain == "new" {
 		chain = ""
-	} else if len(chain) != 64 || !isHex.Match([]byte(chain)) {
-		return printError(c, errors.New("chain must be 32 bytes hex"))
-	}
-
-	checked := func(s string) string {
-		if action == s {
-			return ` checked="checked"`
-		}
-		return ""
+	} else if !authset.IsChainID(chain) {
+		return nc.printError(c, authset.ErrInvalidChainID)
 	}
 
 	exists, err := nc.ac.GetSpecific(chain)
 	if err != nil {
-		return printError(c, err)
-	}
-
-	checked2 := func(s string) string {
-		if exists != nil {
-			fmt.Println(action, exists.Status, s)
-			if action == "remove" && exists.Status == s {
-				return ` checked="checked"`
-			}
-			if action == "add" && exists.Status != s {
-				return ` checked="checked"`
-			}
+		return nc.printError(c, err)
+	}
+
+	// preselect the server type the change leads to
+	var serverType string
+	if exists != nil {
+		switch {
+		case action == "remove":
+			serverType = exists.Status
+		case action == "add" && exists.Status == "federated":
+			serverType = "audit"
+		case action == "add":
+			serverType = "federated"
 		}
-		return ""
-	}
-
-	ts := primitives.NewTimestampNow()
-	out := new(bytes.Buffer)
-	fmt.Fprintf(out, `<script type="text/javascript">
-function updateTime() {
-	let f = document.getElementById('ts');
-	let millis = parseInt(f.value, 10);
-	let date = new Date(millis);
-	
-	document.getElementById('tstext').innerText = date.toUTCString();
-}
-window.addEventListener('DOMContentLoaded', (event) => {
-	updateTime();
-});
-</script>`)
-	fmt.Fprintf(out, `<form method="post" action="/create"><table>`)
-	fmt.Fprintf(out, `<tr><td colspan="2"><h1>Create New Message</h1></td></tr>`)
-	fmt.Fprintf(out, `<tr><td></td><td>
-		<label for="addserver"><input type="radio" name="msgtype" value="add" id="addserver"%s> Add Server</label>
-		<label for="removeserver"><input type="radio" name="msgtype" value="remove" id="removeserver"%s> Remove Server</label>
-	</td></tr>`, checked("add"), checked("remove"))
-	fmt.Fprintf(out, `<tr><td>Chain ID</td><td><input type="text" name="chainid" size="64" value="%s"></td></tr>`, chain)
-	fmt.Fprintf(out, `<tr><td>Timestamp (milliseconds)</td><td><input type="text" name="timestamp" size="15" value="%d" id="ts" onchange="updateTime()" onkeyup="updateTime()"> <span id="tstext"></span></td></tr>`, ts.GetTimeMilli())
-	fmt.Fprintf(out, `<tr><td></td><td>
-		<label for="fedserver"><input type="radio" name="servertype" value="federated" id="fedserver"%s> Federated</label>
-		<label for="auditserver"><input type="radio" name="servertype" value="audit" id="auditserver"%s> Audit</label>
-	</td></tr>`, checked2("federated"), checked2("audit"))
-	fmt.Fprintf(out, `<tr><td></td><td><button type="submit">Create Base Message</button></td></tr>`)
-	fmt.Fprintf(out, `</table></form>`)
-	return c.HTML(http.StatusOK, fmt.Sprintf(wrapper, "", out.String()))
+	}
+
+	return nc.render(c, http.StatusOK, "craft", craftView{
+		Action:     action,
+		Chain:      chain,
+		Timestamp:  primitives.NewTimestampNow().GetTimeMilli(),
+		ServerType: serverType,
+	})
 }
 
 func (nc *NetworkControl) create(c echo.Context) error {
-	msgtype := c.FormValue("msgtype")
-	chainid := c.FormValue("chainid")
-	timestampString := c.FormValue("timestamp")
-	timestamp, err := strconv.Atoi(timestampString)
+	timestamp, err := strconv.Atoi(c.FormValue("timestamp"))
 	if err != nil {
-		return printError(c, err)
+		return nc.printError(c, err)
 	}
-	servertype := c.FormValue("servertype")
+	ts := time.Unix(0, int64(timestamp)*int64(time.Millisecond))
 
-	out := new(bytes.Buffer)
-	if msgtype == "add" {
-		out.WriteByte(constants.ADDSERVER_MSG)
-	} else {
-		out.WriteByte(constants.REMOVESERVER_MSG)
+	st := authset.Federated
+	if c.FormValue("servertype") != "federated" {
+		st = authset.Audit
 	}
 
-	ts := primitives.NewTimestampFromMilliseconds(uint64(timestamp))
-	tsbin, err := ts.MarshalBinary()
-	if err != nil {
-		return printError(c, err)
+	var m *authset.Message
+	switch c.FormValue("msgtype") {
+	case "add":
+		m, err = authset.BuildAddServer(c.FormValue("chainid"), st, ts)
+	case "key":
+		priority, perr := strconv.Atoi(c.FormValue("priority"))
+		if perr != nil {
+			return nc.printError(c, perr)
+		}
+		var kc authset.KeyChange
+		if kc, err = authset.ParseKeyChange(c.FormValue("keykind"), c.FormValue("key"), priority, c.FormValue("keytype")); err != nil {
+			return nc.printError(c, err)
+		}
+		m, err = authset.BuildChangeKey(c.FormValue("chainid"), kc, ts)
+	default:
+		m, err = authset.BuildRemoveServer(c.FormValue("chainid"), st, ts)
 	}
-
-	out.Write(tsbin)
-
-	hex, err := hex.DecodeString(chainid)
 	if err != nil {
-		return printError(c, err)
+		return nc.printError(c, err)
 	}
-	if len(hex) != 32 {
-		return errors.New("chainid not 32 bytes long")
-	}
-
-	out.Write(hex)
 
-	if servertype == "federated" {
-		out.WriteByte(0)
-	} else {
-		out.WriteByte(1)
-	}
+	return nc.showMessage(c, m, audit.Record{Action: audit.Create})
+}
 
-	return nc.printMessage(c, out.Bytes())
+// messageView is the data of the message page
+type messageView struct {
+	Store bool
+	Hash  string
+	// Status is the status of the proposal, if there is one
+	Status       string
+	Raw          string
+	Type         string
+	Summary      string
+	Time         time.Time
+	TimeRelative time.Duration
+	ChainID      string
+	KeyChange    *keyChangeView
+	ServerType   string
+	// Payload is what Kambani signs
+	Payload         string
+	SigningHash     string
+	Signers         int
+	Required        int
+	Rule            string
+	SingleSignature bool
+	Signatures      []signatureRow
+	// ServerKey is the public key the server can sign with, if it has one
+	ServerKey       string
+	ServerKeySigner string
+	QR              *qrView
+	Schedule        *scheduleView
 }
 
-func (nc *NetworkControl) printMessage(c echo.Context, data []byte) error {
+type keyChangeView struct {
+	Kind     string
+	Key      string
+	Anchor   bool
+	Priority int
+	KeyType  string
+}
 
-	var msg interfaces.IMsg
-	var err error
-	if msg, err = msgsupport.UnmarshalMessage(data); err != nil {
-		return printError(c, err)
-	}
+type signatureRow struct {
+	// Authority is the identity chain id of the signer, empty if the key
+	// does not belong to a current authority
+	Authority string
+	// Operator is the operator of the signer if known
+	Operator *Operator
+	Role     string
+	PubKey   string
+	Valid    bool
+	Counts   bool
+}
 
+func (nc *NetworkControl) printMessage(c echo.Context, m *authset.Message) error {
 	auth, err := nc.ac.Get()
 	if err != nil {
-		return printError(c, err)
-	}
-
-	var typ string
-	var chain string
-	var stype int
-	var sigs, validsigs []interfaces.IFullSignature
-	var payload []byte
-	switch msg.Type() {
-	case constants.ADDSERVER_MSG:
-		add := msg.(*messages.AddServerMsg)
-		chain = add.ServerChainID.String()
-		typ = "Add Server"
-		stype = add.ServerType
-		sigs = add.GetSignatures()
-		validsigs, err = add.VerifySignatures()
-		if err != nil {
-			return printError(c, err)
-		}
-		payload, err = add.MarshalForSignature()
-		if err != nil {
-			return printError(c, err)
+		return nc.printError(c, err)
+	}
+
+	rule := nc.profile.Quorum.ForMessage(m)
+	v := messageView{
+		Store:           nc.store != nil,
+		Hash:            m.Hash(),
+		Raw:             m.Hex(),
+		Type:            m.TypeName(),
+		Summary:         authset.Summary(m),
+		Time:            m.Timestamp,
+		TimeRelative:    time.Until(m.Timestamp),
+		ChainID:         m.ChainID,
+		ServerType:      m.ServerType.String(),
+		Payload:         hex.EncodeToString(m.Payload),
+		SigningHash:     hex.EncodeToString(m.SigningHash),
+		Rule:            rule.String(),
+		SingleSignature: m.SingleSignature(),
+	}
+	v.Signers, v.Required = rule.Tally(m, auth)
+
+	if kc := m.KeyChange; kc != nil {
+		v.KeyChange = &keyChangeView{
+			Kind:     kc.Kind.String(),
+			Key:      hex.EncodeToString(kc.Key),
+			Anchor:   kc.Kind == authset.AnchorKey,
+			Priority: int(kc.Priority),
+			KeyType:  kc.KeyTypeName(),
 		}
-	case constants.REMOVESERVER_MSG:
-		rem := msg.(*messages.RemoveServerMsg)
-		chain = rem.ServerChainID.String()
-		stype = rem.ServerType
-		typ = "Remove Server"
-		sigs = rem.GetSignatures()
-		validsigs, err = rem.VerifySignatures()
-		payload, err = rem.MarshalForSignature()
-		if err != nil {
-			return printError(c, err)
+	}
+
+	for _, s := range m.Signatures {
+		row := signatureRow{PubKey: hex.EncodeToString(s.PubKey), Valid: s.Valid}
+		a := authset.FindSigner(auth, s.PubKey)
+		if a != nil {
+			row.Authority = a.AuthorityChainID
+			row.Operator = nc.operators[a.AuthorityChainID]
+			row.Role = a.Status
 		}
-	default:
-		return printError(c, errors.New("invalid type"))
+		row.Counts = s.Valid && rule.Counts(a)
+		v.Signatures = append(v.Signatures, row)
 	}
 
-	valid := make(map[string]bool)
-	for _, v := range validsigs {
-		key := fmt.Sprintf("%x", v.GetKey())
-		valid[key] = true
+	if nc.key != nil {
+		v.ServerKey = nc.key.Pub.String()
+		if a := authset.FindSigner(auth, nc.key.Pub[:]); a != nil {
+			v.ServerKeySigner = a.AuthorityChainID
+		}
 	}
 
-	var sstype string
-	switch stype {
-	case 0:
-		sstype = "Federated"
-	case 1:
-		sstype = "Audit"
-	default:
-		return printError(c, errors.New("invalid server type"))
-	}
-
-	manualMsg := sha256.Sum256([]byte(fmt.Sprintf("%x", payload)))
-
-	out := new(bytes.Buffer)
-	fmt.Fprintf(out, `<script type="text/javascript">
-function signWithKambani() {
-	let requestID = Date.now();
-	let event = new CustomEvent('SigningRequest', {
-		detail: {
-			"requestId": requestID,
-			"requestType": "data",
-			"requestInfo": {
-				"data": "%x",
-				"keyType": "blockSigningKey",
-			},
-		},
-	});
-
-	window.dispatchEvent(event);
-}
-function toHex(bytes) {
-	return Array.from(bytes, b => { return ('0'+(b & 0xff).toString(16)).slice(-2);}).join('')
-}
-function fromHex(s) {
-	let res = [];
-	for (let i = 0; i < s.length; i += 2) {
-	  res.push(parseInt(s.substr(i, 2), 16));
+	if v.QR, err = nc.qrView(m); err != nil {
+		return nc.printError(c, err)
 	}
-	return res;
-}
 
-window.addEventListener("SigningResponse", event => {
-	console.log(event);
-	console.log(toHex(event.detail.message.data));
-	document.getElementById('pubkey').value = toHex(event.detail.publicKey.data);
-	document.getElementById('sig').value = toHex(event.detail.signature.data);
-});
-</script>`, payload)
-	fmt.Fprintf(out, `<form action="/submit" method="POST">`)
-	fmt.Fprintf(out, `<table>`)
-	fmt.Fprintf(out, `<tr><td colspan="2"><h1>Authset Management Message</h1></td></tr>`)
-	fmt.Fprintf(out, `<tr><td><b>Raw Message</b></td><td><textarea cols="64" rows="5" name="fullmsg">%x</textarea></td></tr>`, data)
-	fmt.Fprintf(out, `<tr><td></td><td><button type="submit">Pre-Send Checks</button></td></tr>`)
-	fmt.Fprintf(out, `<tr><td><b>Msg Type</b></td><td>%s</td></tr>`, typ)
-	fmt.Fprintf(out, `<tr><td><b>Time</b></td><td>%s</td></tr>`, msg.GetTimestamp().GetTime())
-	fmt.Fprintf(out, `<tr><td><b>Time Relative</b></td><td>%s</td></tr>`, time.Until(msg.GetTimestamp().GetTime()))
-	fmt.Fprintf(out, `<tr><td><b>Chain ID</b></td><td>%s</td></tr>`, chain)
-	fmt.Fprintf(out, `<tr><td><b>Server Type</b></td><td>%s</td></tr>`, sstype)
-	fmt.Fprintf(out, `</table>`)
-	fmt.Fprintf(out, `</form>`)
-
-	fmt.Fprintf(out, `<h1>Signatures</h1>`)
-
-	if len(sigs) > 0 {
-		fmt.Fprintf(out, "<table><tr><td><b>Identity Chain ID</b></td><td><b>PubKey</b></td><td><b>Valid</b></td></tr>")
-		for _, s := range sigs {
-			authid := "Not a valid server in the auth set"
-			key := fmt.Sprintf("%x", s.GetKey())
-			for _, a := range auth {
-				if key == a.SigningKey {
-					authid = a.AuthorityChainID
-					break
-				}
-			}
-
-			val := "No"
-			if valid[key] {
-				val = "Yes"
-			}
-
-			fmt.Fprintf(out, "<tr><td>%s</td><td>%s</td><td>%s</td></tr>", authid, key, val)
+	if nc.store != nil {
+		if p, err := nc.store.Get(m.Hash()); err == nil {
+			v.Status = statusText(p)
+			v.Schedule = newScheduleView(p, m, nc.profile.Window)
 		}
-		fmt.Fprintf(out, `</table>`)
-	} else {
-		fmt.Fprintf(out, `<div><i>None</i></div>`)
-	}
-
-	fmt.Fprintf(out, "<h1>Add Signature</h1>")
-	fmt.Fprintf(out, `<form method="POST" action="/sign">`)
-	fmt.Fprintf(out, `<input type="hidden" name="fullmsg" value="%x">`, data)
-	fmt.Fprintf(out, `<h3>Payload for Manual Signature</h3><textarea cols="64" rows="5">%x</textarea>`, manualMsg)
-	fmt.Fprintf(out, `<div>You can sign this payload using <a href="https://github.com/FactomProject/serveridentity/tree/master/signwithed25519" target="_blank">SignWithEd25519</a></div>`)
-	fmt.Fprintf(out, "<table>")
-	fmt.Fprintf(out, `<tr><td></td><td><button type="button" onclick="signWithKambani()">Sign with Kambani</button></td></tr>`)
-	fmt.Fprintf(out, `<tr><td>Public Key</td><td><input type="text" name="pubkey" size="32" id="pubkey"></td></tr>`)
-	fmt.Fprintf(out, `<tr><td>Signature</td><td><input type="text" name="sig" size="32" id="sig"></td></tr>`)
-	fmt.Fprintf(out, `<tr><td></td><td><button type="submit">Add</button></td></tr>`)
-	fmt.Fprintf(out, "</table>")
-
-	fmt.Fprintf(out, `</form>`)
-
-	fmt.Fprintf(out, "<h1>Import Signatures</h1>")
-	fmt.Fprintf(out, "Import the signatures from a message")
-	fmt.Fprintf(out, `<form method="POST" action="/merge">`)
-	fmt.Fprintf(out, `<input type="hidden" name="fullmsg" value="%x">`, data)
-	fmt.Fprintf(out, `<div><textarea cols="64" rows="5" name="othermsg"></textarea></div>`)
-	fmt.Fprintf(out, `<button type="submit">Merge Signatures</button>`)
-	fmt.Fprintf(out, `</form>`)
-
-	return c.HTML(http.StatusOK, fmt.Sprintf(wrapper, "", out.String()))
+	}
+
+	return nc.render(c, http.StatusOK, "message", v)
 }
 
 func (nc *NetworkControl) sign(c echo.Context) error {
-	ffullmsg := c.FormValue("fullmsg")
-	fpubkey := c.FormValue("pubkey")
-	fsig := c.FormValue("sig")
-
-	data, err := hex.DecodeString(ffullmsg)
+	m, err := authset.DecodeHex(c.FormValue("fullmsg"))
 	if err != nil {
-		return printError(c, err)
+		return nc.printError(c, err)
 	}
 
-	pubkey, err := hex.DecodeString(fpubkey)
+	pubkey, err := hex.DecodeString(c.FormValue("pubkey"))
 	if err != nil {
-		return printError(c, err)
+		return nc.printError(c, err)
 	}
 
-	sig, err := hex.DecodeString(fsig)
+	sig, err := hex.DecodeString(c.FormValue("sig"))
 	if err != nil {
-		return printError(c, err)
+		return nc.printError(c, err)
 	}
 
-	var msg interfaces.IMsg
-	if msg, err = msgsupport.UnmarshalMessage(data); err != nil {
-		return printError(c, err)
+	r := audit.Record{Action: audit.Sign, Message: m.Hash(), Signer: hex.EncodeToString(pubkey)}
+	if err := nc.checkSigner(c, pubkey); err != nil {
+		nc.record(c, r, err)
+		return nc.printError(c, err)
 	}
 
-	signature := new(primitives.Signature)
-	signature.SetPub(pubkey)
-	signature.SetSignature(sig)
-
-	switch msg.(type) {
-	case *messages.AddServerMsg:
-		add := msg.(*messages.AddServerMsg)
-		signeddata, err := add.MarshalForKambani()
-		if err != nil {
-			return printError(c, err)
-		}
-
-		if !signature.Verify(signeddata) {
-			return printError(c, errors.New("signature is invalid"))
-		}
-
-		add.Signatures.AddSignature(signature)
-	case *messages.RemoveServerMsg:
-		rem := msg.(*messages.RemoveServerMsg)
-		signeddata, err := rem.MarshalForKambani()
-		if err != nil {
-			return printError(c, err)
-		}
+	signed, err := authset.AddSignature(m, pubkey, sig)
+	if err != nil {
+		nc.record(c, r, err)
+		return nc.printError(c, err)
+	}
 
-		if !signature.Verify(signeddata) {
-			return printError(c, errors.New("signature is invalid"))
-		}
+	return nc.showMessage(c, signed, r)
+}
 
-		rem.Signatures.AddSignature(signature)
-	default:
-		return printError(c, fmt.Errorf("invalid message type: %d", msg.Type()))
+func (nc *NetworkControl) signkey(c echo.Context) error {
+	if nc.key == nil {
+		return nc.printError(c, errors.New("no signing key loaded"))
 	}
 
-	newdata, err := msg.MarshalBinary()
+	m, err := authset.DecodeHex(c.FormValue("fullmsg"))
 	if err != nil {
-		return printError(c, err)
+		return nc.printError(c, err)
 	}
 
-	return nc.printMessage(c, newdata)
-}
-
-func (nc *NetworkControl) submit(c echo.Context) error {
-	var info []string
-	var errors []string
-	out := new(bytes.Buffer)
+	r := audit.Record{Action: audit.Sign, Message: m.Hash(), Signer: nc.key.Pub.String()}
+	if err := nc.checkSigner(c, nc.key.Pub[:]); err != nil {
+		nc.record(c, r, err)
+		return nc.printError(c, err)
+	}
 
-	fullmsg := c.FormValue("fullmsg")
-	fullmsgbytes, err := hex.DecodeString(fullmsg)
+	auth, err := nc.ac.Get()
 	if err != nil {
-		return printError(c, err)
+		return nc.printError(c, err)
 	}
 
-	msg, err := msgsupport.UnmarshalMessage(fullmsgbytes)
+	signed, _, err := authset.SignAsAuthority(m, nc.key, auth)
 	if err != nil {
-		return printError(c, err)
+		nc.record(c, r, err)
+		return nc.printError(c, err)
 	}
 
-	ts := msg.GetTimestamp().GetTime()
-	now := time.Now()
-	diff := now.Sub(ts)
-
-	if diff > time.Hour || diff < -time.Hour {
-		errors = append(errors, fmt.Sprintf("The timestamp is outside the acceptable window. Must be sent between %s and %s.",
-			ts.Add(-time.Hour), ts.Add(time.Hour)))
-	}
+	return nc.showMessage(c, signed, r)
+}
 
-	var sigs []interfaces.IFullSignature
-	var server interfaces.IHash
-	serverType := 0
-	adding := false
+// submitView is the data of the pre-send checks page
+type submitView struct {
+	Info       []string
+	Errors     []string
+	Simulation *simulationView
+	Raw        string
+}
 
-	switch msg.(type) {
-	case *messages.AddServerMsg:
-		add := msg.(*messages.AddServerMsg)
-		if s, err := add.VerifySignatures(); err != nil {
-			return printError(c, err)
-		} else {
-			sigs = s
-			server = add.ServerChainID
-			serverType = add.ServerType
-		}
-		adding = true
-	case *messages.RemoveServerMsg:
-		rem := msg.(*messages.RemoveServerMsg)
-		if s, err := rem.VerifySignatures(); err != nil {
-			return printError(c, err)
-		} else {
-			sigs = s
-			server = rem.ServerChainID
-			serverType = rem.ServerType
-		}
-	default:
-		return printError(c, fmt.Errorf("invalid message type: %d", msg.Type()))
+func (nc *NetworkControl) submit(c echo.Context) error {
+	m, err := authset.DecodeHex(c.FormValue("fullmsg"))
+	if err != nil {
+		return nc.printError(c, err)
 	}
 
 	auth, err := nc.ac.Get()
 	if err != nil {
-		return printError(c, err)
+		return nc.printError(c, err)
 	}
-	countReal := 0
 
-	isAuth := false
-	isFed := false
+	report := nc.validate(m, auth, time.Now())
 
-	for _, sig := range sigs {
-		for _, a := range auth {
-			if fmt.Sprintf("%x", sig.GetKey()) == a.SigningKey {
-				countReal++
-				break
-			}
-		}
-	}
-
-	for _, a := range auth {
-		if server.String() == a.AuthorityChainID {
-			isAuth = true
-			if a.Status == "federated" {
-				isFed = true
-			}
-			break
-		}
-	}
-
-	if isAuth {
-		if adding {
-			if serverType == 0 { // to fed
-				if isFed {
-					errors = append(errors, "Promoting a node that is already a fed to fed")
-				} else {
-					info = append(info, "Promoting an Audit node to a Fed node and increasing # of feds")
-
-				}
-			} else if serverType == 1 { // to audit
-				if isFed {
-					info = append(info, "Demoting a Fed node to an Audit node and decreasing # of feds")
-				} else {
-					errors = append(errors, "Demoting a node that is an audit node to audit node")
-				}
-			}
-		}
-	} else { // new server
-		if adding {
-			typ := "Federated"
-			if serverType == 1 {
-				typ = "Audit"
-			}
-			info = append(info, fmt.Sprintf("Promoting a new server into the authority set as %s Node", typ))
-		} else {
-			errors = append(errors, "Trying to remove a server that's not in the authority set")
-		}
-	}
+	return nc.render(c, http.StatusOK, "submit", submitView{
+		Info:       report.Info,
+		Errors:     report.Errors,
+		Simulation: newSimulationView(report.Simulation),
+		Raw:        m.Hex(),
+	})
+}
 
-	if countReal < len(auth)/2+1 {
-		errors = append(errors, fmt.Sprintf("There are only %d valid signatures. Need at least %d to pass", countReal, len(auth)/2+1))
-	}
+// simulationView is the authority set before and after a change
+type simulationView struct {
+	FedBefore, FedAfter           int
+	AuditBefore, AuditAfter       int
+	RequiredBefore, RequiredAfter int
+	FaultsBefore, FaultsAfter     int
+	Warnings                      []string
+	Rows                          []simulationRow
+}
 
-	fmt.Fprintf(out, "<h2>Info</h2><ul>")
-	for _, i := range info {
-		fmt.Fprintf(out, "<li>%s</li>", i)
-	}
-	if len(info) == 0 {
-		fmt.Fprintf(out, "<li><i>None</i></li>")
-	}
-	fmt.Fprintf(out, "</ul>")
+type simulationRow struct {
+	ChainID string
+	Status  string
+	Added   bool
+	Removed bool
+	// From is the status before the change if it changed
+	From string
+}
 
-	fmt.Fprintf(out, "<h2>Errors</h2><ul>")
-	for _, e := range errors {
-		fmt.Fprintf(out, "<li>%s</li>", e)
-	}
-	if len(errors) == 0 {
-		fmt.Fprintf(out, "<li><i>None</i></li>")
+func newSimulationView(sim *authset.Simulation) *simulationView {
+	v := &simulationView{
+		FedBefore:      sim.FedBefore,
+		FedAfter:       sim.FedAfter,
+		AuditBefore:    sim.AuditBefore,
+		AuditAfter:     sim.AuditAfter,
+		RequiredBefore: sim.RequiredBefore,
+		RequiredAfter:  sim.RequiredAfter,
+		Warnings:       sim.Warnings,
+	}
+	v.FaultsBefore, v.FaultsAfter = sim.Faults()
+
+	before := make(map[string]string)
+	for _, a := range sim.Before {
+		before[a.AuthorityChainID] = a.Status
+	}
+	after := make(map[string]bool)
+
+	for _, a := range sim.After {
+		after[a.AuthorityChainID] = true
+		row := simulationRow{ChainID: a.AuthorityChainID, Status: a.Status}
+		if old, ok := before[a.AuthorityChainID]; !ok {
+			row.Added = true
+		} else if old != a.Status {
+			row.From = old
+		}
+		v.Rows = append(v.Rows, row)
 	}
-	fmt.Fprintf(out, "</ul>")
-
-	label := "Submit to Network"
-	if len(errors) > 0 {
-		label = "Submit to Network despite errors"
+	for _, a := range sim.Before {
+		if !after[a.AuthorityChainID] {
+			v.Rows = append(v.Rows, simulationRow{ChainID: a.AuthorityChainID, Status: a.Status, Removed: true})
+		}
 	}
-
-	fmt.Fprintf(out, `<form action="/send" method="POST">`)
-	fmt.Fprintf(out, `<input type="hidden" name="fullmsg" value="%s">`, fullmsg)
-	fmt.Fprintf(out, `<button type="submit">%s</button>`, label)
-	fmt.Fprintf(out, `</form>`)
-
-	return c.HTML(http.StatusOK, fmt.Sprintf(wrapper, "", out.String()))
+	return v
 }
 
 func (nc *NetworkControl) send(c echo.Context) error {
-	fullmsg := c.FormValue("fullmsg")
-	fullmsgbytes, err := hex.DecodeString(fullmsg)
+	m, err := authset.DecodeHex(c.FormValue("fullmsg"))
 	if err != nil {
-		return printError(c, err)
+		return nc.printError(c, err)
 	}
 
-	_, err = msgsupport.UnmarshalMessage(fullmsgbytes)
+	resp, p, err := nc.sendMessage(m)
+	nc.record(c, audit.Record{Action: audit.Send, Message: m.Hash()}, err)
 	if err != nil {
-		return printError(c, err)
+		return nc.printError(c, err)
 	}
 
-	factom.SendRawMsg(fullmsg)
-	return c.HTML(http.StatusOK, fmt.Sprintf(wrapper, "", "Message submitted. <a href=\"/\">Go back</a>"))
+	if p != nil {
+		return c.Redirect(http.StatusSeeOther, "/proposal/"+p.ID)
+	}
+	return nc.render(c, http.StatusOK, "sent", resp)
 }
 
-func merge(a, b interfaces.IFullSignatureBlock) {
-	has := make(map[string]bool)
-	for _, sig := range a.GetSignatures() {
-		has[fmt.Sprintf("%x", sig.GetKey())] = true
+// sendMessage submits the message to factomd. If there is a store, the
+// message is saved as a pending proposal for the tracker to watch.
+func (nc *NetworkControl) sendMessage(m *authset.Message) (string, *proposal.Proposal, error) {
+	var height int64
+	if nc.store != nil {
+		heights, err := factom.GetHeights()
+		if err != nil {
+			return "", nil, err
+		}
+		height = heights.DirectoryBlockHeight
 	}
 
-	for _, sig := range b.GetSignatures() {
-		if has[fmt.Sprintf("%x", sig.GetKey())] {
-			continue
-		}
-		a.AddSignature(sig)
+	resp, err := factom.SendRawMsg(m.Hex())
+	if err != nil {
+		return "", nil, err
 	}
-}
 
-func (nc *NetworkControl) merge(c echo.Context) error {
+	if nc.store == nil {
+		return resp, nil, nil
+	}
 
-	data, err := hex.DecodeString(c.FormValue("fullmsg"))
+	p, err := nc.store.Save(m)
 	if err != nil {
-		return printError(c, err)
+		return resp, nil, err
 	}
-
-	a, err := msgsupport.UnmarshalMessage(data)
+	p, err = nc.store.MarkSent(p.ID, height)
 	if err != nil {
-		return printError(c, err)
+		return resp, nil, err
 	}
+	return resp, p, nil
+}
 
-	data, err = hex.DecodeString(c.FormValue("othermsg"))
+func (nc *NetworkControl) merge(c echo.Context) error {
+	a, err := authset.DecodeHex(c.FormValue("fullmsg"))
 	if err != nil {
-		return printError(c, err)
+		return nc.printError(c, err)
 	}
 
-	b, err := msgsupport.UnmarshalMessage(data)
+	data, err := formInput(c, "othermsg")
 	if err != nil {
-		return printError(c, err)
+		return nc.printError(c, err)
 	}
 
-	switch a.(type) {
-	case *messages.AddServerMsg:
-		amsg := a.(*messages.AddServerMsg)
-		bmsg, ok := b.(*messages.AddServerMsg)
-		if !ok {
-			return printError(c, errors.New("mismatched message type"))
-		}
-
-		merge(amsg.Signatures, bmsg.Signatures)
-	case *messages.RemoveServerMsg:
-		amsg := a.(*messages.RemoveServerMsg)
-		bmsg, ok := b.(*messages.RemoveServerMsg)
-		if !ok {
-			return printError(c, errors.New("mismatched message type"))
-		}
-		merge(amsg.Signatures, bmsg.Signatures)
-	default:
-		return printError(c, errors.New("unknown message type"))
+	b, err := nc.decodeInput(data)
+	if err != nil {
+		return nc.printError(c, err)
 	}
 
-	data, err = a.MarshalBinary()
+	r := audit.Record{Action: audit.Merge, Message: a.Hash()}
+	merged, err := authset.MergeSignatures(a, b)
+	if err == nil {
+		err = nc.checkMerge(c, a, merged)
+	}
 	if err != nil {
-		return printError(c, err)
+		nc.record(c, r, err)
+		return nc.printError(c, err)
 	}
 
-	return nc.printMessage(c, data)
+	return nc.showMessage(c, merged, r)
 }
@@ -0,0 +1,116 @@
+package networkcontrol
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// view is the data every page is rendered with. Data holds the values of
+// the page itself.
+type view struct {
+	Profile *Profile
+	User    *User
+	// CSRF is the token every form has to send back
+	CSRF string
+	Data interface{}
+}
+
+//go:embed templates
+var embedded embed.FS
+
+// themeFile is the stylesheet that every page links to as /theme.css
+const themeFile = "theme.css"
+
+// templateFuncs are the functions the templates can use besides the built-in
+// ones
+var templateFuncs = template.FuncMap{
+	"join": strings.Join,
+}
+
+// Templates are the html templates of all pages and the stylesheet. Every
+// page starts with the "header" and ends with the "footer" template.
+type Templates struct {
+	pages *template.Template
+	theme []byte
+}
+
+// LoadTemplates parses the built-in templates and then the *.html files of
+// the directory, if set. A template defined in the directory replaces the
+// built-in one of the same name, so a file can override a single part like
+// "header" or a whole page. A theme.css in the directory replaces the
+// built-in stylesheet.
+func LoadTemplates(dir string) (*Templates, error) {
+	builtin, err := fs.Sub(embedded, "templates")
+	if err != nil {
+		return nil, err
+	}
+
+	t := new(Templates)
+	t.pages, err = template.New("pages").Funcs(templateFuncs).ParseFS(builtin, "*.html")
+	if err != nil {
+		return nil, err
+	}
+	t.theme, err = fs.ReadFile(builtin, themeFile)
+	if err != nil {
+		return nil, err
+	}
+	if dir == "" {
+		return t, nil
+	}
+
+	if fi, err := os.Stat(dir); err != nil {
+		return nil, err
+	} else if !fi.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.html"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) > 0 {
+		if t.pages, err = t.pages.ParseFiles(files...); err != nil {
+			return nil, err
+		}
+	}
+	if theme, err := ioutil.ReadFile(filepath.Join(dir, themeFile)); err == nil {
+		t.theme = theme
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	return t, nil
+}
+
+// defaultTemplates are the built-in templates
+func defaultTemplates() *Templates {
+	t, err := LoadTemplates("")
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// render writes the page with the given template name
+func (nc *NetworkControl) render(c echo.Context, status int, name string, data interface{}) error {
+	v := &view{Profile: nc.profile, User: currentUser(c), Data: data}
+	v.CSRF, _ = c.Get("csrf").(string)
+
+	buf := new(bytes.Buffer)
+	if err := nc.templates.pages.ExecuteTemplate(buf, name, v); err != nil {
+		return err
+	}
+	return c.HTMLBlob(status, buf.Bytes())
+}
+
+func (nc *NetworkControl) theme(c echo.Context) error {
+	return c.Blob(http.StatusOK, "text/css; charset=utf-8", nc.templates.theme)
+}
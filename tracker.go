@@ -0,0 +1,403 @@
+package networkcontrol
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/FactomProject/factom"
+	"github.com/WhoSoup/factom-networkcontrol/audit"
+	"github.com/WhoSoup/factom-networkcontrol/authset"
+	"github.com/WhoSoup/factom-networkcontrol/proposal"
+)
+
+// expiryGrace is how long after the timestamp window closes a message is
+// still looked for, since the block it was processed in may not be saved yet
+const expiryGrace = 10 * time.Minute
+
+// scheduleMargin keeps scheduled messages away from the edges of the
+// timestamp window, in case the clocks of the server and the network differ
+const scheduleMargin = time.Minute
+
+// blockTime is the expected time between two directory blocks
+const blockTime = 10 * time.Minute
+
+// Tracker watches the admin blocks of the network for sent proposals and
+// records whether they were applied or expired. It also sends the messages
+// of batches one at a time and scheduled proposals once they are due.
+type Tracker struct {
+	store    *proposal.Store
+	ac       *AuthCache
+	profile  *Profile
+	validate func(m *authset.Message, auth []*factom.Authority, now time.Time) *authset.Report
+	send     func(m *authset.Message) error
+	interval time.Duration
+	record   func(r audit.Record, err error)
+
+	mtx sync.Mutex
+}
+
+// NewTracker creates a tracker that uses send to submit the next message of
+// a batch and scheduled proposals. Scheduled proposals are checked with
+// validate against the authority set of the cache, their schedule follows the
+// timestamp window of the profile.
+func NewTracker(store *proposal.Store, ac *AuthCache, profile *Profile, validate func(m *authset.Message, auth []*factom.Authority, now time.Time) *authset.Report, send func(m *authset.Message) error, interval time.Duration) *Tracker {
+	t := new(Tracker)
+	t.store = store
+	t.ac = ac
+	t.profile = profile
+	t.validate = validate
+	t.send = send
+	t.interval = interval
+	return t
+}
+
+// Audit calls f for every change the tracker makes to a proposal or batch on
+// its own. The actor of the records is left to f.
+func (t *Tracker) Audit(f func(r audit.Record, err error)) {
+	t.record = f
+}
+
+// audited records the change if there is an audit function
+func (t *Tracker) audited(r audit.Record, err error) {
+	if t.record != nil {
+		t.record(r, err)
+	}
+}
+
+// Run checks the pending proposals every interval until stop is closed
+func (t *Tracker) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := t.Check(); err != nil {
+			log.Printf("tracker: %v", err)
+		}
+		if err := t.AdvanceBatches(); err != nil {
+			log.Printf("tracker: %v", err)
+		}
+		if err := t.SendScheduled(); err != nil {
+			log.Printf("tracker: %v", err)
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check searches all admin blocks since the last check for the pending
+// proposals
+func (t *Tracker) Check() error {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	list, err := t.store.List()
+	if err != nil {
+		return err
+	}
+
+	var pending []*proposal.Proposal
+	for _, p := range list {
+		if p.Status == proposal.StatusPending {
+			pending = append(pending, p)
+		}
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	heights, err := factom.GetHeights()
+	if err != nil {
+		return err
+	}
+	head := heights.DirectoryBlockHeight
+
+	blocks := make(map[int64]*factom.ABlock)
+	for _, p := range pending {
+		m, err := p.Decode()
+		if err != nil {
+			return err
+		}
+
+		applied := false
+		for h := p.Checked + 1; h <= head; h++ {
+			ab, ok := blocks[h]
+			if !ok {
+				if ab, _, err = factom.GetABlockByHeight(h); err != nil {
+					return fmt.Errorf("unable to get admin block %d: %v", h, err)
+				}
+				blocks[h] = ab
+			}
+
+			if authset.AppliedIn(m, ab) {
+				_, err := t.store.MarkApplied(p.ID, h)
+				t.audited(audit.Record{Action: audit.Applied, Message: p.ID, Height: h}, err)
+				if err != nil {
+					return err
+				}
+				applied = true
+				break
+			}
+		}
+
+		if applied {
+			continue
+		}
+
+		if head > p.Checked {
+			if _, err := t.store.MarkChecked(p.ID, head); err != nil {
+				return err
+			}
+		}
+
+		if time.Since(m.Timestamp) > t.profile.Window+expiryGrace {
+			_, err := t.store.MarkExpired(p.ID)
+			t.audited(audit.Record{Action: audit.Expired, Message: p.ID}, err)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// AdvanceBatches moves every sending batch forward. A batch that can't be
+// advanced is marked as failed, so it doesn't hold up the others.
+func (t *Tracker) AdvanceBatches() error {
+	list, err := t.store.Batches()
+	if err != nil {
+		return err
+	}
+
+	for _, b := range list {
+		if b.Status != proposal.BatchSending {
+			continue
+		}
+		if err := t.Advance(b.ID); err != nil {
+			log.Printf("tracker: batch %s: %v", b.ID, err)
+			t.mtx.Lock()
+			if err := t.failBatch(b, fmt.Sprintf("unable to advance the batch: %v", err)); err != nil {
+				log.Printf("tracker: batch %s: %v", b.ID, err)
+			}
+			t.mtx.Unlock()
+		}
+	}
+	return nil
+}
+
+// Advance sends the next message of the batch once the previous one was
+// applied. A message is only sent after the one before it is in an admin
+// block, so its signatures are checked against the authority set that the
+// earlier messages produced.
+func (t *Tracker) Advance(id string) error {
+	return t.AdvanceWith(id, t.send)
+}
+
+// AdvanceWith is Advance with another send function, for batches that a user
+// starts
+func (t *Tracker) AdvanceWith(id string, send func(m *authset.Message) error) error {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	b, err := t.store.GetBatch(id)
+	if err != nil {
+		return err
+	}
+
+	for b.Status == proposal.BatchSending {
+		p, err := t.store.Get(b.Proposals[b.Next])
+		if err != nil {
+			return err
+		}
+
+		switch p.Status {
+		case proposal.StatusPending:
+			return nil
+		case proposal.StatusApplied:
+			if b, err = t.store.AdvanceBatch(id); err != nil {
+				return err
+			}
+		case proposal.StatusExpired:
+			return t.failBatch(b, fmt.Sprintf("message %d of %d expired", b.Next+1, len(b.Proposals)))
+		default:
+			m, err := p.Decode()
+			if err != nil {
+				return err
+			}
+			if err := send(m); err != nil {
+				return t.failBatch(b, fmt.Sprintf("unable to send message %d of %d: %v", b.Next+1, len(b.Proposals), err))
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+// failBatch stops the batch and records the reason as the result
+func (t *Tracker) failBatch(b *proposal.Batch, reason string) error {
+	r := audit.Record{Action: audit.BatchFail, Batch: b.ID, Message: b.Proposals[b.Next]}
+	if _, err := t.store.FailBatch(b.ID, reason); err != nil {
+		t.audited(r, err)
+		return err
+	}
+	t.audited(r, errors.New(reason))
+	return nil
+}
+
+// cancelSchedule cancels the schedule of the proposal and records the reason
+// as the result
+func (t *Tracker) cancelSchedule(id, reason string) error {
+	r := audit.Record{Action: audit.ScheduleCancel, Message: id}
+	if _, err := t.store.CancelSchedule(id, reason); err != nil {
+		t.audited(r, err)
+		return err
+	}
+	t.audited(r, errors.New(reason))
+	return nil
+}
+
+// SendScheduled sends the scheduled proposals that are due. A schedule is
+// cancelled if the message no longer passes the pre-send checks, for example
+// because the authority set changed, or if the timestamp window closes
+// before the schedule is due.
+func (t *Tracker) SendScheduled() error {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	list, err := t.store.List()
+	if err != nil {
+		return err
+	}
+
+	var scheduled []*proposal.Proposal
+	for _, p := range list {
+		if p.Status == proposal.StatusScheduled {
+			scheduled = append(scheduled, p)
+		}
+	}
+	if len(scheduled) == 0 {
+		return nil
+	}
+
+	auth, err := t.ac.Get()
+	if err != nil {
+		return err
+	}
+
+	var head int64
+	for _, p := range scheduled {
+		if p.Schedule.Height > 0 {
+			heights, err := factom.GetHeights()
+			if err != nil {
+				return err
+			}
+			head = heights.DirectoryBlockHeight
+			break
+		}
+	}
+
+	now := time.Now()
+	for _, p := range scheduled {
+		m, err := p.Decode()
+		if err != nil {
+			return err
+		}
+
+		opens, closes := scheduleWindow(m, t.profile.Window)
+		if now.After(closes) {
+			if err := t.cancelSchedule(p.ID, "the timestamp window closed before the schedule was due"); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// the timestamp is checked separately, so it is validated as if it
+		// were sent at its own timestamp
+		report := t.validate(m, auth, m.Timestamp)
+		if !report.OK() {
+			reason := "the message no longer passes the pre-send checks: " + strings.Join(report.Errors, "; ")
+			if err := t.cancelSchedule(p.ID, reason); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if now.Before(opens) || now.Before(p.Schedule.At) || head < p.Schedule.Height {
+			continue
+		}
+
+		if err := t.send(m); err != nil {
+			if err := t.cancelSchedule(p.ID, fmt.Sprintf("unable to send: %v", err)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Unschedule removes the schedule of the proposal
+func (t *Tracker) Unschedule(id string) (*proposal.Proposal, error) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	return t.store.CancelSchedule(id, "")
+}
+
+// scheduleWindow is the time in which a scheduled message is sent, the
+// timestamp window minus the margin on both sides
+func scheduleWindow(m *authset.Message, window time.Duration) (opens, closes time.Time) {
+	return m.Timestamp.Add(-window + scheduleMargin), m.Timestamp.Add(window - scheduleMargin)
+}
+
+// statusText describes the network status of a proposal
+func statusText(p *proposal.Proposal) string {
+	switch p.Status {
+	case proposal.StatusPending:
+		return fmt.Sprintf("Pending (sent %s, checked up to block %d)", p.SentAt.Format("2006-01-02 15:04:05"), p.Checked)
+	case proposal.StatusApplied:
+		return fmt.Sprintf("Applied at height %d", p.AppliedHeight)
+	case proposal.StatusExpired:
+		return "Expired (timestamp window passed)"
+	case proposal.StatusScheduled:
+		return "Scheduled (" + scheduleText(p.Schedule) + ")"
+	}
+	if p.Schedule != nil && p.Schedule.Cancelled != "" {
+		return "Not sent (schedule cancelled: " + p.Schedule.Cancelled + ")"
+	}
+	return "Not sent"
+}
+
+// scheduleText describes when a scheduled proposal is sent
+func scheduleText(s *proposal.Schedule) string {
+	var when []string
+	if !s.At.IsZero() {
+		when = append(when, "after "+s.At.UTC().Format("2006-01-02 15:04:05 MST"))
+	}
+	if s.Height > 0 {
+		when = append(when, fmt.Sprintf("at height %d", s.Height))
+	}
+	if len(when) == 0 {
+		return "sent once the timestamp window opens"
+	}
+	return "sent " + strings.Join(when, " and ")
+}
+
+// batchStatusText describes the network status of a batch
+func batchStatusText(b *proposal.Batch) string {
+	switch b.Status {
+	case proposal.BatchSending:
+		return fmt.Sprintf("Sending message %d of %d", b.Next+1, len(b.Proposals))
+	case proposal.BatchDone:
+		return "All messages applied"
+	case proposal.BatchFailed:
+		return "Failed: " + b.Error
+	}
+	return "Not sent"
+}
@@ -0,0 +1,231 @@
+package networkcontrol
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/FactomProject/factom"
+	"github.com/WhoSoup/factom-networkcontrol/audit"
+	"github.com/WhoSoup/factom-networkcontrol/authset"
+	"github.com/WhoSoup/factom-networkcontrol/proposal"
+)
+
+// fakeSender marks the messages it sends as pending in the store and fails
+// for the ones in fail
+type fakeSender struct {
+	store *proposal.Store
+	fail  map[string]bool
+	sent  []string
+}
+
+func (f *fakeSender) send(m *authset.Message) error {
+	if f.fail[m.Hash()] {
+		return errors.New("connection refused")
+	}
+	f.sent = append(f.sent, m.Hash())
+	_, err := f.store.MarkSent(m.Hash(), 0)
+	return err
+}
+
+// testTracker creates a tracker for the test authorities that sends with f
+// and collects its audit records
+func testTracker(t *testing.T, f *fakeSender, validate func(m *authset.Message, auth []*factom.Authority, now time.Time) *authset.Report) (*Tracker, *[]audit.Record) {
+	t.Helper()
+	ac := NewAuthCache(testAuthorities(), time.Hour)
+	tr := NewTracker(f.store, ac, DefaultProfiles()["mainnet"], validate, f.send, time.Hour)
+	records := new([]audit.Record)
+	tr.Audit(func(r audit.Record, err error) {
+		if err != nil {
+			r.Result = err.Error()
+		}
+		*records = append(*records, r)
+	})
+	return tr, records
+}
+
+func passAll(m *authset.Message, auth []*factom.Authority, now time.Time) *authset.Report {
+	return new(authset.Report)
+}
+
+// testMessages returns n unsigned messages that add new servers
+func testMessages(t *testing.T, n int) []*authset.Message {
+	t.Helper()
+	var msgs []*authset.Message
+	for i := 0; i < n; i++ {
+		m, err := authset.BuildAddServer(testChain(10+i), authset.Audit, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		msgs = append(msgs, m)
+	}
+	return msgs
+}
+
+func TestAdvanceBatches(t *testing.T) {
+	store := openStore(t)
+	msgs := testMessages(t, 4)
+
+	failing, err := store.SaveBatch(msgs[:2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	working, err := store.SaveBatch(msgs[2:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := &fakeSender{store: store, fail: map[string]bool{failing.Proposals[0]: true}}
+	tr, records := testTracker(t, f, passAll)
+
+	for _, id := range []string{failing.ID, working.ID} {
+		if _, err := store.StartBatch(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := tr.AdvanceBatches(); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := store.GetBatch(failing.ID); b.Status != proposal.BatchFailed || b.Error == "" {
+		t.Errorf("batch with a failed send is %q with %q", b.Status, b.Error)
+	}
+	if len(*records) != 1 || (*records)[0].Action != audit.BatchFail || (*records)[0].Batch != failing.ID {
+		t.Errorf("records = %+v, want the failed batch", *records)
+	}
+
+	// the failed batch doesn't hold up the other one, which sends one
+	// message at a time
+	for i, id := range working.Proposals {
+		if len(f.sent) != i+1 || f.sent[i] != id {
+			t.Fatalf("step %d: sent %v, want %s", i+1, f.sent, id)
+		}
+		if err := tr.AdvanceBatches(); err != nil {
+			t.Fatal(err)
+		}
+		if len(f.sent) != i+1 {
+			t.Fatalf("step %d: the next message was sent before the previous one was applied", i+1)
+		}
+		if _, err := store.MarkApplied(id, int64(100+i)); err != nil {
+			t.Fatal(err)
+		}
+		if err := tr.AdvanceBatches(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if b, _ := store.GetBatch(working.ID); b.Status != proposal.BatchDone {
+		t.Errorf("batch is %q after all messages were applied", b.Status)
+	}
+}
+
+func TestAdvanceExpired(t *testing.T) {
+	store := openStore(t)
+	b, err := store.SaveBatch(testMessages(t, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.StartBatch(b.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.MarkExpired(b.Proposals[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	f := &fakeSender{store: store}
+	tr, _ := testTracker(t, f, passAll)
+	if err := tr.Advance(b.ID); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ = store.GetBatch(b.ID); b.Status != proposal.BatchFailed {
+		t.Errorf("batch is %q after its first message expired", b.Status)
+	}
+	if len(f.sent) != 0 {
+		t.Errorf("sent %v after the batch failed", f.sent)
+	}
+}
+
+func TestSendScheduled(t *testing.T) {
+	store := openStore(t)
+	now := time.Now()
+
+	build := func(i int, ts time.Time) *authset.Message {
+		m, err := authset.BuildAddServer(testChain(10+i), authset.Audit, ts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.Save(m); err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	due := build(0, now)
+	later := build(1, now)
+	closed := build(2, now.Add(-2*time.Hour))
+	failing := build(3, now)
+
+	schedules := []struct {
+		m  *authset.Message
+		at time.Time
+	}{
+		{due, now.Add(-time.Minute)},
+		{later, now.Add(time.Hour)},
+		{closed, time.Time{}},
+		{failing, time.Time{}},
+	}
+	for _, s := range schedules {
+		if _, err := store.MarkScheduled(s.m.Hash(), s.at, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	validate := func(m *authset.Message, auth []*factom.Authority, now time.Time) *authset.Report {
+		r := new(authset.Report)
+		if m.Hash() == failing.Hash() {
+			r.Errors = append(r.Errors, "not enough signatures")
+		}
+		return r
+	}
+	f := &fakeSender{store: store}
+	tr, records := testTracker(t, f, validate)
+	if err := tr.SendScheduled(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(f.sent) != 1 || f.sent[0] != due.Hash() {
+		t.Errorf("sent %v, want only %s", f.sent, due.Hash())
+	}
+
+	tests := []struct {
+		name      string
+		m         *authset.Message
+		status    proposal.Status
+		cancelled bool
+	}{
+		{"due", due, proposal.StatusPending, false},
+		{"not due yet", later, proposal.StatusScheduled, false},
+		{"window closed", closed, proposal.StatusDraft, true},
+		{"fails the checks", failing, proposal.StatusDraft, true},
+	}
+	for _, tt := range tests {
+		p, err := store.Get(tt.m.Hash())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Status != tt.status {
+			t.Errorf("%s: status %q, want %q", tt.name, p.Status, tt.status)
+		}
+		if cancelled := p.Schedule != nil && p.Schedule.Cancelled != ""; cancelled != tt.cancelled {
+			t.Errorf("%s: cancelled = %v, want %v", tt.name, cancelled, tt.cancelled)
+		}
+	}
+
+	if len(*records) != 2 {
+		t.Fatalf("records = %+v, want the two cancellations", *records)
+	}
+	for _, r := range *records {
+		if r.Action != audit.ScheduleCancel || r.Result == "" {
+			t.Errorf("record %+v is not a cancellation with a reason", r)
+		}
+	}
+}